@@ -0,0 +1,384 @@
+package analysistools
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// minHashSize is the number of hash functions in a MinHash signature.
+const minHashSize = 128
+
+// minHashSeeds seed the hash functions of a MinHash signature.
+var minHashSeeds = func() []uint64 {
+	seeds := make([]uint64, minHashSize)
+	x := uint64(0x9E3779B97F4A7C15)
+	for i := range seeds {
+		x = mix64(x)
+		seeds[i] = x
+	}
+	return seeds
+}()
+
+// mix64 is the splitmix64 finalizer, it scatters the bits of a hash.
+func mix64(x uint64) uint64 {
+	x += 0x9E3779B97F4A7C15
+	x = (x ^ (x >> 30)) * 0xBF58476D1CE4E5B9
+	x = (x ^ (x >> 27)) * 0x94D049BB133111EB
+	return x ^ (x >> 31)
+}
+
+// DuplicateOptions holds the settings for finding duplicate files.
+type DuplicateOptions struct {
+	// Threshold is the estimated similarity, from 0 to 1, at or above
+	// which two text files are near-duplicates. Zero only finds exact
+	// duplicates.
+	Threshold float64
+	// ShingleSize is the number of words in each shingle compared, five
+	// when zero
+	ShingleSize int
+	// Workers is the number of files read at once
+	Workers int
+	// Filter limits the files included, nil includes every file
+	Filter *FileFilter
+}
+
+// DuplicateFile is a file and the group of copies it belongs to.
+type DuplicateFile struct {
+	Path string
+	Size int64
+	// SHA256 is the hex encoded digest of the file's content
+	SHA256 string
+	// Group numbers the groups of copies from one in the order of the walk.
+	// A file without copies is in a group of its own.
+	Group int
+	// Representative is true for the first file found in a group
+	Representative bool
+	// Match is "exact" or "near" for the other files in a group
+	Match string
+	// Similarity is the estimated similarity of a near-duplicate to the
+	// group's representative, at or above the threshold
+	Similarity float64
+	signature  []uint32
+}
+
+// tokenizable reports if the words of a file of the MIME type can be
+// compared, a document such as a .docx or PDF is compared by the text
+// extracted from it.
+func tokenizable(mimeType string) bool {
+	return isTextType(mimeType) || strings.HasPrefix(mimeType, "message/") || mimeType == "application/mbox" ||
+		DefaultExtractors.Lookup(mimeType) != nil
+}
+
+// minHash returns the MinHash signature of the shingles of the words read,
+// nil if there are no words. Words are compared ignoring case and
+// punctuation.
+func minHash(in io.Reader, shingleSize int) ([]uint32, error) {
+	signature := make([]uint32, minHashSize)
+	for i := range signature {
+		signature[i] = ^uint32(0)
+	}
+	add := func(words []string) {
+		h := fnv.New64a()
+		for _, word := range words {
+			h.Write([]byte(word))
+			h.Write([]byte{0})
+		}
+		x := h.Sum64()
+		for i, seed := range minHashSeeds {
+			if v := uint32(mix64(x ^ seed)); v < signature[i] {
+				signature[i] = v
+			}
+		}
+	}
+	ts := NewTokenStream(in, SplitPunctuation)
+	window := make([]string, 0, shingleSize)
+	shingles := 0
+	for {
+		token, err := ts.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(window) == shingleSize {
+			copy(window, window[1:])
+			window = window[:shingleSize-1]
+		}
+		window = append(window, strings.ToLower(token.Value))
+		if len(window) == shingleSize {
+			add(window)
+			shingles++
+		}
+	}
+	if shingles == 0 {
+		if len(window) == 0 {
+			return nil, nil
+		}
+		// A short text is a single shingle
+		add(window)
+	}
+	return signature, nil
+}
+
+// fileSignature returns the MinHash signature of the words of a file,
+// see extractText. A document whose text can't be extracted is reported
+// and has no signature.
+func fileSignature(ctx context.Context, fName string, shingleSize int) ([]uint32, error) {
+	in, err := os.Open(fName)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	text, _, err := extractText(ctx, in)
+	if err != nil {
+		return nil, skipExtractError(fName, err)
+	}
+	return minHash(&ctxReader{ctx: ctx, r: text}, shingleSize)
+}
+
+// signatureSimilarity estimates the Jaccard similarity of the shingles of
+// two files from their signatures.
+func signatureSimilarity(a []uint32, b []uint32) float64 {
+	same := 0
+	for i := range a {
+		if a[i] == b[i] {
+			same++
+		}
+	}
+	return float64(same) / float64(len(a))
+}
+
+// lshRows returns the number of signature rows per band for locality
+// sensitive hashing. Files agreeing on every row of a band are compared.
+// The most rows are used which still find pairs near the threshold.
+func lshRows(threshold float64) int {
+	for _, rows := range []int{8, 4, 2} {
+		bands := float64(minHashSize / rows)
+		// The similarity at which half the pairs become candidates
+		if math.Pow(1/bands, 1/float64(rows)) < threshold-0.1 {
+			return rows
+		}
+	}
+	return 1
+}
+
+// FindDuplicates walks a directory grouping the files with the same
+// content and, when options.Threshold is more than zero, the text files
+// whose words are nearly the same. Near-duplicates are found by comparing
+// MinHash signatures of the shingles, runs of words, in each file. The
+// files are returned in the order of their groups.
+func FindDuplicates(ctx context.Context, startDir string, excludeList []string, options *DuplicateOptions) ([]*DuplicateFile, error) {
+	files := []*DuplicateFile{}
+	inventoryOptions := &InventoryOptions{Algorithms: []string{"sha256"}, Workers: options.Workers, Filter: options.Filter}
+	err := Inventory(ctx, startDir, excludeList, inventoryOptions, func(entry *InventoryEntry) error {
+		files = append(files, &DuplicateFile{
+			Path:   filepath.Join(startDir, filepath.FromSlash(entry.Path)),
+			Size:   entry.Size,
+			SHA256: entry.Digests["sha256"],
+		})
+		return nil
+	})
+	if err != nil && !errors.Is(err, ErrPartialResults) && len(files) == 0 {
+		return nil, err
+	}
+
+	// Files with the same digest are exact duplicates
+	groups := newUnionFind(len(files))
+	byDigest := make(map[string]int)
+	for i, f := range files {
+		if first, ok := byDigest[f.SHA256]; ok {
+			groups.union(first, i)
+			continue
+		}
+		byDigest[f.SHA256] = i
+	}
+
+	if options.Threshold > 0 && ctx.Err() == nil {
+		// The exact duplicates stand if the near-duplicates aren't finished
+		if nearErr := nearDuplicates(ctx, files, groups, byDigest, options); nearErr != nil && err == nil {
+			err = nearErr
+		}
+	}
+
+	// The files joined are connected by similar pairs, so a file at the end
+	// of a chain may be unlike the first file. Each file joins the first
+	// representative of its connected files it is similar to, or else
+	// represents a group of its own. The groups are numbered in the order of
+	// their first file.
+	leaders := make(map[int][]int)
+	leaderOf := make([]int, len(files))
+	groupNo := make(map[int]int)
+	for i, f := range files {
+		leader := -1
+		if first := byDigest[f.SHA256]; first != i {
+			leader = leaderOf[first]
+		} else {
+			root := groups.find(i)
+			for _, l := range leaders[root] {
+				if f.signature != nil && files[l].signature != nil && signatureSimilarity(f.signature, files[l].signature) >= options.Threshold {
+					leader = l
+					break
+				}
+			}
+			if leader < 0 {
+				leader = i
+				leaders[root] = append(leaders[root], i)
+			}
+		}
+		leaderOf[i] = leader
+		if leader == i {
+			groupNo[i] = len(groupNo) + 1
+			f.Representative = true
+		}
+		f.Group = groupNo[leader]
+	}
+	representative := make(map[int]*DuplicateFile)
+	for _, f := range files {
+		if f.Representative {
+			representative[f.Group] = f
+			continue
+		}
+		first := representative[f.Group]
+		switch {
+		case f.SHA256 == first.SHA256:
+			f.Match, f.Similarity = "exact", 1
+		default:
+			f.Match = "near"
+			if f.signature != nil && first.signature != nil {
+				f.Similarity = signatureSimilarity(f.signature, first.signature)
+			}
+		}
+	}
+	sort.SliceStable(files, func(i, j int) bool { return files[i].Group < files[j].Group })
+	return files, err
+}
+
+// nearDuplicates joins the groups of text files with similar signatures.
+// Only the first file with each digest is read, by a pool of workers, see
+// parallelOrdered. Files which can't be read are reported and the last
+// error is returned once the groups are joined.
+func nearDuplicates(ctx context.Context, files []*DuplicateFile, groups *unionFind, byDigest map[string]int, options *DuplicateOptions) error {
+	shingleSize := options.ShingleSize
+	if shingleSize <= 0 {
+		shingleSize = 5
+	}
+	candidates := []int{}
+	for _, i := range byDigest {
+		if tokenizable(mimeTypeOf(filepath.Ext(files[i].Path))) {
+			candidates = append(candidates, i)
+		}
+	}
+	sort.Ints(candidates)
+
+	byPath := make(map[string]*DuplicateFile, len(candidates))
+	for _, i := range candidates {
+		byPath[files[i].Path] = files[i]
+	}
+	var lastErr error
+	err := parallelOrdered(options.Workers, func(add func(path string) error) error {
+		for _, i := range candidates {
+			if err := add(files[i].Path); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, func(path string) (func() error, error) {
+		signature, err := fileSignature(ctx, path, shingleSize)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, partialResults(ctx.Err())
+			}
+			return func() error {
+				fmt.Fprintf(os.Stderr, "skipping %s: %s\n", path, err)
+				lastErr = err
+				return nil
+			}, nil
+		}
+		return func() error {
+			byPath[path].signature = signature
+			return nil
+		}, nil
+	})
+	if err != nil {
+		return err
+	}
+	// Copies share the signature of the file read
+	for _, f := range files {
+		f.signature = files[byDigest[f.SHA256]].signature
+	}
+
+	// Files agreeing on every row of a band are candidate pairs
+	rows := lshRows(options.Threshold)
+	for band := 0; band < minHashSize/rows; band++ {
+		buckets := make(map[string][]int)
+		key := make([]byte, rows*4)
+		for _, i := range candidates {
+			sig := files[i].signature
+			if sig == nil {
+				continue
+			}
+			for r := 0; r < rows; r++ {
+				binary.LittleEndian.PutUint32(key[r*4:], sig[band*rows+r])
+			}
+			buckets[string(key)] = append(buckets[string(key)], i)
+		}
+		for _, bucket := range buckets {
+			for a := 0; a < len(bucket); a++ {
+				for b := a + 1; b < len(bucket); b++ {
+					i, j := bucket[a], bucket[b]
+					if groups.find(i) == groups.find(j) {
+						continue
+					}
+					if signatureSimilarity(files[i].signature, files[j].signature) >= options.Threshold {
+						groups.union(i, j)
+					}
+				}
+			}
+		}
+	}
+	return lastErr
+}
+
+// unionFind tracks the groups of files as they are joined.
+type unionFind struct {
+	parent []int
+}
+
+func newUnionFind(n int) *unionFind {
+	uf := &unionFind{parent: make([]int, n)}
+	for i := range uf.parent {
+		uf.parent[i] = i
+	}
+	return uf
+}
+
+// find returns the root of a file's group.
+func (uf *unionFind) find(i int) int {
+	for uf.parent[i] != i {
+		uf.parent[i] = uf.parent[uf.parent[i]]
+		i = uf.parent[i]
+	}
+	return i
+}
+
+// union joins two groups keeping the earlier file as the root.
+func (uf *unionFind) union(i int, j int) {
+	a, b := uf.find(i), uf.find(j)
+	if a == b {
+		return
+	}
+	if b < a {
+		a, b = b, a
+	}
+	uf.parent[b] = a
+}
@@ -0,0 +1,120 @@
+package analysistools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFindDuplicates(t *testing.T) {
+	dir := t.TempDir()
+	letter := "Dear Sir, I write to inform you that the committee met on Tuesday and agreed to fund the new telescope for the observatory. The work will begin in the spring and we expect the instrument to be ready within two years. Yours sincerely, the Director."
+	writeTree(t, dir, map[string]string{
+		"a-letter.txt":    letter,
+		"b-unrelated.txt": "Minutes of the faculty meeting held on Friday concerning the library budget and the hours of the reading room.",
+		"box1/copy.txt":   letter,
+		"box1/draft.txt":  strings.Replace(letter, "Tuesday", "Wednesday", 1),
+		"box1/scan.bin":   letter,
+		// A document is compared by its text
+		"box1/typed.docx": string(officeFile(t, "word/document.xml", `<w:document `+wordNS+`><w:body><w:p><w:r><w:t>`+
+			strings.Replace(letter, "Tuesday", "Thursday", 1)+`</w:t></w:r></w:p></w:body></w:document>`)),
+	})
+	describe := func(found []*DuplicateFile) string {
+		got := []string{}
+		for _, f := range found {
+			rel, _ := filepath.Rel(dir, f.Path)
+			got = append(got, fmt.Sprintf("%d %t %s %q", f.Group, f.Representative, filepath.ToSlash(rel), f.Match))
+		}
+		return strings.Join(got, "\n")
+	}
+
+	found, err := FindDuplicates(context.Background(), dir, nil, &DuplicateOptions{Threshold: 0.5, Workers: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := strings.Join([]string{
+		`1 true a-letter.txt ""`,
+		`1 false box1/copy.txt "exact"`,
+		`1 false box1/draft.txt "near"`,
+		`1 false box1/scan.bin "exact"`,
+		`1 false box1/typed.docx "near"`,
+		`2 true b-unrelated.txt ""`,
+	}, "\n")
+	if got := describe(found); got != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, got)
+	}
+	for _, f := range found {
+		if f.Match == "near" && (f.Similarity < 0.5 || f.Similarity >= 1) {
+			t.Errorf("expected %s to be similar but not the same, got %g", f.Path, f.Similarity)
+		}
+	}
+
+	// A threshold of zero only finds exact duplicates
+	found, err = FindDuplicates(context.Background(), dir, nil, &DuplicateOptions{Workers: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = strings.Join([]string{
+		`1 true a-letter.txt ""`,
+		`1 false box1/copy.txt "exact"`,
+		`1 false box1/scan.bin "exact"`,
+		`2 true b-unrelated.txt ""`,
+		`3 true box1/draft.txt ""`,
+		`4 true box1/typed.docx ""`,
+	}, "\n")
+	if got := describe(found); got != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, got)
+	}
+
+	// A file similar only to a near-duplicate of the representative starts
+	// a group of its own
+	chain := t.TempDir()
+	words := []string{}
+	for i := 1; i <= 30; i++ {
+		words = append(words, fmt.Sprintf("w%02d", i))
+	}
+	writeTree(t, chain, map[string]string{
+		"a.txt": strings.Join(words[0:20], " "),
+		"b.txt": strings.Join(words[5:25], " "),
+		"c.txt": strings.Join(words[10:30], " "),
+	})
+	found, err = FindDuplicates(context.Background(), chain, nil, &DuplicateOptions{Threshold: 0.4, Workers: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, f := range found {
+		got = append(got, fmt.Sprintf("%d %t %s %q", f.Group, f.Representative, filepath.Base(f.Path), f.Match))
+		if f.Match == "near" && f.Similarity < 0.4 {
+			t.Errorf("expected %s to be at or above the threshold, got %g", f.Path, f.Similarity)
+		}
+	}
+	expected = strings.Join([]string{
+		`1 true a.txt ""`,
+		`1 false b.txt "near"`,
+		`2 true c.txt ""`,
+	}, "\n")
+	if strings.Join(got, "\n") != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, strings.Join(got, "\n"))
+	}
+
+	// A file which can't be read is reported, a cancelled search returns
+	// partial results
+	pair := []*DuplicateFile{{Path: filepath.Join(dir, "a-letter.txt"), SHA256: "a"}, {Path: filepath.Join(dir, "missing.txt"), SHA256: "b"}}
+	byDigest := map[string]int{"a": 0, "b": 1}
+	if err := nearDuplicates(context.Background(), pair, newUnionFind(2), byDigest, &DuplicateOptions{Threshold: 0.5}); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected the missing file's error, got %v", err)
+	}
+	if pair[0].signature == nil {
+		t.Errorf("expected a signature for the readable file")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := nearDuplicates(ctx, pair, newUnionFind(2), byDigest, &DuplicateOptions{Threshold: 0.5}); !errors.Is(err, ErrPartialResults) {
+		t.Errorf("expected partial results, got %v", err)
+	}
+}
@@ -0,0 +1,191 @@
+package analysistools
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ExcludeList holds the files and directories to skip when walking a
+// directory. Entries use the same syntax as a .gitignore file.
+//
+// - blank lines and lines starting with "#" are ignored
+// - "*", "?" and "[a-z]" match within a path element, e.g. "*.bak"
+// - an entry without a "/" matches a file or directory by name at any depth, e.g. "law" skips "cases/law" but not "lawrence"
+// - an entry with a "/" at the start or in the middle is relative to the directory walked, e.g. "/archive/2019"
+// - "**" matches any number of directories, e.g. "**/drafts" or "archive/**/*.tmp"
+// - a trailing "/" only matches directories, e.g. ".git/"
+// - a leading "!" includes a file again which an earlier entry excluded, e.g. "!keep.tmp". A file can't be included again if its directory is excluded.
+//
+// The last matching entry decides if a path is excluded.
+type ExcludeList struct {
+	rules []*excludeRule
+	// fullPaths holds the entries written as a full path, see
+	// newWalkExcludeList, with the directory walked
+	fullPaths []string
+	root      string
+	absRoot   string
+}
+
+// excludeRule is a single entry of an exclude list.
+type excludeRule struct {
+	elements []string
+	negate   bool
+	dirOnly  bool
+}
+
+// NewExcludeList parses exclude list entries, one entry per string.
+func NewExcludeList(entries []string) (*ExcludeList, error) {
+	el := &ExcludeList{}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		rule := &excludeRule{}
+		if strings.HasPrefix(entry, "!") {
+			rule.negate = true
+			entry = entry[1:]
+		} else if strings.HasPrefix(entry, `\!`) || strings.HasPrefix(entry, `\#`) {
+			entry = entry[1:]
+		}
+		if strings.HasSuffix(entry, "/") {
+			rule.dirOnly = true
+			entry = strings.TrimRight(entry, "/")
+		}
+		// Entries without a "/" match at any depth
+		if !strings.Contains(entry, "/") {
+			entry = "**/" + entry
+		}
+		entry = strings.TrimPrefix(entry, "/")
+		if entry == "" {
+			return nil, fmt.Errorf("exclude list entry has no path")
+		}
+		rule.elements = strings.Split(entry, "/")
+		for _, elem := range rule.elements {
+			if _, err := path.Match(elem, ""); err != nil {
+				return nil, fmt.Errorf("bad exclude list entry %q, %s", entry, err)
+			}
+		}
+		el.rules = append(el.rules, rule)
+	}
+	return el, nil
+}
+
+// newWalkExcludeList parses the exclude list for a walk of startDir.
+// Exclude lists written before the gitignore syntax were matched as a
+// substring of the full path, so an entry which starts with startDir, or an
+// absolute path which exists outside of startDir, is still matched that way
+// and a warning is printed.
+func newWalkExcludeList(startDir string, entries []string) (*ExcludeList, error) {
+	root := filepath.ToSlash(filepath.Clean(startDir))
+	absRoot := root
+	if abs, err := filepath.Abs(startDir); err == nil {
+		absRoot = filepath.ToSlash(abs)
+	}
+	rest := []string{}
+	fullPaths := []string{}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if isFullPathEntry(entry, root, absRoot) {
+			fmt.Fprintf(os.Stderr, "warning: exclude list entry %q is matched as a full path, use a path relative to %s instead\n", entry, startDir)
+			fullPaths = append(fullPaths, strings.TrimRight(entry, "/"))
+			continue
+		}
+		rest = append(rest, entry)
+	}
+	el, err := NewExcludeList(rest)
+	if err != nil {
+		return nil, err
+	}
+	el.fullPaths, el.root, el.absRoot = fullPaths, root, absRoot
+	return el, nil
+}
+
+// isFullPathEntry reports if an exclude list entry is a path which includes
+// the directory walked or an existing absolute path outside of it.
+func isFullPathEntry(entry string, root string, absRoot string) bool {
+	if entry == "" || strings.HasPrefix(entry, "#") || strings.HasPrefix(entry, "!") {
+		return false
+	}
+	for _, dir := range []string{root, absRoot} {
+		if dir != "." && dir != "/" && (entry == dir || strings.HasPrefix(entry, dir+"/")) {
+			return true
+		}
+	}
+	if !strings.HasPrefix(entry, "/") {
+		return false
+	}
+	if _, err := os.Stat(filepath.FromSlash(entry)); err != nil {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(filepath.FromSlash(root), filepath.FromSlash(entry)))
+	return err != nil
+}
+
+// excludedFullPath reports if a path, relative to the directory walked,
+// contains one of the entries written as a full path.
+func (el *ExcludeList) excludedFullPath(name string) bool {
+	if el == nil || len(el.fullPaths) == 0 {
+		return false
+	}
+	fullName := path.Join(el.root, name)
+	absName := path.Join(el.absRoot, name)
+	for _, entry := range el.fullPaths {
+		if strings.Contains(fullName, entry) || strings.Contains(absName, entry) {
+			return true
+		}
+	}
+	return false
+}
+
+// Excluded reports if a path should be skipped. The path is relative to the
+// directory being walked and uses "/" as the separator. The walk skips the
+// contents of an excluded directory so only the path itself is checked.
+func (el *ExcludeList) Excluded(name string, isDir bool) bool {
+	if el == nil || name == "" || name == "." {
+		return false
+	}
+	elements := strings.Split(strings.Trim(name, "/"), "/")
+	excluded := false
+	for _, rule := range el.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if matchElements(rule.elements, elements) {
+			excluded = !rule.negate
+		}
+	}
+	return excluded
+}
+
+// matchElements matches a path, split into its elements, against the
+// elements of an exclude list entry.
+func matchElements(pattern []string, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// A trailing "**" matches everything inside a directory but not
+			// the directory itself
+			start := 0
+			if len(pattern) == 1 {
+				start = 1
+			}
+			for i := start; i <= len(name); i++ {
+				if matchElements(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
@@ -0,0 +1,111 @@
+package analysistools
+
+import (
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestExcludeList(t *testing.T) {
+	el, err := NewExcludeList([]string{
+		"# comments and blank lines are ignored",
+		"",
+		"law",
+		"*.bak",
+		"/archive/2019",
+		".git/",
+		"drafts/**",
+		"**/tmp/*.log",
+		"!important.bak",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		isDir bool
+		want  bool
+	}{
+		{name: "law", isDir: true, want: true},
+		{name: "cases/law", isDir: false, want: true},
+		{name: "archive/lawrence", isDir: true, want: false},
+		{name: "lawrence/law.txt", isDir: false, want: false},
+		{name: "notes.bak", want: true},
+		{name: "cases/notes.bak", want: true},
+		{name: "important.bak", want: false},
+		{name: "archive/2019", isDir: true, want: true},
+		{name: "old/archive/2019", isDir: true, want: false},
+		{name: ".git", isDir: true, want: true},
+		{name: ".git", isDir: false, want: false},
+		{name: "drafts", isDir: true, want: false},
+		{name: "drafts/memo.txt", want: true},
+		{name: "drafts/2020/memo.txt", want: true},
+		{name: "tmp/run.log", want: true},
+		{name: "a/b/tmp/run.log", want: true},
+		{name: "tmp/run.txt", want: false},
+	}
+	for _, tt := range tests {
+		if got := el.Excluded(tt.name, tt.isDir); got != tt.want {
+			t.Errorf("Excluded(%q, %t) = %t, want %t", tt.name, tt.isDir, got, tt.want)
+		}
+	}
+	if _, err := NewExcludeList([]string{"[a-"}); err == nil {
+		t.Errorf("expected an error for a bad pattern")
+	}
+}
+
+func TestWalkExcludeList(t *testing.T) {
+	dir := t.TempDir()
+	tree := map[string]string{}
+	for _, name := range []string{"law/a.txt", "lawrence/b.txt", "cases/law/c.txt", "cases/d.bak", "cases/keep.bak", "e.txt"} {
+		tree[name] = "memo"
+	}
+	writeTree(t, dir, tree)
+	fileTypes, err := FileTypes(dir, []string{"law/", "*.bak", "!keep.bak"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for fName := range fileTypes {
+		rel, _ := filepath.Rel(dir, fName)
+		got = append(got, filepath.ToSlash(rel))
+	}
+	sort.Strings(got)
+	want := []string{"cases/keep.bak", "e.txt", "lawrence/b.txt"}
+	if !equalStringSlices(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestWalkExcludeListFullPaths(t *testing.T) {
+	dir := t.TempDir()
+	tree := map[string]string{}
+	for _, name := range []string{"law/a.txt", "lawrence/b.txt", "cases/law/c.txt", "cases/d.bak", "e.txt"} {
+		tree[name] = "memo"
+	}
+	writeTree(t, dir, tree)
+	// Entries holding the directory walked are matched against the full
+	// path as before, "/cases/law" doesn't exist so it is relative to dir
+	outside := t.TempDir()
+	fileTypes, err := FileTypes(dir, []string{filepath.Join(dir, "law"), filepath.Join(dir, "cases", "d.bak"), "/cases/law", outside})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for fName := range fileTypes {
+		rel, _ := filepath.Rel(dir, fName)
+		got = append(got, filepath.ToSlash(rel))
+	}
+	sort.Strings(got)
+	// The old substring match also skips "lawrence"
+	want := []string{"e.txt"}
+	if !equalStringSlices(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	if !isFullPathEntry(outside, filepath.ToSlash(dir), filepath.ToSlash(dir)) {
+		t.Errorf("expected an existing absolute path to be matched as a full path")
+	}
+	if isFullPathEntry("/cases/law", filepath.ToSlash(dir), filepath.ToSlash(dir)) {
+		t.Errorf("expected %q to be relative to the directory walked", "/cases/law")
+	}
+}
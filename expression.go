@@ -0,0 +1,554 @@
+package analysistools
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Expr is a node in a boolean pattern expression such as
+// `(attorn* OR counsel*) AND NOT newsletter`. Expressions are scoped to a
+// whole document, i.e. the token list produced by TokenReader.
+type Expr interface {
+	// Eval evaluates the expression against a token list. It returns
+	// the spans of tokens which satisfied the positive terms of the
+	// expression and true if the expression holds.
+	Eval(tokens []*Token) ([][]*Token, bool)
+	// String returns the expression in pattern syntax.
+	String() string
+}
+
+// TermExpr matches a keyword or, when it holds more than one term, an
+// exact phrase.
+type TermExpr struct {
+	Terms         []string
+	Normalization Normalization
+}
+
+// AndExpr holds when both sides hold.
+type AndExpr struct {
+	Left  Expr
+	Right Expr
+}
+
+// OrExpr holds when either side holds.
+type OrExpr struct {
+	Left  Expr
+	Right Expr
+}
+
+// NotExpr holds when the wrapped expression does not.
+type NotExpr struct {
+	Expr Expr
+}
+
+// ProximityExpr holds when the right term is found within MaxDistance
+// words of the left term or, when Scope is set, in the same sentence or
+// paragraph. When Ordered is true the right term must follow the left
+// term (pre/N). When Exclude is true it holds for the left terms which do
+// not have the right term nearby (not w/N).
+type ProximityExpr struct {
+	Left        *TermExpr
+	Right       *TermExpr
+	MaxDistance int
+	Scope       ProximityScope
+	Ordered     bool
+	Exclude     bool
+}
+
+// ProximityScope is the unit a proximity operator is measured in. The zero
+// value counts words.
+type ProximityScope string
+
+const (
+	WordScope      ProximityScope = ""
+	SentenceScope  ProximityScope = "s"
+	ParagraphScope ProximityScope = "p"
+)
+
+// maxScopeWords is the most words between the keywords of a sentence or
+// paragraph proximity pattern, bounding the keywords a stream holds.
+const maxScopeWords = 10000
+
+func (e *TermExpr) Eval(tokens []*Token) ([][]*Token, bool) {
+	spans := termSpans(tokens, e.Terms, e.Normalization)
+	return spans, len(spans) > 0
+}
+
+func (e *TermExpr) String() string {
+	return strings.Join(e.Terms, " ")
+}
+
+func (e *AndExpr) Eval(tokens []*Token) ([][]*Token, bool) {
+	left, ok := e.Left.Eval(tokens)
+	if !ok {
+		return nil, false
+	}
+	right, ok := e.Right.Eval(tokens)
+	if !ok {
+		return nil, false
+	}
+	return mergeSpans(left, right), true
+}
+
+func (e *AndExpr) String() string {
+	return fmt.Sprintf("(%s AND %s)", e.Left, e.Right)
+}
+
+func (e *OrExpr) Eval(tokens []*Token) ([][]*Token, bool) {
+	left, leftOk := e.Left.Eval(tokens)
+	right, rightOk := e.Right.Eval(tokens)
+	switch {
+	case leftOk && rightOk:
+		return mergeSpans(left, right), true
+	case leftOk:
+		return left, true
+	case rightOk:
+		return right, true
+	}
+	return nil, false
+}
+
+func (e *OrExpr) String() string {
+	return fmt.Sprintf("(%s OR %s)", e.Left, e.Right)
+}
+
+func (e *NotExpr) Eval(tokens []*Token) ([][]*Token, bool) {
+	if _, ok := e.Expr.Eval(tokens); ok {
+		return nil, false
+	}
+	return nil, true
+}
+
+func (e *NotExpr) String() string {
+	return fmt.Sprintf("NOT %s", e.Expr)
+}
+
+func (e *ProximityExpr) Eval(tokens []*Token) ([][]*Token, bool) {
+	left, right := [][]*Token{}, [][]*Token{}
+	for _, m := range proximityMatches(termSpans(tokens, e.Left.Terms, e.Left.Normalization), termSpans(tokens, e.Right.Terms, e.Right.Normalization), e.operator()) {
+		left = append(left, m.Span)
+		if m.Near != nil {
+			right = append(right, m.Near)
+		}
+	}
+	return mergeSpans(left, right), len(left) > 0
+}
+
+func (e *ProximityExpr) String() string {
+	return fmt.Sprintf("%s %s %s", e.Left, e.operator(), e.Right)
+}
+
+func (e *ProximityExpr) operator() *proximityOperator {
+	return &proximityOperator{
+		maxDistance: e.MaxDistance,
+		scope:       e.Scope,
+		ordered:     e.Ordered,
+		exclude:     e.Exclude,
+	}
+}
+
+// ProximityMatch is a span found in range of another span by a proximity
+// operator. Distance is the number of words from one span to the other.
+// Near is nil when the operator excludes spans found in range.
+type ProximityMatch struct {
+	Span     []*Token
+	Near     []*Token
+	Distance int
+}
+
+// proximityMatches returns each pair of left and right spans in range of
+// the operator. If the operator excludes then each left span without a
+// right span in range is returned instead. Both span lists must be in
+// document order.
+func proximityMatches(left [][]*Token, right [][]*Token, op *proximityOperator) []*ProximityMatch {
+	matches := []*ProximityMatch{}
+	for _, l := range left {
+		near := proximityNear(l, right, op)
+		switch {
+		case op.exclude && len(near) == 0:
+			matches = append(matches, &ProximityMatch{Span: l})
+		case !op.exclude:
+			matches = append(matches, near...)
+		}
+	}
+	return matches
+}
+
+// proximityNear returns the right spans in range of span.
+func proximityNear(span []*Token, right [][]*Token, op *proximityOperator) []*ProximityMatch {
+	matches := []*ProximityMatch{}
+	start, end := span[0].WordNo, span[len(span)-1].WordNo
+	// Positions are measured in words, sentences or paragraphs and only
+	// the right spans which end at or after lowest can be in range.
+	first, last, lowest := start, end, end+1
+	if op.scope != WordScope {
+		first, last = scopeNo(span[0], op.scope), scopeNo(span[len(span)-1], op.scope)
+		lowest = first
+	} else if !op.ordered {
+		lowest = start - op.maxDistance
+	}
+	i := sort.Search(len(right), func(i int) bool {
+		return scopeNo(right[i][len(right[i])-1], op.scope) >= lowest
+	})
+	for ; i < len(right) && scopeNo(right[i][0], op.scope) <= last+op.maxDistance; i++ {
+		if distance, ok := proximityPair(span, right[i], op); ok {
+			matches = append(matches, &ProximityMatch{Span: span, Near: right[i], Distance: distance})
+		}
+	}
+	return matches
+}
+
+// proximityPair reports if the right span is in range of the left span
+// and the distance in words between them.
+func proximityPair(left []*Token, right []*Token, op *proximityOperator) (int, bool) {
+	start, end := left[0].WordNo, left[len(left)-1].WordNo
+	distance := right[0].WordNo - end
+	if distance <= 0 && !op.ordered {
+		distance = start - right[len(right)-1].WordNo
+	}
+	if distance <= 0 {
+		return 0, false
+	}
+	if op.scope != WordScope {
+		// Spans sharing a sentence or paragraph are in range up to maxScopeWords
+		ok := distance <= maxScopeWords && scopeNo(right[0], op.scope) <= scopeNo(left[len(left)-1], op.scope) &&
+			scopeNo(right[len(right)-1], op.scope) >= scopeNo(left[0], op.scope)
+		return distance, ok
+	}
+	return distance, distance <= op.maxDistance
+}
+
+// scopeNo returns the word, sentence or paragraph number of a token.
+func scopeNo(token *Token, scope ProximityScope) int {
+	switch scope {
+	case SentenceScope:
+		return token.SentenceNo
+	case ParagraphScope:
+		return token.ParagraphNo
+	}
+	return token.WordNo
+}
+
+// proximityOperator holds a parsed proximity operator, e.g. w/N, pre/N,
+// w/s, w/p, not w/N or not pre/N.
+type proximityOperator struct {
+	maxDistance int
+	scope       ProximityScope
+	ordered     bool
+	exclude     bool
+}
+
+func (op *proximityOperator) String() string {
+	distance := fmt.Sprintf("%d", op.maxDistance)
+	if op.scope != WordScope {
+		distance = string(op.scope)
+	}
+	name := "w/"
+	if op.ordered {
+		name = "pre/"
+	}
+	if op.exclude {
+		name = "not " + name
+	}
+	return name + distance
+}
+
+// isProximityOperator reports if an item is a w/N or pre/N operator.
+func isProximityOperator(item string) bool {
+	return strings.HasPrefix(item, "w/") || strings.HasPrefix(item, "pre/")
+}
+
+// parseProximityOperator parses the proximity operator at the start of items.
+// It returns the operator and the number of items consumed or zero when items
+// does not start with a proximity operator.
+func parseProximityOperator(items []string, pattern string) (*proximityOperator, int, error) {
+	op, n := &proximityOperator{}, 0
+	if len(items) > 1 && strings.ToLower(items[0]) == "not" && isProximityOperator(items[1]) {
+		op.exclude = true
+		n++
+	}
+	if n >= len(items) || !isProximityOperator(items[n]) {
+		return nil, 0, nil
+	}
+	item := items[n]
+	if strings.HasPrefix(item, "pre/") {
+		op.ordered = true
+		item = strings.TrimPrefix(item, "pre/")
+	} else {
+		item = strings.TrimPrefix(item, "w/")
+	}
+	switch ProximityScope(item) {
+	case SentenceScope, ParagraphScope:
+		op.scope = ProximityScope(item)
+		return op, n + 1, nil
+	}
+	maxDistance, err := strconv.Atoi(item)
+	// w/0 could never match, a keyword is at least one word from another
+	if err != nil || maxDistance < 1 {
+		return nil, 0, fmt.Errorf("invalid max distance in pattern: %q", pattern)
+	}
+	op.maxDistance = maxDistance
+	return op, n + 1, nil
+}
+
+// termSpans returns the spans matching a keyword or phrase.
+func termSpans(tokens []*Token, terms []string, n Normalization) [][]*Token {
+	if len(terms) == 1 {
+		spans := [][]*Token{}
+		for i, token := range tokens {
+			if termMatches(token.Value, terms[0], n) {
+				spans = append(spans, tokens[i:i+1])
+			}
+		}
+		return spans
+	}
+	return checkPhrase(tokens, terms, n)
+}
+
+// normalizeExpr applies a normalization to each term of an expression.
+func normalizeExpr(expr Expr, n Normalization) {
+	switch e := expr.(type) {
+	case *TermExpr:
+		e.Normalization = e.Normalization.Merge(n)
+	case *AndExpr:
+		normalizeExpr(e.Left, n)
+		normalizeExpr(e.Right, n)
+	case *OrExpr:
+		normalizeExpr(e.Left, n)
+		normalizeExpr(e.Right, n)
+	case *NotExpr:
+		normalizeExpr(e.Expr, n)
+	case *ProximityExpr:
+		normalizeExpr(e.Left, n)
+		normalizeExpr(e.Right, n)
+	}
+}
+
+// mergeSpans combines two span lists in document order dropping duplicates.
+func mergeSpans(a [][]*Token, b [][]*Token) [][]*Token {
+	spans := append(append([][]*Token{}, a...), b...)
+	sort.SliceStable(spans, func(i, j int) bool {
+		if spans[i][0].WordNo == spans[j][0].WordNo {
+			return len(spans[i]) < len(spans[j])
+		}
+		return spans[i][0].WordNo < spans[j][0].WordNo
+	})
+	result := [][]*Token{}
+	for i, span := range spans {
+		if i > 0 && span[0].WordNo == spans[i-1][0].WordNo && len(span) == len(spans[i-1]) {
+			continue
+		}
+		result = append(result, span)
+	}
+	return result
+}
+
+// isBooleanPattern reports if the pattern uses the boolean operators. The
+// parentheses of a pattern without them, e.g. "(see attached) memo", are
+// part of its words.
+func isBooleanPattern(parts []string) bool {
+	for _, part := range parts {
+		if part == "AND" || part == "OR" || part == "NOT" {
+			return true
+		}
+	}
+	return false
+}
+
+// exprParser is a recursive descent parser for boolean patterns.
+//
+// ```
+//   or      := and { "OR" and }
+//   and     := unary { "AND" unary }
+//   unary   := "NOT" unary | prox
+//   prox    := primary [ [ "not" ] ( "w/" | "pre/" ) ( N | "s" | "p" ) primary ]
+//   primary := "(" or ")" | TERM { TERM }
+// ```
+type exprParser struct {
+	pattern string
+	items   []string
+	pos     int
+}
+
+// ParseExpression parses a boolean pattern such as
+// `privilege* AND (memo OR brief*)`. The operators AND, OR and NOT must be
+// written in upper case, adjacent terms form a phrase.
+func ParseExpression(pattern string) (Expr, error) {
+	p := &exprParser{
+		pattern: pattern,
+		items:   lexExpression(pattern),
+	}
+	if len(p.items) == 0 {
+		return nil, fmt.Errorf("missing pattern")
+	}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.items) {
+		return nil, fmt.Errorf("unexpected %q in pattern: %q", p.items[p.pos], pattern)
+	}
+	if !hasPositiveTerm(expr) {
+		return nil, fmt.Errorf("boolean pattern needs a term that is not negated: %q", pattern)
+	}
+	return expr, nil
+}
+
+// lexExpression splits a pattern into terms, operators and parentheses.
+func lexExpression(pattern string) []string {
+	items := []string{}
+	for _, field := range strings.Fields(pattern) {
+		for strings.HasPrefix(field, "(") {
+			items = append(items, "(")
+			field = field[1:]
+		}
+		closing := 0
+		for strings.HasSuffix(field, ")") {
+			closing++
+			field = field[:len(field)-1]
+		}
+		if field != "" {
+			items = append(items, field)
+		}
+		for ; closing > 0; closing-- {
+			items = append(items, ")")
+		}
+	}
+	return items
+}
+
+func (p *exprParser) peek() string {
+	if p.pos < len(p.items) {
+		return p.items[p.pos]
+	}
+	return ""
+}
+
+func (p *exprParser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "OR" {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &OrExpr{Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "AND" {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &AndExpr{Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseUnary() (Expr, error) {
+	if p.peek() == "NOT" {
+		p.pos++
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &NotExpr{Expr: expr}, nil
+	}
+	return p.parseProximity()
+}
+
+func (p *exprParser) parseProximity() (Expr, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	op, n, err := parseProximityOperator(p.items[p.pos:], p.pattern)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return left, nil
+	}
+	p.pos += n
+	right, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	leftTerm, ok1 := left.(*TermExpr)
+	rightTerm, ok2 := right.(*TermExpr)
+	if !ok1 || !ok2 {
+		return nil, fmt.Errorf("proximity operands must be terms: %q", p.pattern)
+	}
+	return &ProximityExpr{
+		Left:        leftTerm,
+		Right:       rightTerm,
+		MaxDistance: op.maxDistance,
+		Scope:       op.scope,
+		Ordered:     op.ordered,
+		Exclude:     op.exclude,
+	}, nil
+}
+
+func (p *exprParser) parsePrimary() (Expr, error) {
+	switch item := p.peek(); {
+	case item == "":
+		return nil, fmt.Errorf("unexpected end of pattern: %q", p.pattern)
+	case item == "(":
+		p.pos++
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("missing closing parenthesis in pattern: %q", p.pattern)
+		}
+		p.pos++
+		return expr, nil
+	case isOperator(item):
+		return nil, fmt.Errorf("unexpected %q in pattern: %q", item, p.pattern)
+	}
+	terms := []string{}
+	for item := p.peek(); item != "" && !isOperator(item); item = p.peek() {
+		if _, n, _ := parseProximityOperator(p.items[p.pos:], p.pattern); n > 0 {
+			break
+		}
+		terms = append(terms, item)
+		p.pos++
+	}
+	return &TermExpr{Terms: terms}, nil
+}
+
+// isOperator reports if an item is an operator or parenthesis rather than a term.
+func isOperator(item string) bool {
+	switch item {
+	case "AND", "OR", "NOT", "(", ")":
+		return true
+	}
+	return isProximityOperator(item)
+}
+
+// hasPositiveTerm reports if an expression can produce a matching span.
+func hasPositiveTerm(expr Expr) bool {
+	switch e := expr.(type) {
+	case *AndExpr:
+		return hasPositiveTerm(e.Left) || hasPositiveTerm(e.Right)
+	case *OrExpr:
+		return hasPositiveTerm(e.Left) && hasPositiveTerm(e.Right)
+	case *NotExpr:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,181 @@
+package analysistools
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseExpression(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+		errMsg  string
+	}{
+		{
+			input: "(attorn* OR counsel*) AND NOT newsletter",
+			want:  "((attorn* OR counsel*) AND NOT newsletter)",
+		},
+		{
+			input: "privilege* AND (memo OR brief*)",
+			want:  "(privilege* AND (memo OR brief*))",
+		},
+		{
+			input: "attorn* OR counsel* AND memo",
+			want:  "(attorn* OR (counsel* AND memo))",
+		},
+		{
+			input: "privileged and confidential AND NOT (draft OR template)",
+			want:  "(privileged and confidential AND NOT (draft OR template))",
+		},
+		{
+			input: "(attorn* w/5 client*) AND privilege*",
+			want:  "(attorn* w/5 client* AND privilege*)",
+		},
+		{
+			input: "(attorn* pre/5 client*) OR (law NOT w/3 school)",
+			want:  "(attorn* pre/5 client* OR law not w/3 school)",
+		},
+		{
+			input: "summary judgment not pre/4 denied AND motion*",
+			want:  "(summary judgment not pre/4 denied AND motion*)",
+		},
+		{
+			input: "(privilege* w/s counsel*) OR (memo pre/p brief*)",
+			want:  "(privilege* w/s counsel* OR memo pre/p brief*)",
+		},
+		{
+			input:   "(attorn* OR counsel*",
+			wantErr: true,
+			errMsg:  "missing closing parenthesis",
+		},
+		{
+			input:   "attorn* AND",
+			wantErr: true,
+			errMsg:  "unexpected end of pattern",
+		},
+		{
+			input:   "attorn* OR counsel*) memo",
+			wantErr: true,
+			errMsg:  "unexpected \")\"",
+		},
+		{
+			input:   "NOT newsletter",
+			wantErr: true,
+			errMsg:  "needs a term that is not negated",
+		},
+		{
+			input:   "(attorn* OR counsel*) w/5 client*",
+			wantErr: true,
+			errMsg:  "proximity operands must be terms",
+		},
+	}
+	for _, tt := range tests {
+		expr, err := ParseExpression(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseExpression(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			if !strings.Contains(err.Error(), tt.errMsg) {
+				t.Errorf("ParseExpression(%q) error = %v, want %q", tt.input, err, tt.errMsg)
+			}
+			continue
+		}
+		if got := expr.String(); got != tt.want {
+			t.Errorf("ParseExpression(%q) = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestExpressionEval(t *testing.T) {
+	txt := `The counsel sent a memo to the client.
+Please do not forward this newsletter.
+The attorney reviewed the brief.
+`
+	tokens, err := Tokenizer(txt)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	tests := []struct {
+		input string
+		want  bool
+		spans []string
+	}{
+		{
+			input: "(attorn* OR counsel*) AND NOT newsletter*",
+			want:  false,
+		},
+		{
+			input: "(attorn* OR counsel*) AND NOT invoice",
+			want:  true,
+			spans: []string{"counsel", "attorney"},
+		},
+		{
+			input: "counsel* AND (memo OR brief*)",
+			want:  true,
+			spans: []string{"counsel", "memo", "brief."},
+		},
+		{
+			input: "counsel* AND (invoice OR receipt)",
+			want:  false,
+		},
+		{
+			input: "forward this newsletter* OR invoice",
+			want:  true,
+			spans: []string{"forward this newsletter."},
+		},
+		{
+			input: "(client* pre/3 counsel) OR (memo pre/3 counsel)",
+			want:  false,
+		},
+		{
+			input: "(client* w/3 memo) AND (brief* not w/3 counsel)",
+			want:  true,
+			spans: []string{"memo", "client.", "brief."},
+		},
+		{
+			input: "(counsel w/3 memo) AND NOT (attorney w/3 memo)",
+			want:  true,
+			spans: []string{"counsel", "memo"},
+		},
+	}
+	for _, tt := range tests {
+		expr, err := ParseExpression(tt.input)
+		if err != nil {
+			t.Errorf("ParseExpression(%q) unexpected error %s", tt.input, err)
+			continue
+		}
+		spans, got := expr.Eval(tokens)
+		if got != tt.want {
+			t.Errorf("%q Eval() = %t, want %t", tt.input, got, tt.want)
+			continue
+		}
+		values := []string{}
+		for _, span := range spans {
+			values = append(values, spanText(span))
+		}
+		if got && !equalStringSlices(values, tt.spans) {
+			t.Errorf("%q Eval() spans = %q, want %q", tt.input, values, tt.spans)
+		}
+	}
+}
+
+func TestParenthesisedPhrase(t *testing.T) {
+	// Without AND, OR or NOT the parentheses are part of the words
+	pattern, err := ParsePattern("(see attached) memo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pattern.Type != Phrase {
+		t.Errorf("expected a phrase pattern, got %v", pattern.Type)
+	}
+	matched, err := PhraseCheck("The letter (see attached) memo was sent.\n", []*Pattern{pattern}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := MatchedStrings(matched); got != `0,"(see attached) memo","(see attached) memo"` {
+		t.Errorf("expected the phrase to match, got %q", got)
+	}
+}
@@ -0,0 +1,452 @@
+package analysistools
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Extractor returns the plain text of a document, e.g. the paragraphs of
+// a word processing file, so it can be tokenized. The context is done when
+// the check is cancelled or the file's -file-timeout passes, an extractor
+// should then stop and return the context's error.
+type Extractor interface {
+	Extract(ctx context.Context, r io.ReaderAt, size int64) (io.Reader, error)
+}
+
+// ExtractorFunc adapts a function to the Extractor interface.
+type ExtractorFunc func(ctx context.Context, r io.ReaderAt, size int64) (io.Reader, error)
+
+// Extract calls f(ctx, r, size).
+func (f ExtractorFunc) Extract(ctx context.Context, r io.ReaderAt, size int64) (io.Reader, error) {
+	return f(ctx, r, size)
+}
+
+// ExtractorRegistry maps MIME types to the extractors for them. It is safe
+// to use from more than one goroutine.
+type ExtractorRegistry struct {
+	mu         sync.RWMutex
+	extractors map[string]Extractor
+}
+
+// DefaultExtractors is the registry the check actions use to extract the
+// text of the documents they check. It starts with the OOXML, ODF and PDF
+// extractors.
+var DefaultExtractors = NewExtractorRegistry()
+
+// NewExtractorRegistry returns a registry holding the built in extractors
+// for PDF and the OOXML (.docx, .xlsx, .pptx) and ODF (.odt, .ods, .odp)
+// types in the built in MIME types.
+func NewExtractorRegistry() *ExtractorRegistry {
+	r := &ExtractorRegistry{extractors: make(map[string]Extractor)}
+	r.extractors["application/pdf"] = ExtractorFunc(ExtractPDF)
+	for _, mimeType := range extensionToMIME {
+		switch {
+		case strings.Contains(mimeType, "openxmlformats-officedocument."):
+			r.extractors[mimeType] = ExtractorFunc(ExtractOOXML)
+		case strings.Contains(mimeType, "vnd.oasis.opendocument."):
+			r.extractors[mimeType] = ExtractorFunc(ExtractODF)
+		}
+	}
+	return r
+}
+
+// normalizeMimeType returns a MIME type in lower case without parameters.
+func normalizeMimeType(mimeType string) string {
+	mimeType, _, _ = strings.Cut(mimeType, ";")
+	return strings.ToLower(strings.TrimSpace(mimeType))
+}
+
+// Register sets the extractor for a MIME type replacing any existing one.
+// A nil extractor removes it, the files are then read as they are.
+func (r *ExtractorRegistry) Register(mimeType string, e Extractor) {
+	mimeType = normalizeMimeType(mimeType)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if e == nil {
+		delete(r.extractors, mimeType)
+		return
+	}
+	r.extractors[mimeType] = e
+}
+
+// Lookup returns the extractor for a MIME type, nil if there isn't one.
+func (r *ExtractorRegistry) Lookup(mimeType string) Extractor {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.extractors[normalizeMimeType(mimeType)]
+}
+
+// RegisterExtractor sets the extractor for a MIME type in
+// DefaultExtractors, e.g. to check a format the program doesn't know.
+func RegisterExtractor(mimeType string, e Extractor) {
+	DefaultExtractors.Register(mimeType, e)
+}
+
+// extractedText reads the text extracted from a document noting if it
+// has any, a scanned PDF without a text layer has none.
+type extractedText struct {
+	r       io.Reader
+	hasText bool
+}
+
+func (t *extractedText) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	if !t.hasText && len(bytes.TrimSpace(p[:n])) > 0 {
+		t.hasText = true
+	}
+	return n, err
+}
+
+// extractText returns the text of an open file. When the text was
+// extracted it is read through doc, otherwise doc is nil. The extractor
+// is found from the MIME type of the file's extension and, when there
+// isn't one for a type which isn't text, from the sniffed MIME type, e.g.
+// a .docx saved without its extension. Other files are read as they are.
+// When the context is done during the extraction an error wrapping
+// ErrPartialResults is returned.
+func extractText(ctx context.Context, in *os.File) (text io.Reader, doc *extractedText, err error) {
+	mimeType := mimeTypeOf(filepath.Ext(in.Name()))
+	if isTextType(mimeType) {
+		return in, nil, nil
+	}
+	info, err := in.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	extractor := DefaultExtractors.Lookup(mimeType)
+	if extractor == nil {
+		head := make([]byte, sniffLen)
+		n, err := in.ReadAt(head, 0)
+		if err != nil && err != io.EOF {
+			return nil, nil, err
+		}
+		extractor = DefaultExtractors.Lookup(sniffContent(in, info.Size(), head[:n]))
+	}
+	if extractor == nil {
+		return in, nil, nil
+	}
+	text, err = extractor.Extract(ctx, in, info.Size())
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, nil, partialResults(ctx.Err())
+		}
+		return nil, nil, fmt.Errorf("extracting text, %s", err)
+	}
+	doc = &extractedText{r: text}
+	return doc, doc, nil
+}
+
+// textBuffer collects the text of a document. Paragraphs are separated by
+// a blank line so the tokenizer counts them.
+type textBuffer struct {
+	bytes.Buffer
+}
+
+// endLine trims the spaces and tabs at the end of the line and starts a
+// new one.
+func (b *textBuffer) endLine() {
+	b.Truncate(len(bytes.TrimRight(b.Bytes(), " \t")))
+	b.WriteByte('\n')
+}
+
+// endParagraph ends the line and adds a blank line.
+func (b *textBuffer) endParagraph() {
+	b.endLine()
+	b.WriteByte('\n')
+}
+
+// attr returns the value of an element's attribute by its local name.
+func attr(se xml.StartElement, local string) string {
+	for _, a := range se.Attr {
+		if a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// zipPart returns the named file in a ZIP archive, nil if it is missing.
+func zipPart(zr *zip.Reader, name string) *zip.File {
+	for _, f := range zr.File {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// numberedParts returns the files in a directory of a ZIP archive named
+// prefix followed by a number, e.g. "slide1.xml", in numeric order.
+func numberedParts(zr *zip.Reader, dir string, prefix string) []*zip.File {
+	parts := []*zip.File{}
+	numbers := map[*zip.File]int{}
+	for _, f := range zr.File {
+		if path.Dir(f.Name) != dir {
+			continue
+		}
+		number, ok := strings.CutPrefix(strings.TrimSuffix(path.Base(f.Name), ".xml"), prefix)
+		if !ok {
+			continue
+		}
+		if n, err := strconv.Atoi(number); err == nil {
+			numbers[f] = n
+			parts = append(parts, f)
+		}
+	}
+	sort.Slice(parts, func(i, j int) bool { return numbers[parts[i]] < numbers[parts[j]] })
+	return parts
+}
+
+// readPart decodes an XML file in a ZIP archive calling fn for each token.
+// It stops with the context's error when the context is done.
+func readPart(ctx context.Context, f *zip.File, fn func(xml.Token) error) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	decoder := xml.NewDecoder(rc)
+	for n := 0; ; n++ {
+		// Checking every token would slow the extraction down
+		if n%1024 == 0 && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s, %s", f.Name, err)
+		}
+		if err := fn(token); err != nil {
+			return err
+		}
+	}
+}
+
+// ExtractOOXML returns the text of an Office Open XML document. A word
+// processing document's body is followed by its footnotes, endnotes and
+// comments, a presentation has its slides followed by their notes and a
+// spreadsheet has a line per row with the cells separated by tabs. The
+// text is held in memory.
+func ExtractOOXML(ctx context.Context, r io.ReaderAt, size int64) (io.Reader, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	text := new(textBuffer)
+	parts := []*zip.File{}
+	switch {
+	case zipPart(zr, "word/document.xml") != nil:
+		for _, name := range []string{"word/document.xml", "word/footnotes.xml", "word/endnotes.xml", "word/comments.xml"} {
+			if f := zipPart(zr, name); f != nil {
+				parts = append(parts, f)
+			}
+		}
+	case zipPart(zr, "ppt/presentation.xml") != nil:
+		parts = append(numberedParts(zr, "ppt/slides", "slide"), numberedParts(zr, "ppt/notesSlides", "notesSlide")...)
+	case zipPart(zr, "xl/workbook.xml") != nil:
+		if err := spreadsheetText(ctx, zr, text); err != nil {
+			return nil, err
+		}
+		return text, nil
+	default:
+		return nil, fmt.Errorf("not an OOXML document")
+	}
+	for _, f := range parts {
+		inText := false
+		err := readPart(ctx, f, func(token xml.Token) error {
+			switch t := token.(type) {
+			case xml.StartElement:
+				switch t.Name.Local {
+				case "t":
+					inText = true
+				case "tab":
+					text.WriteByte('\t')
+				case "br", "cr":
+					text.WriteByte('\n')
+				}
+			case xml.EndElement:
+				switch t.Name.Local {
+				case "t":
+					inText = false
+				case "p":
+					text.endParagraph()
+				}
+			case xml.CharData:
+				if inText {
+					text.Write(t)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return text, nil
+}
+
+// spreadsheetText writes the rows of each worksheet of an OOXML
+// spreadsheet, the sheets are separated by a blank line.
+func spreadsheetText(ctx context.Context, zr *zip.Reader, text *textBuffer) error {
+	shared := []string{}
+	if f := zipPart(zr, "xl/sharedStrings.xml"); f != nil {
+		var si strings.Builder
+		inText, inPhonetic := false, false
+		err := readPart(ctx, f, func(token xml.Token) error {
+			switch t := token.(type) {
+			case xml.StartElement:
+				switch t.Name.Local {
+				case "si":
+					si.Reset()
+				case "t":
+					inText = true
+				case "rPh":
+					inPhonetic = true
+				}
+			case xml.EndElement:
+				switch t.Name.Local {
+				case "si":
+					shared = append(shared, si.String())
+				case "t":
+					inText = false
+				case "rPh":
+					inPhonetic = false
+				}
+			case xml.CharData:
+				if inText && !inPhonetic {
+					si.Write(t)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for i, f := range numberedParts(zr, "xl/worksheets", "sheet") {
+		if i > 0 {
+			text.WriteByte('\n')
+		}
+		var (
+			cells    []string
+			cellType string
+			value    strings.Builder
+			inValue  bool
+		)
+		err := readPart(ctx, f, func(token xml.Token) error {
+			switch t := token.(type) {
+			case xml.StartElement:
+				switch t.Name.Local {
+				case "row":
+					cells = cells[:0]
+				case "c":
+					cellType = attr(t, "t")
+					value.Reset()
+				case "v", "t":
+					inValue = true
+				}
+			case xml.EndElement:
+				switch t.Name.Local {
+				case "v", "t":
+					inValue = false
+				case "c":
+					s := value.String()
+					if cellType == "s" {
+						if n, err := strconv.Atoi(s); err == nil && n >= 0 && n < len(shared) {
+							s = shared[n]
+						}
+					}
+					cells = append(cells, s)
+				case "row":
+					text.WriteString(strings.Join(cells, "\t"))
+					text.endLine()
+				}
+			case xml.CharData:
+				if inValue {
+					value.Write(t)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExtractODF returns the text of an OpenDocument file's content. Table
+// rows are a line with the cells separated by tabs. The text is held in
+// memory.
+func ExtractODF(ctx context.Context, r io.ReaderAt, size int64) (io.Reader, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	f := zipPart(zr, "content.xml")
+	if f == nil {
+		return nil, fmt.Errorf("not an OpenDocument file, content.xml is missing")
+	}
+	text := new(textBuffer)
+	inBody, cellDepth := false, 0
+	err = readPart(ctx, f, func(token xml.Token) error {
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "body":
+				inBody = true
+			case "table-cell":
+				cellDepth++
+			case "s":
+				n, err := strconv.Atoi(attr(t, "c"))
+				if err != nil || n < 1 {
+					n = 1
+				}
+				text.WriteString(strings.Repeat(" ", min(n, 80)))
+			case "tab":
+				text.WriteByte('\t')
+			case "line-break":
+				text.WriteByte('\n')
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "body":
+				inBody = false
+			case "p", "h":
+				if cellDepth > 0 {
+					text.WriteByte(' ')
+				} else {
+					text.endParagraph()
+				}
+			case "table-cell":
+				cellDepth--
+				text.Truncate(len(bytes.TrimRight(text.Bytes(), " ")))
+				text.WriteByte('\t')
+			case "table-row":
+				text.endLine()
+			}
+		case xml.CharData:
+			if inBody {
+				text.Write(t)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return text, nil
+}
@@ -0,0 +1,167 @@
+package analysistools
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// officeFile returns a ZIP file holding the parts in order, each a name
+// followed by its content.
+func officeFile(t *testing.T, parts ...string) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	for i := 0; i+1 < len(parts); i += 2 {
+		w, err := zw.Create(parts[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(parts[i+1]))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+const (
+	wordNS = `xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"`
+	odfNS  = `xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0" xmlns:text="urn:oasis:names:tc:opendocument:xmlns:text:1.0" xmlns:table="urn:oasis:names:tc:opendocument:xmlns:table:1.0"`
+)
+
+func TestExtractText(t *testing.T) {
+	docx := officeFile(t,
+		"[Content_Types].xml", `<Types/>`,
+		"word/document.xml", `<w:document `+wordNS+`><w:body>
+<w:p><w:r><w:t>The attorney</w:t></w:r><w:r><w:tab/><w:t xml:space="preserve"> client </w:t></w:r><w:r><w:t>privilege.</w:t></w:r></w:p>
+<w:p><w:r><w:instrText>PAGE</w:instrText><w:t>Second</w:t><w:br/><w:t>line</w:t></w:r></w:p>
+</w:body></w:document>`,
+		"word/footnotes.xml", `<w:footnotes `+wordNS+`><w:footnote><w:p><w:r><w:t>A footnote</w:t></w:r></w:p></w:footnote></w:footnotes>`,
+	)
+	xlsx := officeFile(t,
+		"[Content_Types].xml", `<Types/>`,
+		"xl/workbook.xml", `<workbook/>`,
+		"xl/sharedStrings.xml", `<sst><si><t>name</t></si><si><r><t>counsel</t></r><r><t>lor</t></r><rPh><t>x</t></rPh></si></sst>`,
+		"xl/worksheets/sheet10.xml", `<worksheet><sheetData><row><c t="inlineStr"><is><t>last sheet</t></is></c></row></sheetData></worksheet>`,
+		"xl/worksheets/sheet2.xml", `<worksheet><sheetData><row><c t="s"><v>0</v></c><c><v>42</v></c></row><row><c t="s"><v>1</v></c></row></sheetData></worksheet>`,
+	)
+	pptx := officeFile(t,
+		"[Content_Types].xml", `<Types/>`,
+		"ppt/presentation.xml", `<p:presentation/>`,
+		"ppt/slides/slide2.xml", `<p:sld><a:p><a:r><a:t>Slide two</a:t></a:r></a:p></p:sld>`,
+		"ppt/slides/slide1.xml", `<p:sld><a:p><a:r><a:t>Slide one</a:t></a:r></a:p></p:sld>`,
+		"ppt/notesSlides/notesSlide1.xml", `<p:notes><a:p><a:r><a:t>Speaker notes</a:t></a:r></a:p></p:notes>`,
+	)
+	odt := officeFile(t,
+		"mimetype", "application/vnd.oasis.opendocument.text",
+		"content.xml", `<office:document-content `+odfNS+`><office:automatic-styles>ignored</office:automatic-styles><office:body><office:text>
+<text:h>Memo</text:h><text:p>The<text:s text:c="2"/>attorney<text:tab/>client<text:line-break/>privilege</text:p>
+<table:table><table:table-row><table:table-cell><text:p>a</text:p></table:table-cell><table:table-cell><text:p>b</text:p><text:p>c</text:p></table:table-cell></table:table-row></table:table>
+</office:text></office:body></office:document-content>`,
+	)
+	tests := []struct {
+		name      string
+		extractor ExtractorFunc
+		src       []byte
+		expected  string
+	}{
+		{name: "docx", extractor: ExtractOOXML, src: docx, expected: "The attorney\t client privilege.\n\nSecond\nline\n\nA footnote\n\n"},
+		{name: "xlsx", extractor: ExtractOOXML, src: xlsx, expected: "name\t42\ncounsellor\n\nlast sheet\n"},
+		{name: "pptx", extractor: ExtractOOXML, src: pptx, expected: "Slide one\n\nSlide two\n\nSpeaker notes\n\n"},
+		{name: "odt", extractor: ExtractODF, src: odt, expected: "\nMemo\n\nThe  attorney\tclient\nprivilege\n\n\na\tb c\n\n"},
+	}
+	for _, test := range tests {
+		text, err := test.extractor.Extract(context.Background(), bytes.NewReader(test.src), int64(len(test.src)))
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		src, _ := io.ReadAll(text)
+		if string(src) != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.name, test.expected, src)
+		}
+	}
+	if _, err := ExtractODF(context.Background(), bytes.NewReader(docx), int64(len(docx))); err == nil {
+		t.Errorf("expected an error extracting a docx as ODF")
+	}
+
+	// The check actions extract the text before matching
+	dir := t.TempDir()
+	writeTree(t, dir, map[string][]byte{
+		"memo.docx":    docx,
+		"memo.odt":     odt,
+		"memo-docx":    docx,
+		"damaged.docx": []byte("PK\x03\x04 not really a docx"),
+		"notes.txt":    []byte("attorney notes\n"),
+	})
+	pattern, err := ParsePattern("attorney w/p privilege*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := new(bytes.Buffer)
+	if err := checkDirectory(context.Background(), out, dir, []*Pattern{pattern}, nil, &CheckOptions{Format: JSONLFormat}); err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var fName string
+		for _, name := range []string{"memo-docx", "memo.docx", "memo.odt"} {
+			if strings.Contains(line, filepath.Join(dir, name)) {
+				fName = name
+			}
+		}
+		got = append(got, fName)
+	}
+	if strings.Join(got, ",") != "memo-docx,memo.docx,memo.odt" {
+		t.Errorf("expected matches in the three documents, got\n%s", out.String())
+	}
+
+	// Library users can add their own
+	registry := NewExtractorRegistry()
+	if registry.Lookup("application/vnd.openxmlformats-officedocument.wordprocessingml.document") == nil {
+		t.Errorf("expected a docx extractor")
+	}
+	registry.Register("Application/RTF; charset=ascii", ExtractorFunc(func(ctx context.Context, r io.ReaderAt, size int64) (io.Reader, error) {
+		return strings.NewReader("extracted"), nil
+	}))
+	if registry.Lookup("application/rtf") == nil || DefaultExtractors.Lookup("application/rtf") != nil {
+		t.Errorf("expected the rtf extractor only in the new registry")
+	}
+	registry.Register("application/rtf", nil)
+	if registry.Lookup("application/rtf") != nil {
+		t.Errorf("expected the rtf extractor to be removed")
+	}
+
+	// The file timeout and cancellation stop an extraction
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ExtractOOXML(ctx, bytes.NewReader(docx), int64(len(docx))); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the extraction to be cancelled, got %v", err)
+	}
+	RegisterExtractor("application/rtf", ExtractorFunc(func(ctx context.Context, r io.ReaderAt, size int64) (io.Reader, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}))
+	defer RegisterExtractor("application/rtf", nil)
+	slow := filepath.Join(t.TempDir(), "slow.rtf")
+	if err := os.WriteFile(slow, []byte("{\\rtf1 attorney}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := checkDirectory(context.Background(), out, filepath.Dir(slow), []*Pattern{pattern}, nil, &CheckOptions{FileTimeout: 10 * time.Millisecond}); err != nil {
+		t.Errorf("expected the slow document to be skipped, got %v", err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := checkDirectory(ctx, out, filepath.Dir(slow), []*Pattern{pattern}, nil, &CheckOptions{}); !errors.Is(err, ErrPartialResults) {
+		t.Errorf("expected partial results when the run times out, got %v", err)
+	}
+}
@@ -1,13 +1,16 @@
 package analysistools
 
 import (
+	"context"
 	"fmt"
-    "io/fs"
-    "os"
+	"os"
 	"path/filepath"
-	"strings"
+	"sort"
+	"time"
 )
 
+// extensionToMIME holds the built in MIME types, see MimeRegistry for
+// adding more.
 var extensionToMIME = map[string]string{
     // Text and Code
     ".txt":      "text/plain",
@@ -73,6 +76,10 @@ var extensionToMIME = map[string]string{
     ".vsd":      "application/vnd.visio",
     ".msg":      "application/vnd.ms-outlook",
 
+    // Email
+    ".eml":      "message/rfc822",
+    ".mbox":     "application/mbox",
+
     // macOS and Apple
     ".pages":    "application/x-iwork-pages-sffpages",
     ".numbers":  "application/x-iwork-numbers-sffnumbers",
@@ -127,55 +134,105 @@ var extensionToMIME = map[string]string{
 	// Add more extensions and MIME types as needed
 }
 
+// FileTypes walks a directory returning a map of the files found to their
+// MIME type based on their extension. The exclude list entries use
+// gitignore syntax, see ExcludeList.
 func FileTypes(initialDir string, excludeList []string) (map[string]string, error) {
-    var lastErr error
+	return FileTypesContext(context.Background(), initialDir, excludeList)
+}
 
-    fileTypes := make(map[string]string)
+// FileTypesContext is FileTypes stopping when the context is done. The
+// files found up to then are returned along with an error wrapping
+// ErrPartialResults.
+func FileTypesContext(ctx context.Context, initialDir string, excludeList []string) (map[string]string, error) {
+	return FileTypesWithFilter(ctx, initialDir, excludeList, nil)
+}
 
-	err := filepath.WalkDir(initialDir, func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "skipping %+v: %s\n", d.Type(), err)
-            lastErr = err
-            return nil
-		}
+// FileTypesWithFilter is FileTypesContext only including the files which
+// pass the filter.
+func FileTypesWithFilter(ctx context.Context, initialDir string, excludeList []string, filter *FileFilter) (map[string]string, error) {
+	fileTypes := make(map[string]string)
+	err := walkFiles(ctx, initialDir, excludeList, filter, func(path string) error {
+		// Get MIME type from the map, default to "application/octet-stream"
+		fileTypes[path] = mimeTypeOf(filepath.Ext(path))
+		return nil
+	})
+	return fileTypes, err
+}
 
-		// Skip if it's a directory and in the exclude list
-		if d.IsDir() {
-			for _, exclude := range excludeList {
-				if strings.Contains(path, exclude) {
-					return filepath.SkipDir
-				}
-			}
-			return nil
-		}
+// ExtensionStats summarizes the files sharing an extension.
+type ExtensionStats struct {
+	// Extension is in lower case, e.g. ".pdf" for "brief.PDF"
+	Extension  string
+	MimeType   string
+	Count      int
+	TotalBytes int64
+	MinSize    int64
+	MaxSize    int64
+	// Oldest and Newest are the earliest and latest modification times
+	Oldest time.Time
+	Newest time.Time
+}
 
-		// Skip if the file is in the exclude list
-		for _, exclude := range excludeList {
-			if strings.Contains(path, exclude) {
-				return nil
-			}
-		}
+// AverageSize returns the average size of the files in bytes.
+func (stats *ExtensionStats) AverageSize() int64 {
+	if stats.Count == 0 {
+		return 0
+	}
+	return stats.TotalBytes / int64(stats.Count)
+}
 
-		// Get file extension
-		ext := strings.ToLower(filepath.Ext(path))
+// add includes a file in the summary.
+func (stats *ExtensionStats) add(info os.FileInfo) {
+	size, modified := info.Size(), info.ModTime()
+	if stats.Count == 0 || size < stats.MinSize {
+		stats.MinSize = size
+	}
+	if stats.Count == 0 || size > stats.MaxSize {
+		stats.MaxSize = size
+	}
+	if stats.Count == 0 || modified.Before(stats.Oldest) {
+		stats.Oldest = modified
+	}
+	if stats.Count == 0 || modified.After(stats.Newest) {
+		stats.Newest = modified
+	}
+	stats.Count++
+	stats.TotalBytes += size
+}
 
-		// Get MIME type from the map, default to "application/octet-stream"
-		mimeType, ok := extensionToMIME[ext]
+// ExtensionCounts walks a directory like FileTypesWithFilter and
+// summarizes the files found by extension. Extensions are compared
+// ignoring case. The summaries are sorted by extension.
+func ExtensionCounts(ctx context.Context, initialDir string, excludeList []string, filter *FileFilter) ([]*ExtensionStats, error) {
+	byExt := make(map[string]*ExtensionStats)
+	var lastErr error
+	err := walkFiles(ctx, initialDir, excludeList, filter, func(path string) error {
+		info, err := os.Stat(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "skipping %s: %s\n", path, err)
+			lastErr = err
+			return nil
+		}
+		ext := normalizeExt(filepath.Ext(path))
+		stats, ok := byExt[ext]
 		if !ok {
-			mimeType = "application/octet-stream"
+			stats = &ExtensionStats{Extension: ext}
+			if mimeType, ok := DefaultMimeRegistry.Lookup(ext); ok {
+				stats.MimeType = mimeType
+			}
+			byExt[ext] = stats
 		}
-
-		fileTypes[path] = mimeType
+		stats.add(info)
 		return nil
 	})
-    if lastErr != nil {
-        if err != nil {
-        	return fileTypes, fmt.Errorf("%s\n%s\n", lastErr, err)
-        }
-    	return fileTypes, lastErr
-    }
-    if err != nil {
-    	return fileTypes, err
-    }
-    return fileTypes, nil
+	counts := make([]*ExtensionStats, 0, len(byExt))
+	for _, stats := range byExt {
+		counts = append(counts, stats)
+	}
+	sort.Slice(counts, func(i, j int) bool { return counts[i].Extension < counts[j].Extension })
+	if err == nil {
+		err = lastErr
+	}
+	return counts, err
 }
@@ -0,0 +1,61 @@
+package analysistools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExtensionCounts(t *testing.T) {
+	dir := t.TempDir()
+	files := []struct {
+		name     string
+		size     int
+		modified string
+	}{
+		{name: "brief.pdf", size: 100, modified: "2019-03-01"},
+		{name: "box1/BRIEF.PDF", size: 300, modified: "2018-07-04"},
+		{name: "box1/exhibit.Pdf", size: 201, modified: "2020-01-31"},
+		{name: "memo.txt", size: 10, modified: "2019-05-05"},
+		{name: "README", size: 5, modified: "2019-05-05"},
+		{name: "box1/scan.tiff2", size: 0, modified: "2021-12-25"},
+	}
+	tree := map[string]string{}
+	for _, f := range files {
+		tree[f.name] = strings.Repeat("x", f.size)
+	}
+	writeTree(t, dir, tree)
+	for _, f := range files {
+		fName := filepath.Join(dir, filepath.FromSlash(f.name))
+		modified, err := ParseDate(f.modified)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(fName, modified, modified); err != nil {
+			t.Fatal(err)
+		}
+	}
+	counts, err := ExtensionCounts(context.Background(), dir, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, stats := range counts {
+		got = append(got, fmt.Sprintf("%q %q %d %d %d %d %d %s %s", stats.Extension, stats.MimeType, stats.Count,
+			stats.TotalBytes, stats.MinSize, stats.MaxSize, stats.AverageSize(),
+			stats.Oldest.Format(time.DateOnly), stats.Newest.Format(time.DateOnly)))
+	}
+	expected := []string{
+		`"" "" 1 5 5 5 5 2019-05-05 2019-05-05`,
+		`".pdf" "application/pdf" 3 601 100 300 200 2018-07-04 2020-01-31`,
+		`".tiff2" "" 1 0 0 0 0 2021-12-25 2021-12-25`,
+		`".txt" "text/plain" 1 10 10 10 10 2019-05-05 2019-05-05`,
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
@@ -0,0 +1,168 @@
+package analysistools
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FileFilter limits a directory walk to the files of interest. The zero
+// value includes every file.
+type FileFilter struct {
+	// MimeTypes lists the MIME types to include, e.g. "text/plain" or
+	// "text/*". The MIME type comes from the file extension.
+	MimeTypes []string
+	// Extensions lists the file extensions to include, e.g. ".txt".
+	Extensions []string
+	// MaxSize skips files larger than MaxSize bytes when more than zero.
+	MaxSize int64
+	// ModifiedAfter skips files modified before this time when set.
+	ModifiedAfter time.Time
+	// ModifiedBefore skips files modified at or after this time when set.
+	ModifiedBefore time.Time
+}
+
+// IsZero reports if the filter includes every file.
+func (f *FileFilter) IsZero() bool {
+	return f == nil || (len(f.MimeTypes) == 0 && len(f.Extensions) == 0 && f.MaxSize <= 0 &&
+		f.ModifiedAfter.IsZero() && f.ModifiedBefore.IsZero())
+}
+
+// Include reports if a file found by a walk passes the filter.
+func (f *FileFilter) Include(path string, d fs.DirEntry) (bool, error) {
+	if f.IsZero() {
+		return true, nil
+	}
+	ext := strings.ToLower(filepath.Ext(path))
+	if len(f.Extensions) > 0 && !containsFold(f.Extensions, ext) {
+		return false, nil
+	}
+	if len(f.MimeTypes) > 0 && !mimeTypeIncluded(f.MimeTypes, mimeTypeOf(ext)) {
+		return false, nil
+	}
+	if f.MaxSize <= 0 && f.ModifiedAfter.IsZero() && f.ModifiedBefore.IsZero() {
+		return true, nil
+	}
+	info, err := d.Info()
+	if err != nil {
+		return false, err
+	}
+	if f.MaxSize > 0 && info.Size() > f.MaxSize {
+		return false, nil
+	}
+	if !f.ModifiedAfter.IsZero() && info.ModTime().Before(f.ModifiedAfter) {
+		return false, nil
+	}
+	if !f.ModifiedBefore.IsZero() && !info.ModTime().Before(f.ModifiedBefore) {
+		return false, nil
+	}
+	return true, nil
+}
+
+// mimeTypeOf returns the MIME type for a file extension from the default
+// registry.
+func mimeTypeOf(ext string) string {
+	return DefaultMimeRegistry.TypeByExtension(ext)
+}
+
+// mimeTypeIncluded reports if a MIME type is in a list which may use a
+// wildcard subtype, e.g. "text/*".
+func mimeTypeIncluded(mimeTypes []string, mimeType string) bool {
+	for _, include := range mimeTypes {
+		include = strings.ToLower(strings.TrimSpace(include))
+		if include == mimeType || (strings.HasSuffix(include, "/*") && strings.HasPrefix(mimeType, strings.TrimSuffix(include, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsFold reports if a list holds a string ignoring case.
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(strings.TrimSpace(item), s) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseSize parses a size in bytes with an optional K, M, G or T suffix,
+// e.g. "500K" or "2G". The suffixes are powers of 1024.
+func ParseSize(size string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(size))
+	multiplier := int64(1)
+	for i, suffix := range []string{"K", "M", "G", "T"} {
+		if strings.HasSuffix(s, suffix) || strings.HasSuffix(s, suffix+"B") {
+			s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), suffix)
+			multiplier = int64(1) << (10 * (i + 1))
+			break
+		}
+	}
+	s = strings.TrimSuffix(s, "B")
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q, expected a number of bytes, e.g. 500K or 2G", size)
+	}
+	if n > math.MaxInt64/multiplier {
+		return 0, fmt.Errorf("invalid size %q, too large", size)
+	}
+	return n * multiplier, nil
+}
+
+// ParseDate parses a date as YYYY-MM-DD in local time or as an RFC 3339
+// timestamp.
+func ParseDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if t, err := time.ParseInLocation(time.DateOnly, s, time.Local); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return t, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", s)
+	}
+	return t, nil
+}
+
+// addFilterFlags adds the options setting a file filter to a flag set.
+func addFilterFlags(flagSet *flag.FlagSet, f *FileFilter) {
+	splitList := func(s string) []string {
+		list := []string{}
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		return list
+	}
+	flagSet.Func("include-mimetypes", "only include files with these comma separated MIME types, e.g. text/*", func(s string) error {
+		f.MimeTypes = append(f.MimeTypes, splitList(s)...)
+		return nil
+	})
+	flagSet.Func("include-ext", "only include files with these comma separated extensions, e.g. .txt,.md", func(s string) error {
+		for _, ext := range splitList(s) {
+			if !strings.HasPrefix(ext, ".") {
+				ext = "." + ext
+			}
+			f.Extensions = append(f.Extensions, ext)
+		}
+		return nil
+	})
+	flagSet.Func("max-size", "skip files larger than the size, e.g. 500K or 2G", func(s string) (err error) {
+		f.MaxSize, err = ParseSize(s)
+		return err
+	})
+	flagSet.Func("modified-after", "skip files modified before the date, YYYY-MM-DD", func(s string) (err error) {
+		f.ModifiedAfter, err = ParseDate(s)
+		return err
+	})
+	flagSet.Func("modified-before", "skip files modified on or after the date, YYYY-MM-DD", func(s string) (err error) {
+		f.ModifiedBefore, err = ParseDate(s)
+		return err
+	})
+}
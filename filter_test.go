@@ -0,0 +1,97 @@
+package analysistools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileFilter(t *testing.T) {
+	dir := t.TempDir()
+	files := []struct {
+		name     string
+		size     int
+		modified string
+	}{
+		{name: "memo.txt", size: 10, modified: "2019-03-01"},
+		{name: "notes.MD", size: 10, modified: "2019-11-30"},
+		{name: "brief.txt", size: 5000, modified: "2020-01-01"},
+		{name: "scan.png", size: 10, modified: "2019-06-01"},
+		{name: "setup.exe", size: 10, modified: "2018-12-31"},
+	}
+	tree := map[string]string{}
+	for _, f := range files {
+		tree[f.name] = strings.Repeat("x", f.size)
+	}
+	writeTree(t, dir, tree)
+	for _, f := range files {
+		fName := filepath.Join(dir, f.name)
+		modified, err := ParseDate(f.modified)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(fName, modified, modified.Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mustDate := func(s string) time.Time {
+		d, err := ParseDate(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	tests := []struct {
+		filter *FileFilter
+		want   string
+	}{
+		{filter: nil, want: "brief.txt memo.txt notes.MD scan.png setup.exe"},
+		{filter: &FileFilter{MimeTypes: []string{"text/*"}}, want: "brief.txt memo.txt notes.MD"},
+		{filter: &FileFilter{MimeTypes: []string{"image/png", "text/plain"}}, want: "brief.txt memo.txt scan.png"},
+		{filter: &FileFilter{Extensions: []string{".md", ".EXE"}}, want: "notes.MD setup.exe"},
+		{filter: &FileFilter{MaxSize: 1024}, want: "memo.txt notes.MD scan.png setup.exe"},
+		{filter: &FileFilter{ModifiedAfter: mustDate("2019-01-01"), ModifiedBefore: mustDate("2020-01-01")}, want: "memo.txt notes.MD scan.png"},
+		{filter: &FileFilter{MimeTypes: []string{"text/*"}, ModifiedAfter: mustDate("2019-06-01")}, want: "brief.txt notes.MD"},
+	}
+	for _, tt := range tests {
+		fileTypes, err := FileTypesWithFilter(context.Background(), dir, nil, tt.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []string{}
+		for fName := range fileTypes {
+			got = append(got, filepath.Base(fName))
+		}
+		sort.Strings(got)
+		if strings.Join(got, " ") != tt.want {
+			t.Errorf("%+v expected %q, got %q", tt.filter, tt.want, strings.Join(got, " "))
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := map[string]int64{
+		"100":      100,
+		"500K":     500 * 1024,
+		"2mb":      2 * 1024 * 1024,
+		"1G":       1 << 30,
+		"8388607T": 8388607 << 40,
+	}
+	for s, want := range tests {
+		if got, err := ParseSize(s); err != nil || got != want {
+			t.Errorf("ParseSize(%q) = %d, %v, want %d", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"", "big", "-1", "1.5G", "8388608T", "99999999999999999999"} {
+		if _, err := ParseSize(s); err == nil {
+			t.Errorf("ParseSize(%q) expected an error", s)
+		}
+	}
+	if _, err := ParseDate("2019-13-01"); err == nil {
+		t.Errorf("expected an error for an invalid date")
+	}
+}
@@ -39,20 +39,93 @@ check-directory [OPTION] PATTERN_FILE PATH [EXCLUDE_LIST_FILENAME]
 PATTERN_FILE contents. Report matches.
 Use '{app_name} check-directory help' to list available options for check.
 
+concordance [OPTION] PATTERN PATH [EXCLUDE_LIST_FILENAME]
+: Walk the PATH and report each match of PATTERN with the words before and after it.
+Use '{app_name} concordance help' to list available options for concordance.
+
 mimetypes PATH [EXCLUDE_LIST_FILENAME]
 : Walk the PATH directory and report file and it's likely mime type
 
 filetypes PATH [EXCLUDE_LIST_FILENAME]
 : Walk the PATH directory and aggregate counts by file extension and mime type
 
+inventory [OPTION] PATH [EXCLUDE_LIST_FILENAME]
+: Walk the PATH directory and record each file's size, modification time, mime
+type and checksums. Use -verify to compare a directory with a saved inventory.
+Use '{app_name} inventory help' to list available options for inventory.
+
+duplicates [OPTION] PATH [EXCLUDE_LIST_FILENAME]
+: Walk the PATH directory and group files which are exact or near duplicates of
+each other. Use '{app_name} duplicates help' to list available options for duplicates.
+
 tokens FILENAME [FILENAME ...]
-: tokenize a file and display the tokens in CSV format (name, token, word number, line number)
+: tokenize a file and display the tokens in CSV format (name, token, word number, line number,
+sentence number, paragraph number)
 
 PATTERN_FILE
 : This holds a list of patterns to match against, one pattern statement per line.
 
 EXCLUDE_LIST_FILENAME
-: This is a file contains a list (one entry per line) of path elements to be excluded from the walk.
+: This is a file contains a list (one entry per line) of files and directories
+to be excluded from the walk. It uses the same syntax as a .gitignore file. An
+entry without a "/", e.g. "law" or "*.bak", matches a name at any depth, an
+entry starting with "/" is relative to PATH, "**" matches any number of
+directories, a trailing "/" only matches directories and a leading "!"
+includes a file again. Lines starting with "#" are comments. For exclude lists
+written for older versions, an entry which starts with PATH, or an absolute
+path which exists outside of PATH, is still matched anywhere in the full path
+and a warning is printed.
+
+# PATTERNS
+
+Each line of a PATTERN_FILE holds one pattern. A term may start and/or end
+with an asterisk to match a suffix, prefix or the middle of a word.
+
+KEYWORD
+: A single term, e.g. "attorn*", matches every word it describes.
+
+KEYWORD w/N KEYWORD
+: A proximity pattern, e.g. "attorn* w/5 client*", matches when the second
+keyword is found within N words of the first, before or after it, N is 1 or
+more. Every pair of keywords found is reported.
+
+KEYWORD pre/N KEYWORD
+: An ordered proximity pattern, matches when the second keyword is found
+within N words after the first.
+
+KEYWORD w/s KEYWORD, KEYWORD w/p KEYWORD
+: A scoped proximity pattern, e.g. "privilege* w/s counsel*", matches when
+the second keyword is in the same sentence (w/s) or paragraph (w/p) as the
+first. Sentences end with ".", "!" or "?" and paragraphs are separated by a
+blank line. The pre/s and pre/p forms require the second keyword to follow
+the first. The keywords must also be within 10,000 words of each other, so
+a long run of text without a sentence break, e.g. a base64 blob, is not held
+in memory as one sentence.
+
+KEYWORD not w/N KEYWORD, KEYWORD not pre/N KEYWORD
+: An exclusion, e.g. "law not w/3 school", matches the first keyword when the
+second keyword is not found within N words.
+
+PHRASE
+: Any other run of terms, e.g. "attorney client privilege", matches the terms
+as consecutive words in the same order. The whole phrase is reported.
+
+BOOLEAN EXPRESSION
+: Keywords, phrases and proximity patterns can be combined with AND, OR, NOT
+and grouped with parentheses, e.g. "(attorn* OR counsel*) AND NOT newsletter"
+or "privilege* AND (memo OR brief*)". The operators must be in upper case.
+A pattern without them is not an expression, the parentheses in
+"(see attached) memo" are part of the words. NOT binds tightest then AND then OR. The expression is evaluated against the
+whole document and each matching term is reported. Up to 100,000 words
+matching the terms are held per file. An expression whose terms match more is
+not evaluated for that file, the file's other matches are reported followed by
+a row holding the error and the action exits with an error once the other
+files are checked.
+
+(?FLAGS)PATTERN
+: A pattern may start with flags controlling how its terms are compared,
+e.g. "(?i)deposition*" matches "Deposition" and "depositions". The flags are
+"i" ignore case, "d" fold diacritics, "c" NFC and "k" NFKC normalization.
 
 # EXAMPLE
 
@@ -79,11 +152,84 @@ MimeTypeHelp = `%{app_name}-mimetypes(1) user manual | version {version} {releas
 **{app_name} mimetypes** talks a directory and returns a list of files along with
 with the common mime types in CSV format. 
 
+The MIME type is based on the file extension. With the **-sniff** option the
+start of each file is read to identify its content as well, e.g. PDF, Word,
+Excel, PowerPoint (both the older OLE2 and the newer Open XML formats),
+OpenDocument, ZIP, mbox and email files. Two columns are added, "sniffed type"
+and "mismatch". The mismatch column is true when the extension and the content
+disagree, e.g. a PDF renamed "memo.doc". Files without a known extension are
+not flagged.
+
+With the **-pronom** or **-signature-file** options each file is identified
+by its PRONOM unique identifier (PUID), e.g. "fmt/276" for PDF 1.7, as used for
+digital preservation. The formats are identified by their byte signatures in the
+same way as DROID. Five columns are added, "puid", "format name", "format
+version", "basis" and "warning". The basis says how the format was identified,
+e.g. "extension match pdf; byte match at 0, 1 from EOF". The warning notes a
+weak identification, "extension mismatch", "match on extension only" or "no
+match". A file identified as more than one format has a row for each.
+
+A small set of signatures for common document, image, archive and text formats
+is bundled with {app_name}. For complete coverage download the DROID signature
+file from The National Archives and use **-signature-file**. Container
+signatures are not supported. A signature whose gaps would take too long to
+try against a file, more than four steps for each byte read, doesn't match it.
+
 # OPTIONS
 
 -h, -help, help
 : display this help page
 
+-format csv|json|jsonl
+: write the report as CSV, the default, a JSON array of objects or JSON Lines,
+one object per line. The JSON keys are the CSV column names with spaces
+replaced by underscores, e.g. "line_no", and missing values are null.
+
+-sniff
+: identify the MIME type from the file content and flag files where it
+disagrees with the extension
+
+-pronom
+: identify the PRONOM format of each file using the bundled signatures
+
+-signature-file FILENAME
+: identify the PRONOM format of each file using a DROID signature file, e.g.
+"DROID_SignatureFile_V120.xml"
+
+-timeout DURATION
+: stop after the duration, e.g. "30m" or "2h", and report the results found so
+far along with an error saying they are partial
+
+-mime-types FILENAME
+: load extension to MIME type mappings which add to or replace the built in
+ones. A file ending in ".json", ".yaml" or ".yml" holds an object mapping
+extensions to MIME types, e.g. {".eml": "message/rfc822"}. Other files use the
+mime.types format, a MIME type followed by its extensions on each line, e.g.
+"application/warc warc". The option can be repeated.
+
+-system-mime-types
+: load the system mime.types file, e.g. /etc/mime.types, before any
+-mime-types files
+
+-include-mimetypes LIST
+: only include files with the comma separated MIME types, e.g.
+"text/plain,application/pdf". A wildcard subtype such as "text/*" includes
+every type starting with "text/". The MIME type is based on the file extension.
+
+-include-ext LIST
+: only include files with the comma separated extensions, e.g. ".txt,.md"
+
+-max-size SIZE
+: skip files larger than SIZE bytes, a K, M or G suffix may be used, e.g. "500K"
+
+-modified-after DATE
+: skip files modified before DATE (YYYY-MM-DD)
+
+-modified-before DATE
+: skip files modified on or after DATE (YYYY-MM-DD). Together with
+-modified-after this selects a date range, e.g. "-modified-after 2019-01-01
+-modified-before 2020-01-01" includes the files modified in 2019.
+
 `
 
 TokensHelp = `%{app_name}-tokens(1) user manual | version {version} {release_hash}
@@ -101,13 +247,33 @@ TokensHelp = `%{app_name}-tokens(1) user manual | version {version} {release_has
 # DESCRIPTION
 
 **{app_name} tokens** parses a text file and turns it into a CSV list of
-tokens.
+tokens. If a normalization option is given the normalized form of each
+token is included as an additional column. The text of a document such as a
+.docx or .odt file is extracted first, as it is by the check action.
 
 # OPTIONS
 
 -h, -help, help
 : display this help page
 
+-format csv|json|jsonl
+: write the report as CSV, the default, a JSON array of objects or JSON Lines,
+one object per line. The JSON keys are the CSV column names with spaces
+replaced by underscores, e.g. "line_no", and missing values are null.
+
+-ignore-case, -i
+: show the tokens in lower case
+
+-fold-diacritics
+: show the tokens with accents and other diacritics removed
+
+-form NFC|NFKC
+: show the tokens with Unicode normalization form NFC or NFKC applied
+
+-punctuation
+: strip leading and trailing punctuation from the tokens, the word as found
+in the file is included as an additional "raw" column
+
 `
 
 FileTypeCountsHelp = `%{app_name}-filetypes(1) user manual | version {version} {release_hash}
@@ -130,11 +296,56 @@ file extension. Files which start with a "." will be considered an extension.
 Extensions are start with the last period in the path's basename and continue to the
 end of the file's basename.
 
+Extensions are compared ignoring case so "brief.PDF" and "memo.pdf" are both
+counted as ".pdf". Along with the count each row has the total bytes, the
+minimum, maximum and average file size in bytes and the oldest and newest
+modification dates of the files with the extension. The rows are sorted by
+extension.
+
 # OPTIONS
 
 -h, -help, help
 : display this help page
 
+-format csv|json|jsonl
+: write the report as CSV, the default, a JSON array of objects or JSON Lines,
+one object per line. The JSON keys are the CSV column names with spaces
+replaced by underscores, e.g. "line_no", and missing values are null.
+
+-timeout DURATION
+: stop after the duration, e.g. "30m" or "2h", and report the results found so
+far along with an error saying they are partial
+
+-mime-types FILENAME
+: load extension to MIME type mappings which add to or replace the built in
+ones. A file ending in ".json", ".yaml" or ".yml" holds an object mapping
+extensions to MIME types, e.g. {".eml": "message/rfc822"}. Other files use the
+mime.types format, a MIME type followed by its extensions on each line, e.g.
+"application/warc warc". The option can be repeated.
+
+-system-mime-types
+: load the system mime.types file, e.g. /etc/mime.types, before any
+-mime-types files
+
+-include-mimetypes LIST
+: only include files with the comma separated MIME types, e.g.
+"text/plain,application/pdf". A wildcard subtype such as "text/*" includes
+every type starting with "text/". The MIME type is based on the file extension.
+
+-include-ext LIST
+: only include files with the comma separated extensions, e.g. ".txt,.md"
+
+-max-size SIZE
+: skip files larger than SIZE bytes, a K, M or G suffix may be used, e.g. "500K"
+
+-modified-after DATE
+: skip files modified before DATE (YYYY-MM-DD)
+
+-modified-before DATE
+: skip files modified on or after DATE (YYYY-MM-DD). Together with
+-modified-after this selects a date range, e.g. "-modified-after 2019-01-01
+-modified-before 2020-01-01" includes the files modified in 2019.
+
 `
 
 CheckDirectoryHelp = `%{app_name}-check-directory(1) user manual | version {version} {release_hash}
@@ -156,20 +367,125 @@ PATTERN_FILE contents. Report matches. The report is returned after
 the directory walk is complete. The report is output to standard output
 in CSV format.
 
+Every file reached by the walk is checked. Use the include options to limit
+the files checked, e.g. "-include-mimetypes 'text/*'" to skip images and
+programs or "-modified-after" and "-modified-before" for an accession's
+date range.
+
+The text of PDF, Office Open XML (.docx, .xlsx, .pptx) and OpenDocument
+(.odt, .ods, .odp) files is extracted before it is checked, a file whose
+extension isn't known is identified by its content. Paragraphs are separated
+by a blank line and a spreadsheet row is a line with the cells separated by
+tabs, the line numbers count the lines of the extracted text. The pages of a
+PDF are separated by a form feed. A document whose text can't be extracted,
+e.g. a damaged one, is noted on standard error and skipped. A document
+without any text, such as a scanned PDF needing OCR or an encrypted PDF, is
+noted on standard error or listed in the -no-text report.
+
+The CSV columns are filename, line no, page no, pattern, phrase, word no,
+column, end column, start offset, end offset, keyword 2, keyword 2 line no,
+distance and error. Line, word and column numbers count from zero, pages count
+from one as a PDF viewer does, columns count characters and offsets count bytes
+from the start of the file. The end column
+and end offset are just past the matched text. Each pair of keywords found by
+a proximity pattern is reported, the phrase holds the first keyword and the
+keyword 2 columns where the second keyword was found along with the distance
+between them in words. The error is only set on a row noting a file whose
+check couldn't be completed, e.g. a boolean expression matching too many words.
+
 PATTERN_FILE
 : This holds a list of patterns to match against, one pattern statement per line.
 
 EXCLUDE_LIST_FILENAME
-: This is a file contains a list (one entry per line) of path elements to be excluded from the walk.
+: This is a file contains a list (one entry per line) of files and directories
+to be excluded from the walk. It uses the same syntax as a .gitignore file. An
+entry without a "/", e.g. "law" or "*.bak", matches a name at any depth, an
+entry starting with "/" is relative to PATH, "**" matches any number of
+directories, a trailing "/" only matches directories and a leading "!"
+includes a file again. Lines starting with "#" are comments. For exclude lists
+written for older versions, an entry which starts with PATH, or an absolute
+path which exists outside of PATH, is still matched anywhere in the full path
+and a warning is printed.
 
 # OPTIONS
 
 -h, -help, help
 : display this help page
 
+-format csv|json|jsonl
+: write the report as CSV, the default, a JSON array of objects or JSON Lines,
+one object per line. The JSON keys are the CSV column names with spaces
+replaced by underscores, e.g. "line_no", and missing values are null.
+
 -match-one, -1
 : stop at first match
 
+-stream-order
+: report each file's matches in the order they are found in the text rather
+than grouped by pattern. With -match-one only the first match found is
+reported.
+
+-context N
+: include a "context" column holding N words before and after each match
+with the match marked by "[[" and "]]"
+
+-ignore-case, -i
+: compare words without regard to case
+
+-fold-diacritics
+: compare words with accents and other diacritics removed, e.g. "café" matches "cafe"
+
+-form NFC|NFKC
+: apply Unicode normalization form NFC or NFKC before comparing words
+
+-punctuation
+: strip leading and trailing punctuation from words before comparing them,
+e.g. "(counsel)," matches "counsel". Hyphens, apostrophes and email addresses
+inside a word are kept. The matches report the words as found in the file.
+
+-workers N
+: check N files at once, the default is 1. The report lists the files in the
+same order as checking them one at a time.
+
+-timeout DURATION
+: stop after the duration, e.g. "30m" or "2h", and report the results found so
+far along with an error saying they are partial
+
+-file-timeout DURATION
+: stop checking a file after the duration, e.g. "30s", including the time spent
+extracting the text of a document. The matches found so far are reported, the
+file is noted on standard error and the next file is checked.
+
+-db FILENAME
+: record the results in the SQLite database FILENAME instead of writing CSV.
+The database is created if needed and each run is added under a new run ID
+with the files checked, their size, MIME type and SHA-256 digest, the patterns
+and the matches. The run ID is noted on standard error. See
+results_database.md for the tables.
+
+-no-text FILENAME
+: list the documents without extractable text in FILENAME, in the -format
+chosen, with the columns filename, mime type and size instead of noting them
+on standard error
+
+-include-mimetypes LIST
+: only include files with the comma separated MIME types, e.g.
+"text/plain,application/pdf". A wildcard subtype such as "text/*" includes
+every type starting with "text/". The MIME type is based on the file extension.
+
+-include-ext LIST
+: only include files with the comma separated extensions, e.g. ".txt,.md"
+
+-max-size SIZE
+: skip files larger than SIZE bytes, a K, M or G suffix may be used, e.g. "500K"
+
+-modified-after DATE
+: skip files modified before DATE (YYYY-MM-DD)
+
+-modified-before DATE
+: skip files modified on or after DATE (YYYY-MM-DD). Together with
+-modified-after this selects a date range, e.g. "-modified-after 2019-01-01
+-modified-before 2020-01-01" includes the files modified in 2019.
 
 `
 
@@ -191,11 +507,40 @@ Report the matches found based on PATTERN_FILE in the FILE_TO_CHECK. If more tha
 one file is included they will be checked consecutively and included in the CSV
 output.
 
+The text of PDF, Office Open XML (.docx, .xlsx, .pptx) and OpenDocument
+(.odt, .ods, .odp) files is extracted before it is checked, a file whose
+extension isn't known is identified by its content. Paragraphs are separated
+by a blank line and a spreadsheet row is a line with the cells separated by
+tabs, the line numbers count the lines of the extracted text. The pages of a
+PDF are separated by a form feed. A document whose text can't be extracted,
+e.g. a damaged one, is noted on standard error and skipped. A document
+without any text, such as a scanned PDF needing OCR or an encrypted PDF, is
+noted on standard error or listed in the -no-text report.
+
+The CSV columns are filename, line no, page no, pattern, phrase, word no,
+column, end column, start offset, end offset, keyword 2, keyword 2 line no,
+distance and error. Line, word and column numbers count from zero, pages count
+from one as a PDF viewer does, columns count characters and offsets count bytes
+from the start of the file. The end column
+and end offset are just past the matched text. Each pair of keywords found by
+a proximity pattern is reported, the phrase holds the first keyword and the
+keyword 2 columns where the second keyword was found along with the distance
+between them in words. The error is only set on a row noting a file whose
+check couldn't be completed, e.g. a boolean expression matching too many words.
+
 PATTERN_FILE
 : This holds a list of patterns to match against, one pattern statement per line.
 
 EXCLUDE_LIST_FILENAME
-: This is a file contains a list (one entry per line) of path elements to be excluded from the walk.
+: This is a file contains a list (one entry per line) of files and directories
+to be excluded from the walk. It uses the same syntax as a .gitignore file. An
+entry without a "/", e.g. "law" or "*.bak", matches a name at any depth, an
+entry starting with "/" is relative to PATH, "**" matches any number of
+directories, a trailing "/" only matches directories and a leading "!"
+includes a file again. Lines starting with "#" are comments. For exclude lists
+written for older versions, an entry which starts with PATH, or an absolute
+path which exists outside of PATH, is still matched anywhere in the full path
+and a warning is printed.
 
 
 # OPTIONS
@@ -203,10 +548,301 @@ EXCLUDE_LIST_FILENAME
 -h, -help, help
 : display this help page
 
+-format csv|json|jsonl
+: write the report as CSV, the default, a JSON array of objects or JSON Lines,
+one object per line. The JSON keys are the CSV column names with spaces
+replaced by underscores, e.g. "line_no", and missing values are null.
+
 -match-one, -1
 : stop at first match
 
+-stream-order
+: report each file's matches in the order they are found in the text rather
+than grouped by pattern. With -match-one only the first match found is
+reported.
+
+-context N
+: include a "context" column holding N words before and after each match
+with the match marked by "[[" and "]]"
+
+-ignore-case, -i
+: compare words without regard to case
+
+-fold-diacritics
+: compare words with accents and other diacritics removed, e.g. "café" matches "cafe"
+
+-form NFC|NFKC
+: apply Unicode normalization form NFC or NFKC before comparing words
+
+-punctuation
+: strip leading and trailing punctuation from words before comparing them,
+e.g. "(counsel)," matches "counsel". Hyphens, apostrophes and email addresses
+inside a word are kept. The matches report the words as found in the file.
+
+-timeout DURATION
+: stop after the duration, e.g. "30m" or "2h", and report the results found so
+far along with an error saying they are partial
+
+-file-timeout DURATION
+: stop checking a file after the duration, e.g. "30s", including the time spent
+extracting the text of a document. The matches found so far are reported, the
+file is noted on standard error and the next file is checked.
+
+-db FILENAME
+: record the results in the SQLite database FILENAME instead of writing CSV.
+The database is created if needed and each run is added under a new run ID
+with the files checked, their size, MIME type and SHA-256 digest, the patterns
+and the matches. The run ID is noted on standard error. See
+results_database.md for the tables.
+
+-no-text FILENAME
+: list the documents without extractable text in FILENAME, in the -format
+chosen, with the columns filename, mime type and size instead of noting them
+on standard error
+
+`
+
+ConcordanceHelp = `%{app_name}-concordance(1) user manual | version {version} {release_hash}
+% R. S. Doiel
+% {release_date}
+
+# NAME
+
+{app_name} concordance
+
+# SYNOPSIS
+
+{app_name} concordance [OPTIONS] PATTERN PATH [EXCLUDE_LIST_FILENAME]
+
+# DESCRIPTION
+
+Walk the PATH, a directory or a single file, and report each match of PATTERN
+as a keyword in context (KWIC) line. PATTERN is a single pattern statement as
+it would be written in a PATTERN_FILE, e.g. "attorn* w/5 client*". The report
+is output to standard output in CSV format with the columns filename, line no,
+before, match and after. The text of a document such as a .docx or .odt file
+is extracted first, as it is by the check action.
+
+EXCLUDE_LIST_FILENAME
+: This is a file contains a list (one entry per line) of files and directories
+to be excluded from the walk. It uses the same syntax as a .gitignore file. An
+entry without a "/", e.g. "law" or "*.bak", matches a name at any depth, an
+entry starting with "/" is relative to PATH, "**" matches any number of
+directories, a trailing "/" only matches directories and a leading "!"
+includes a file again. Lines starting with "#" are comments. For exclude lists
+written for older versions, an entry which starts with PATH, or an absolute
+path which exists outside of PATH, is still matched anywhere in the full path
+and a warning is printed.
+
+# OPTIONS
+
+-h, -help, help
+: display this help page
+
+-format csv|json|jsonl
+: write the report as CSV, the default, a JSON array of objects or JSON Lines,
+one object per line. The JSON keys are the CSV column names with spaces
+replaced by underscores, e.g. "line_no", and missing values are null.
+
+-width N
+: the number of words before and after each match, defaults to 5
+
+-ignore-case, -i
+: compare words without regard to case
+
+-fold-diacritics
+: compare words with accents and other diacritics removed
+
+-form NFC|NFKC
+: apply Unicode normalization form NFC or NFKC before comparing words
+
+-punctuation
+: strip leading and trailing punctuation from words before comparing them
+
+# EXAMPLE
+
+~~~shell
+{app_name} concordance -width 8 "privilege* w/s counsel*" /archive/accession_42
+~~~
+
+-timeout DURATION
+: stop after the duration, e.g. "30m" or "2h", and report the results found so
+far along with an error saying they are partial
+
+-file-timeout DURATION
+: stop checking a file after the duration, e.g. "30s", including the time spent
+extracting the text of a document. The matches found so far are reported, the
+file is noted on standard error and the next file is checked.
+
+`
+
+InventoryHelp = `%{app_name}-inventory(1) user manual | version {version} {release_hash}
+% R. S. Doiel
+% {release_date}
+
+# NAME
+
+{app_name} inventory
+
+# SYNOPSIS
+
+{app_name} inventory [OPTIONS] PATH [EXCLUDE_LIST_FILENAME]
+
+# DESCRIPTION
+
+**{app_name} inventory** walks the PATH and records the fixity of each file in
+CSV format. The columns are the path relative to PATH, the size in bytes, the
+modification time, the MIME type and a column for each digest. The files are
+hashed in parallel but are listed in the order of the walk.
+
+With the **-verify** option the PATH is compared with a saved inventory using
+the digests recorded in it. Each file added, removed or changed is listed in
+CSV format with its status and, for a changed file, what changed. A file whose
+modification time changed but not its size or digests is not listed. If any
+differences are found an error is returned after the list so scripts can check
+the exit status.
+
+# OPTIONS
+
+-h, -help, help
+: display this help page
+
+-format csv|json|jsonl
+: write the inventory, or the differences found by -verify, as CSV, the
+default, a JSON array of objects or JSON Lines, one object per line. The JSON
+keys are the CSV column names with spaces replaced by underscores. Only a CSV
+inventory can be verified.
+
+-digests LIST
+: the comma separated digests to record, "md5", "sha1", "sha256" or "sha512",
+the default is "sha256", e.g. "-digests md5,sha256"
+
+-workers N
+: hash N files at once, the default is the number of CPUs
+
+-verify INVENTORY_FILENAME
+: compare the PATH with an inventory saved by an earlier run
+
+-timeout DURATION
+: stop after the duration, e.g. "30m" or "2h", and report the results found so
+far along with an error saying they are partial
+
+-mime-types FILENAME
+: load extension to MIME type mappings, see '{app_name} mimetypes help'
+
+-system-mime-types
+: load the system mime.types file, e.g. /etc/mime.types
+
+-include-mimetypes LIST
+: only include files with the comma separated MIME types, e.g.
+"text/plain,application/pdf" or "text/*"
+
+-include-ext LIST
+: only include files with the comma separated extensions, e.g. ".txt,.md"
+
+-max-size SIZE
+: skip files larger than SIZE bytes, a K, M or G suffix may be used, e.g. "500K"
+
+-modified-after DATE
+: skip files modified before DATE (YYYY-MM-DD)
+
+-modified-before DATE
+: skip files modified on or after DATE (YYYY-MM-DD)
+
+# EXAMPLES
+
+Record an inventory on accession then verify it later.
+
+~~~
+{app_name} inventory -digests md5,sha256 accession-2026-01 > accession-2026-01.csv
+{app_name} inventory -verify accession-2026-01.csv accession-2026-01
+~~~
 
 `
 
-)
\ No newline at end of file
+DuplicatesHelp = `%{app_name}-duplicates(1) user manual | version {version} {release_hash}
+% R. S. Doiel
+% {release_date}
+
+# NAME
+
+{app_name} duplicates
+
+# SYNOPSIS
+
+{app_name} duplicates [OPTIONS] PATH [EXCLUDE_LIST_FILENAME]
+
+# DESCRIPTION
+
+**{app_name} duplicates** walks the PATH and groups the copies of each file.
+Files with the same content, the same SHA-256 digest, are exact duplicates.
+Text files, including email, whose words are nearly the same are
+near-duplicates. The text of a document such as a .docx or PDF file is
+extracted first, as it is by the check action, so a document and a text copy
+of it are near-duplicates. Words are compared ignoring case and punctuation in
+overlapping runs, shingles, of five words. The similarity of two files is
+estimated from MinHash signatures of their shingles, 1 means the same words
+in the same order.
+
+Every file is listed in CSV format with its group number. A file without
+copies is in a group of its own. The first file found in each group is its
+representative, the others are marked as an "exact" or "near" match along with
+their similarity to the representative. A near-duplicate's similarity to its
+representative is at or above the threshold, a file similar only to another
+near-duplicate starts a group of its own. The groups are listed in the order
+of the walk.
+
+The file paths are the same as those reported by check-directory for the same
+PATH so its results can be joined with the groups, e.g. to review one
+representative per group.
+
+# OPTIONS
+
+-h, -help, help
+: display this help page
+
+-format csv|json|jsonl
+: write the report as CSV, the default, a JSON array of objects or JSON Lines,
+one object per line. The JSON keys are the CSV column names with spaces
+replaced by underscores, e.g. "line_no", and missing values are null.
+
+-threshold NUMBER
+: the similarity from 0 to 1 at or above which text files are near-duplicates,
+the default is 0.8. Use 0 to only find exact duplicates.
+
+-shingle-size N
+: the number of words in each shingle, the default is 5. Smaller shingles
+find files sharing more of their words, larger ones files sharing more of their
+phrasing.
+
+-workers N
+: read N files at once, the default is the number of CPUs
+
+-timeout DURATION
+: stop after the duration, e.g. "30m" or "2h", and report the results found so
+far along with an error saying they are partial
+
+-mime-types FILENAME
+: load extension to MIME type mappings, see '{app_name} mimetypes help'
+
+-system-mime-types
+: load the system mime.types file, e.g. /etc/mime.types
+
+-include-mimetypes LIST
+: only include files with the comma separated MIME types, e.g.
+"text/plain,application/pdf" or "text/*"
+
+-include-ext LIST
+: only include files with the comma separated extensions, e.g. ".txt,.md"
+
+-max-size SIZE
+: skip files larger than SIZE bytes, a K, M or G suffix may be used, e.g. "500K"
+
+-modified-after DATE
+: skip files modified before DATE (YYYY-MM-DD)
+
+-modified-before DATE
+: skip files modified on or after DATE (YYYY-MM-DD)
+
+`
+)
@@ -0,0 +1,303 @@
+package analysistools
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DigestAlgorithms are the digests an inventory can record.
+var DigestAlgorithms = []string{"md5", "sha1", "sha256", "sha512"}
+
+// newDigest returns the hash for a digest algorithm.
+func newDigest(algorithm string) (hash.Hash, error) {
+	switch algorithm {
+	case "md5":
+		return md5.New(), nil
+	case "sha1":
+		return sha1.New(), nil
+	case "sha256":
+		return sha256.New(), nil
+	case "sha512":
+		return sha512.New(), nil
+	}
+	return nil, fmt.Errorf("unknown digest %q, expected one of %s", algorithm, strings.Join(DigestAlgorithms, ", "))
+}
+
+// ParseDigests parses a comma separated list of digest algorithms, e.g.
+// "md5,sha256". "SHA-256" is the same as "sha256".
+func ParseDigests(s string) ([]string, error) {
+	algorithms := []string{}
+	for _, algorithm := range strings.Split(s, ",") {
+		algorithm = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(algorithm), "-", ""))
+		if algorithm == "" {
+			continue
+		}
+		if _, err := newDigest(algorithm); err != nil {
+			return nil, err
+		}
+		algorithms = append(algorithms, algorithm)
+	}
+	if len(algorithms) == 0 {
+		return nil, fmt.Errorf("expected at least one digest, e.g. sha256")
+	}
+	return algorithms, nil
+}
+
+// InventoryOptions holds the settings for taking an inventory.
+type InventoryOptions struct {
+	// Algorithms are the digests to record, see DigestAlgorithms
+	Algorithms []string
+	// Workers is the number of files hashed at once
+	Workers int
+	// Filter limits the files included, nil includes every file
+	Filter *FileFilter
+	// Format selects the format WriteInventory writes, CSV when empty.
+	// ReadInventory only reads CSV.
+	Format OutputFormat
+}
+
+// InventoryEntry records the fixity of a file.
+type InventoryEntry struct {
+	// Path is relative to the directory walked and uses "/" as the
+	// separator
+	Path     string
+	Size     int64
+	Modified time.Time
+	MimeType string
+	// Digests maps each algorithm to the hex encoded digest
+	Digests map[string]string
+}
+
+// ctxReader is a reader which stops once its context is done.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// hashFile fills in an entry's size, modification time and digests.
+func hashFile(ctx context.Context, fName string, entry *InventoryEntry, algorithms []string) error {
+	in, err := os.Open(fName)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	hashes := make([]hash.Hash, len(algorithms))
+	writers := make([]io.Writer, len(algorithms))
+	for i, algorithm := range algorithms {
+		if hashes[i], err = newDigest(algorithm); err != nil {
+			return err
+		}
+		writers[i] = hashes[i]
+	}
+	size, err := io.Copy(io.MultiWriter(writers...), &ctxReader{ctx: ctx, r: in})
+	if err != nil {
+		return err
+	}
+	entry.Size, entry.Modified = size, info.ModTime()
+	entry.Digests = make(map[string]string, len(algorithms))
+	for i, algorithm := range algorithms {
+		entry.Digests[algorithm] = hex.EncodeToString(hashes[i].Sum(nil))
+	}
+	return nil
+}
+
+// Inventory walks a directory hashing each file found and calls emit with
+// the entries in the order of the walk. Files are hashed by a pool of
+// workers, see walkFilesParallel. Files which can't be read are reported
+// and skipped. If the context is done the entries emitted up to then
+// stand and an error wrapping ErrPartialResults is returned.
+func Inventory(ctx context.Context, startDir string, excludeList []string, options *InventoryOptions, emit func(*InventoryEntry) error) error {
+	algorithms := options.Algorithms
+	if len(algorithms) == 0 {
+		algorithms = []string{"sha256"}
+	}
+	for _, algorithm := range algorithms {
+		if _, err := newDigest(algorithm); err != nil {
+			return err
+		}
+	}
+	var lastErr error
+	err := walkFilesParallel(ctx, startDir, excludeList, options.Filter, options.Workers, func(path string) (func() error, error) {
+		rel, err := filepath.Rel(startDir, path)
+		if err != nil {
+			return nil, err
+		}
+		entry := &InventoryEntry{
+			Path:     filepath.ToSlash(rel),
+			MimeType: mimeTypeOf(filepath.Ext(path)),
+		}
+		if err := hashFile(ctx, path, entry, algorithms); err != nil {
+			if ctx.Err() != nil {
+				return nil, partialResults(ctx.Err())
+			}
+			return func() error {
+				fmt.Fprintf(os.Stderr, "skipping %s: %s\n", entry.Path, err)
+				lastErr = err
+				return nil
+			}, nil
+		}
+		return func() error {
+			return emit(entry)
+		}, nil
+	})
+	if err == nil {
+		err = lastErr
+	}
+	return err
+}
+
+// inventoryHeader returns the CSV header of an inventory.
+func inventoryHeader(algorithms []string) []string {
+	return append([]string{"path", "size", "modified", "mime type"}, algorithms...)
+}
+
+// WriteInventory walks a directory writing an inventory in CSV format, or
+// options.Format. The columns are the path, size in bytes, modification
+// time, MIME type and a column for each digest.
+func WriteInventory(ctx context.Context, out io.Writer, startDir string, excludeList []string, options *InventoryOptions) error {
+	algorithms := options.Algorithms
+	if len(algorithms) == 0 {
+		algorithms = []string{"sha256"}
+	}
+	w, err := NewRecordWriter(out, options.Format, inventoryHeader(algorithms))
+	if err != nil {
+		return err
+	}
+	err = Inventory(ctx, startDir, excludeList, options, func(entry *InventoryEntry) error {
+		row := []any{entry.Path, entry.Size, entry.Modified.Format(time.RFC3339Nano), entry.MimeType}
+		for _, algorithm := range algorithms {
+			row = append(row, entry.Digests[algorithm])
+		}
+		return w.Write(row...)
+	})
+	return closeRecords(w, err)
+}
+
+// ReadInventory reads an inventory written by WriteInventory returning its
+// entries and the digest algorithms it holds.
+func ReadInventory(in io.Reader) ([]*InventoryEntry, []string, error) {
+	r := csv.NewReader(in)
+	header, err := r.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("inventory has no header, %s", err)
+	}
+	if len(header) < 5 || strings.Join(header[:4], ",") != strings.Join(inventoryHeader(nil), ",") {
+		return nil, nil, fmt.Errorf("expected an inventory header, got %q", strings.Join(header, ","))
+	}
+	algorithms := header[4:]
+	for _, algorithm := range algorithms {
+		if _, err := newDigest(algorithm); err != nil {
+			return nil, nil, err
+		}
+	}
+	entries := []*InventoryEntry{}
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		line, _ := r.FieldPos(0)
+		size, err := strconv.ParseInt(row[1], 10, 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d, bad size %q", line, row[1])
+		}
+		modified, err := time.Parse(time.RFC3339Nano, row[2])
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d, bad modified time %q", line, row[2])
+		}
+		entry := &InventoryEntry{Path: row[0], Size: size, Modified: modified, MimeType: row[3], Digests: map[string]string{}}
+		for i, algorithm := range algorithms {
+			entry.Digests[algorithm] = strings.ToLower(row[4+i])
+		}
+		entries = append(entries, entry)
+	}
+	return entries, algorithms, nil
+}
+
+// InventoryChange is a difference between a directory and its inventory.
+type InventoryChange struct {
+	// Status is "added", "removed" or "changed"
+	Status string
+	Path   string
+	// Detail says what changed, e.g. "size 120 was 100; sha256 differs"
+	Detail string
+}
+
+// VerifyInventory walks a directory comparing it with a saved inventory.
+// The options' algorithms should be those of the inventory, see
+// ReadInventory. Files with a different size or digest are changed, a
+// change to only the modification time is not reported. The changes are in
+// the order of the walk followed by the removed files in the order of the
+// inventory.
+func VerifyInventory(ctx context.Context, startDir string, excludeList []string, saved []*InventoryEntry, options *InventoryOptions) ([]*InventoryChange, error) {
+	byPath := make(map[string]*InventoryEntry, len(saved))
+	for _, entry := range saved {
+		byPath[entry.Path] = entry
+	}
+	found := make(map[string]bool, len(saved))
+	changes := []*InventoryChange{}
+	err := Inventory(ctx, startDir, excludeList, options, func(entry *InventoryEntry) error {
+		found[entry.Path] = true
+		was, ok := byPath[entry.Path]
+		if !ok {
+			changes = append(changes, &InventoryChange{Status: "added", Path: entry.Path})
+			return nil
+		}
+		details := []string{}
+		if entry.Size != was.Size {
+			details = append(details, fmt.Sprintf("size %d was %d", entry.Size, was.Size))
+		}
+		for _, algorithm := range options.Algorithms {
+			if entry.Digests[algorithm] != was.Digests[algorithm] {
+				details = append(details, algorithm+" differs")
+			}
+		}
+		if len(details) > 0 {
+			changes = append(changes, &InventoryChange{Status: "changed", Path: entry.Path, Detail: strings.Join(details, "; ")})
+		}
+		return nil
+	})
+	if errors.Is(err, ErrPartialResults) {
+		// Files not reached yet aren't removed
+		return changes, err
+	}
+	for _, entry := range saved {
+		if found[entry.Path] {
+			continue
+		}
+		// A file which couldn't be read isn't removed
+		if _, statErr := os.Stat(filepath.Join(startDir, filepath.FromSlash(entry.Path))); statErr == nil {
+			continue
+		}
+		changes = append(changes, &InventoryChange{Status: "removed", Path: entry.Path})
+	}
+	return changes, err
+}
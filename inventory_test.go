@@ -0,0 +1,132 @@
+package analysistools
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInventory(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"memo.txt":          "hello\n",
+		"box1/brief.pdf":    "%PDF-1.4\n",
+		"box1/exhibit.txt":  "",
+		"box1/letter,1.txt": "a comma in the name\n",
+	})
+	options := &InventoryOptions{Algorithms: []string{"md5", "sha1", "sha256", "sha512"}, Workers: 4}
+	out := new(bytes.Buffer)
+	if err := WriteInventory(context.Background(), out, dir, nil, options); err != nil {
+		t.Fatal(err)
+	}
+	saved, algorithms, err := ReadInventory(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(algorithms, ",") != "md5,sha1,sha256,sha512" {
+		t.Errorf("expected the four digests, got %q", algorithms)
+	}
+	got := []string{}
+	for _, entry := range saved {
+		got = append(got, fmt.Sprintf("%s %d %s", entry.Path, entry.Size, entry.MimeType))
+	}
+	expected := []string{
+		"box1/brief.pdf 9 application/pdf",
+		"box1/exhibit.txt 0 text/plain",
+		"box1/letter,1.txt 20 text/plain",
+		"memo.txt 6 text/plain",
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+	digests := []struct {
+		path      string
+		algorithm string
+		want      string
+	}{
+		{path: "memo.txt", algorithm: "md5", want: "b1946ac92492d2347c6235b4d2611184"},
+		{path: "memo.txt", algorithm: "sha1", want: "f572d396fae9206628714fb2ce00f72e94f2258f"},
+		{path: "memo.txt", algorithm: "sha256", want: "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03"},
+		{path: "memo.txt", algorithm: "sha512", want: "e7c22b994c59d9cf2b48e549b1e24666636045930d3da7c1acb299d1c3b7f931f94aae41edda2c2b207a36e10f8bcb8d45223e54878f5b316e7ce3b6bc019629"},
+		{path: "box1/exhibit.txt", algorithm: "md5", want: "d41d8cd98f00b204e9800998ecf8427e"},
+		{path: "box1/exhibit.txt", algorithm: "sha256", want: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+	}
+	for _, d := range digests {
+		if got := entryDigest(t, saved, d.path, d.algorithm); got != d.want {
+			t.Errorf("%s %s: expected %s, got %s", d.path, d.algorithm, d.want, got)
+		}
+	}
+
+	// Nothing has changed, touching a file isn't a change
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "memo.txt"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	options = &InventoryOptions{Algorithms: algorithms, Workers: 2}
+	changes, err := VerifyInventory(context.Background(), dir, nil, saved, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("expected no changes, got %d", len(changes))
+	}
+
+	// Add, remove and change files
+	writeTree(t, dir, map[string]string{
+		"memo.txt":         "hellO\n",
+		"box1/exhibit.txt": "now with content",
+		"box1/brief2.pdf":  "%PDF-1.4\n",
+	})
+	if err := os.Remove(filepath.Join(dir, "box1", "brief.pdf")); err != nil {
+		t.Fatal(err)
+	}
+	changes, err = VerifyInventory(context.Background(), dir, nil, saved, &InventoryOptions{Algorithms: []string{"sha256"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = []string{}
+	for _, change := range changes {
+		got = append(got, fmt.Sprintf("%s %s %s", change.Status, change.Path, change.Detail))
+	}
+	expected = []string{
+		"added box1/brief2.pdf ",
+		"changed box1/exhibit.txt size 16 was 0; sha256 differs",
+		"changed memo.txt sha256 differs",
+		"removed box1/brief.pdf ",
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := WriteInventory(ctx, new(bytes.Buffer), dir, nil, options); err == nil {
+		t.Errorf("expected an error for a cancelled inventory")
+	}
+	if _, _, err := ReadInventory(strings.NewReader("file,size\n")); err == nil {
+		t.Errorf("expected an error for a file which isn't an inventory")
+	}
+	if _, err := ParseDigests("sha256,crc32"); err == nil {
+		t.Errorf("expected an error for an unknown digest")
+	}
+	if algorithms, err := ParseDigests("MD5, SHA-256"); err != nil || strings.Join(algorithms, ",") != "md5,sha256" {
+		t.Errorf("expected md5,sha256, got %q %v", algorithms, err)
+	}
+}
+
+// entryDigest returns the digest of an inventory entry.
+func entryDigest(t *testing.T, entries []*InventoryEntry, path string, algorithm string) string {
+	t.Helper()
+	for _, entry := range entries {
+		if entry.Path == path {
+			return entry.Digests[algorithm]
+		}
+	}
+	t.Fatalf("%s missing from inventory", path)
+	return ""
+}
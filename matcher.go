@@ -0,0 +1,298 @@
+package analysistools
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Matcher is a set of patterns compiled so a document is checked for all
+// of them in one pass. The terms of the patterns are indexed by their
+// normalization: exact terms in a map, prefix terms ("attorn*") in a trie
+// and suffix terms ("*ship") in a trie of the reversed terms. Each word is
+// looked up once and only the patterns using a term it matched are
+// evaluated. A Matcher is not changed once built so it may be shared by
+// several goroutines.
+//
+// ```
+//
+//	matcher := NewMatcher(patterns)
+//	for _, fName := range files {
+//	    in, _ := os.Open(fName)
+//	    matches, err := matcher.Check(in, options)
+//	    ...
+//	}
+//
+// ```
+type Matcher struct {
+	patterns []*Pattern
+	indexes  []*termIndex
+	terms    map[matcherTerm]int
+	// termPatterns lists the patterns to evaluate when a term matches
+	termPatterns [][]int
+	// keyword1 and keyword2 hold the term ids of keyword and proximity patterns
+	keyword1 []int
+	keyword2 []int
+	// phraseTerms holds the term ids of phrase patterns
+	phraseTerms [][]int
+	// maxPhrase is the number of terms in the longest phrase
+	maxPhrase int
+}
+
+// matcherTerm identifies a term by its text and normalization.
+type matcherTerm struct {
+	term          string
+	normalization Normalization
+}
+
+// termIndex finds the terms with the same normalization matched by a word.
+type termIndex struct {
+	normalization Normalization
+	exact         map[string][]int
+	prefix        *trieNode
+	suffix        *trieNode
+	contains      []containsTerm
+}
+
+// trieNode is a node of a byte trie. The ids are the terms ending at it.
+type trieNode struct {
+	children map[byte]*trieNode
+	ids      []int
+}
+
+// containsTerm is a term with a wildcard at both ends, e.g. "*client*".
+type containsTerm struct {
+	s  string
+	id int
+}
+
+// NewMatcher compiles a list of patterns.
+func NewMatcher(patterns []*Pattern) *Matcher {
+	m := &Matcher{
+		patterns:    patterns,
+		terms:       map[matcherTerm]int{},
+		keyword1:    make([]int, len(patterns)),
+		keyword2:    make([]int, len(patterns)),
+		phraseTerms: make([][]int, len(patterns)),
+		maxPhrase:   1,
+	}
+	for i, pattern := range patterns {
+		m.keyword1[i], m.keyword2[i] = -1, -1
+		switch pattern.Type {
+		case Keyword:
+			m.keyword1[i] = m.addTerm(pattern.Keyword1, pattern.Normalization, i)
+		case Proximity:
+			m.keyword1[i] = m.addTerm(pattern.Keyword1, pattern.Normalization, i)
+			m.keyword2[i] = m.addTerm(pattern.Keyword2, pattern.Normalization, i)
+		case Phrase:
+			ids := make([]int, len(pattern.Terms))
+			for j, term := range pattern.Terms {
+				// A phrase is evaluated when its last term is found
+				if j == len(pattern.Terms)-1 {
+					ids[j] = m.addTerm(term, pattern.Normalization, i)
+				} else {
+					ids[j] = m.addTerm(term, pattern.Normalization, -1)
+				}
+			}
+			m.phraseTerms[i] = ids
+			m.maxPhrase = max(m.maxPhrase, len(ids))
+		case Boolean:
+			m.addExprTerms(pattern.Expr, i)
+		}
+	}
+	return m
+}
+
+// Patterns returns the patterns the matcher was built from.
+func (m *Matcher) Patterns() []*Pattern {
+	return m.patterns
+}
+
+// addExprTerms adds the terms of a boolean expression.
+func (m *Matcher) addExprTerms(expr Expr, i int) {
+	switch e := expr.(type) {
+	case *TermExpr:
+		for _, term := range e.Terms {
+			m.addTerm(term, e.Normalization, i)
+		}
+	case *AndExpr:
+		m.addExprTerms(e.Left, i)
+		m.addExprTerms(e.Right, i)
+	case *OrExpr:
+		m.addExprTerms(e.Left, i)
+		m.addExprTerms(e.Right, i)
+	case *NotExpr:
+		m.addExprTerms(e.Expr, i)
+	case *ProximityExpr:
+		m.addExprTerms(e.Left, i)
+		m.addExprTerms(e.Right, i)
+	}
+}
+
+// addTerm returns the id of a term adding it to the index if needed. If
+// i is not -1 pattern i is evaluated when the term matches.
+func (m *Matcher) addTerm(term string, n Normalization, i int) int {
+	key := matcherTerm{term: term, normalization: n}
+	id, ok := m.terms[key]
+	if !ok {
+		id = len(m.termPatterns)
+		m.terms[key] = id
+		m.termPatterns = append(m.termPatterns, nil)
+		m.index(n).add(n.Normalize(term), id)
+	}
+	if i >= 0 && (len(m.termPatterns[id]) == 0 || m.termPatterns[id][len(m.termPatterns[id])-1] != i) {
+		m.termPatterns[id] = append(m.termPatterns[id], i)
+	}
+	return id
+}
+
+// index returns the term index for a normalization.
+func (m *Matcher) index(n Normalization) *termIndex {
+	for _, idx := range m.indexes {
+		if idx.normalization == n {
+			return idx
+		}
+	}
+	idx := &termIndex{
+		normalization: n,
+		exact:         map[string][]int{},
+		prefix:        &trieNode{},
+		suffix:        &trieNode{},
+	}
+	m.indexes = append(m.indexes, idx)
+	return idx
+}
+
+// add indexes a normalized term. The wildcards are handled the same way
+// as tokenMatches.
+func (idx *termIndex) add(term string, id int) {
+	switch {
+	case strings.HasPrefix(term, "*") && strings.HasSuffix(term, "*"):
+		idx.contains = append(idx.contains, containsTerm{s: strings.TrimSuffix(strings.TrimPrefix(term, "*"), "*"), id: id})
+	case strings.HasPrefix(term, "*"):
+		idx.suffix.add(reverseBytes(strings.TrimPrefix(term, "*")), id)
+	case strings.HasSuffix(term, "*"):
+		idx.prefix.add(strings.TrimSuffix(term, "*"), id)
+	default:
+		idx.exact[term] = append(idx.exact[term], id)
+	}
+}
+
+// add inserts a key into the trie.
+func (node *trieNode) add(key string, id int) {
+	for i := 0; i < len(key); i++ {
+		next, ok := node.children[key[i]]
+		if !ok {
+			if node.children == nil {
+				node.children = map[byte]*trieNode{}
+			}
+			next = &trieNode{}
+			node.children[key[i]] = next
+		}
+		node = next
+	}
+	node.ids = append(node.ids, id)
+}
+
+// reverseBytes reverses a string byte by byte. It is only used as a trie
+// key so the result need not be valid UTF-8.
+func reverseBytes(s string) string {
+	b := make([]byte, len(s))
+	for i := 0; i < len(s); i++ {
+		b[len(s)-1-i] = s[i]
+	}
+	return string(b)
+}
+
+// matchWord appends the ids of the terms matched by a word to ids.
+func (m *Matcher) matchWord(value string, ids []int) []int {
+	for _, idx := range m.indexes {
+		s := value
+		if !idx.normalization.IsZero() {
+			s = idx.normalization.Normalize(value)
+		}
+		ids = append(ids, idx.exact[s]...)
+		// Walk the tries collecting the terms which are a prefix or suffix
+		node := idx.prefix
+		ids = append(ids, node.ids...)
+		for i := 0; i < len(s) && node != nil; i++ {
+			if node = node.children[s[i]]; node != nil {
+				ids = append(ids, node.ids...)
+			}
+		}
+		node = idx.suffix
+		ids = append(ids, node.ids...)
+		for i := len(s) - 1; i >= 0 && node != nil; i-- {
+			if node = node.children[s[i]]; node != nil {
+				ids = append(ids, node.ids...)
+			}
+		}
+		for _, c := range idx.contains {
+			if strings.Contains(s, c.s) {
+				ids = append(ids, c.id)
+			}
+		}
+	}
+	return ids
+}
+
+// Stream checks the text from reader calling emit for each match as it is
+// found, see PhraseCheckStream.
+func (m *Matcher) Stream(reader io.Reader, options *CheckOptions, emit func(*Matched) error) error {
+	return m.StreamContext(context.Background(), reader, options, emit)
+}
+
+// StreamContext is Stream stopping when the context is done, see
+// PhraseCheckStreamContext.
+func (m *Matcher) StreamContext(ctx context.Context, reader io.Reader, options *CheckOptions, emit func(*Matched) error) error {
+	return m.stream(ctx, reader, options, func(_ int, match *Matched) error {
+		return emit(match)
+	})
+}
+
+// Check returns the matches in the text from reader grouped by pattern in
+// the order the patterns were given, see PhraseCheckReaderWithOptions.
+func (m *Matcher) Check(reader io.Reader, options *CheckOptions) ([]*Matched, error) {
+	return m.CheckContext(context.Background(), reader, options)
+}
+
+// CheckContext is Check stopping when the context is done. The matches
+// found up to then are returned along with an error wrapping
+// ErrPartialResults, as are the matches found along with an ErrBooleanLimit
+// error. With options.MatchOne only the matches of the first
+// pattern which matched are returned, as PhraseCheckReader always has,
+// so the whole text is read.
+func (m *Matcher) CheckContext(ctx context.Context, reader io.Reader, options *CheckOptions) ([]*Matched, error) {
+	streamOptions := options
+	if options.MatchOne {
+		o := *options
+		o.MatchOne = false
+		streamOptions = &o
+	}
+	byPattern := make([][]*Matched, len(m.patterns))
+	err := m.stream(ctx, reader, streamOptions, func(i int, match *Matched) error {
+		byPattern[i] = append(byPattern[i], match)
+		return nil
+	})
+	if err != nil && !errors.Is(err, ErrPartialResults) && !errors.Is(err, ErrBooleanLimit) {
+		return nil, err
+	}
+	result := []*Matched{}
+	for _, matches := range byPattern {
+		// Proximity pairs are found when the later keyword is read
+		sort.SliceStable(matches, func(i, j int) bool {
+			a, b := matches[i], matches[j]
+			if a.WordNo != b.WordNo {
+				return a.WordNo < b.WordNo
+			}
+			return a.Keyword2WordNo < b.Keyword2WordNo
+		})
+		result = append(result, matches...)
+		if options.MatchOne && len(result) > 0 {
+			break
+		}
+	}
+	return result, err
+}
@@ -0,0 +1,163 @@
+package analysistools
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMatcherTerms(t *testing.T) {
+	lines := []string{
+		"attorney",
+		"attorn*",
+		"*ship",
+		"*client*",
+		"*",
+		"(?i)COUNSEL*",
+		"(?id)*ÉE",
+		"privileged and confidential",
+		"memo w/3 client*",
+	}
+	patterns := []*Pattern{}
+	for _, line := range lines {
+		pattern, err := ParsePattern(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	matcher := NewMatcher(patterns)
+	words := []string{"attorney", "attorneys", "attorn", "atto", "partnership", "ship", "clients", "attorney-client", "Counselor", "counsel", "employée", "EMPLOYEE", "privileged", "memo", ""}
+	// Every term the matcher finds for a word is one termMatches agrees with
+	for _, word := range words {
+		got := matcher.matchWord(word, nil)
+		for key, id := range matcher.terms {
+			want := termMatches(word, key.term, key.normalization)
+			if slices.Contains(got, id) != want {
+				t.Errorf("%q matching %q expected %t", word, key.term, want)
+			}
+		}
+	}
+}
+
+func TestMatcherCheck(t *testing.T) {
+	txt := `The attorney-client privilege protects the counsel's memo to the client.
+The partnership agreement is privileged and confidential.`
+	lines := []string{"attorn*", "*ship", "memo w/3 client*", "privileged and confidential*", "counsel* AND NOT newsletter"}
+	patterns := []*Pattern{}
+	for _, line := range lines {
+		pattern, err := ParsePattern(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	matcher := NewMatcher(patterns)
+	// The matcher can be used for more than one document
+	for i := 0; i < 2; i++ {
+		matched, err := matcher.Check(strings.NewReader(txt), &CheckOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []string{
+			`0,"attorn*","attorney-client"`,
+			`1,"*ship","partnership"`,
+			`0,"memo w/3 client*","memo"`,
+			`1,"privileged and confidential*","privileged and confidential."`,
+			`0,"counsel* AND NOT newsletter","counsel's"`,
+		}
+		if got := MatchedStrings(matched); got != strings.Join(want, "\n") {
+			t.Errorf("expected\n%s\ngot\n%s", strings.Join(want, "\n"), got)
+		}
+	}
+}
+
+// benchmarkPatterns returns a few hundred keyword, wildcard, phrase and
+// proximity patterns along with a text of words drawn from them.
+func benchmarkPatterns(b *testing.B) ([]*Pattern, string) {
+	r := rand.New(rand.NewSource(1))
+	vocabulary := []string{}
+	for i := 0; i < 2000; i++ {
+		vocabulary = append(vocabulary, fmt.Sprintf("w%dx%d", i, r.Intn(100)))
+	}
+	word := func() string {
+		return vocabulary[r.Intn(len(vocabulary))]
+	}
+	lines := []string{}
+	for i := 0; i < 400; i++ {
+		switch i % 5 {
+		case 0:
+			lines = append(lines, word())
+		case 1:
+			lines = append(lines, word()[:3]+"*")
+		case 2:
+			lines = append(lines, "*"+word()[2:])
+		case 3:
+			lines = append(lines, word()+" "+word())
+		case 4:
+			lines = append(lines, fmt.Sprintf("%s w/%d %s", word(), 1+r.Intn(10), word()))
+		}
+	}
+	patterns := []*Pattern{}
+	for _, line := range lines {
+		pattern, err := ParsePattern(line)
+		if err != nil {
+			b.Fatal(err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	words := make([]string, 50000)
+	for i := range words {
+		words[i] = word()
+	}
+	return patterns, strings.Join(words, " ")
+}
+
+// patternLoop checks each pattern against the whole token list in turn.
+func patternLoop(tokens []*Token, patterns []*Pattern) []*Matched {
+	result := []*Matched{}
+	for _, pattern := range patterns {
+		switch pattern.Type {
+		case Keyword:
+			for i, token := range tokens {
+				if termMatches(token.Value, pattern.Keyword1, pattern.Normalization) {
+					result = append(result, newMatched(pattern, tokens[i:i+1]))
+				}
+			}
+		case Phrase:
+			for _, span := range checkPhrase(tokens, pattern.Terms, pattern.Normalization) {
+				result = append(result, newMatched(pattern, span))
+			}
+		case Proximity:
+			for _, pm := range FindProximity(tokens, pattern) {
+				result = append(result, newMatched(pattern, pm.Span))
+			}
+		}
+	}
+	return result
+}
+
+func BenchmarkPatternLoop(b *testing.B) {
+	patterns, txt := benchmarkPatterns(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tokens, err := Tokenizer(txt)
+		if err != nil {
+			b.Fatal(err)
+		}
+		patternLoop(tokens, patterns)
+	}
+}
+
+func BenchmarkMatcher(b *testing.B) {
+	patterns, txt := benchmarkPatterns(b)
+	matcher := NewMatcher(patterns)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := matcher.Check(strings.NewReader(txt), &CheckOptions{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package analysistools
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SystemMimeTypeFiles are the mime.types files read by LoadSystem, the
+// same files Go's mime package reads.
+var SystemMimeTypeFiles = []string{
+	"/etc/mime.types",
+	"/etc/apache2/mime.types",
+	"/etc/apache/mime.types",
+	"/etc/httpd/conf/mime.types",
+}
+
+// MimeRegistry maps file extensions to MIME types. It is safe to use from
+// more than one goroutine.
+type MimeRegistry struct {
+	mu    sync.RWMutex
+	types map[string]string
+}
+
+// DefaultMimeRegistry is the registry used to find the MIME type of a file
+// from its extension. It starts with the built in types.
+var DefaultMimeRegistry = NewMimeRegistry()
+
+// NewMimeRegistry returns a registry holding the built in types.
+func NewMimeRegistry() *MimeRegistry {
+	r := &MimeRegistry{types: make(map[string]string, len(extensionToMIME))}
+	for ext, mimeType := range extensionToMIME {
+		r.types[ext] = mimeType
+	}
+	return r
+}
+
+// normalizeExt returns an extension in lower case starting with a ".".
+func normalizeExt(ext string) string {
+	ext = strings.ToLower(strings.TrimSpace(ext))
+	if ext != "" && !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return ext
+}
+
+// Register maps an extension, e.g. ".eml" or "eml", to a MIME type
+// replacing any existing mapping.
+func (r *MimeRegistry) Register(ext string, mimeType string) error {
+	ext, mimeType = normalizeExt(ext), strings.TrimSpace(mimeType)
+	if ext == "" || !strings.Contains(mimeType, "/") {
+		return fmt.Errorf("bad MIME type mapping %q to %q", ext, mimeType)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.types[ext] = mimeType
+	return nil
+}
+
+// Lookup returns the MIME type of an extension and if it was found.
+func (r *MimeRegistry) Lookup(ext string) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	mimeType, ok := r.types[normalizeExt(ext)]
+	return mimeType, ok
+}
+
+// TypeByExtension returns the MIME type of an extension or
+// "application/octet-stream" if it isn't known.
+func (r *MimeRegistry) TypeByExtension(ext string) string {
+	if mimeType, ok := r.Lookup(ext); ok {
+		return mimeType
+	}
+	return octetStream
+}
+
+// Load reads mappings from a file. Files ending in ".json", ".yaml" or
+// ".yml" map extensions to MIME types, e.g. {".eml": "message/rfc822"}.
+// Other files use the mime.types format. Loaded mappings replace existing
+// ones.
+func (r *MimeRegistry) Load(fName string) error {
+	in, err := os.Open(fName)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	switch ext := strings.ToLower(filepath.Ext(fName)); ext {
+	case ".json", ".yaml", ".yml":
+		err = r.loadMapping(in, ext == ".json")
+	default:
+		err = r.LoadMimeTypes(in)
+	}
+	if err != nil {
+		return fmt.Errorf("%s, %s", fName, err)
+	}
+	return nil
+}
+
+// loadMapping reads a JSON or YAML object mapping extensions to MIME
+// types.
+func (r *MimeRegistry) loadMapping(in io.Reader, isJSON bool) error {
+	mapping := map[string]string{}
+	var err error
+	if isJSON {
+		err = json.NewDecoder(in).Decode(&mapping)
+	} else {
+		err = yaml.NewDecoder(in).Decode(&mapping)
+		if err == io.EOF {
+			err = nil
+		}
+	}
+	if err != nil {
+		return err
+	}
+	for ext, mimeType := range mapping {
+		if err := r.Register(ext, mimeType); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadMimeTypes reads mappings in the mime.types format, a MIME type
+// followed by its extensions on each line, e.g.
+//
+//	message/rfc822  eml mht
+//
+// Lines starting with "#" are comments.
+func (r *MimeRegistry) LoadMimeTypes(in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		for _, ext := range fields[1:] {
+			if err := r.Register(ext, fields[0]); err != nil {
+				return fmt.Errorf("line %d, %s", lineNo, err)
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// LoadSystem reads the system mime.types files which exist, see
+// SystemMimeTypeFiles.
+func (r *MimeRegistry) LoadSystem() error {
+	for _, fName := range SystemMimeTypeFiles {
+		if _, err := os.Stat(fName); err != nil {
+			continue
+		}
+		if err := r.Load(fName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addMimeTypeFlags adds the options loading MIME types to a flag set. The
+// function returned loads them into the registry once the flags are
+// parsed, the system files first so the files named can override them.
+func addMimeTypeFlags(flagSet *flag.FlagSet, r *MimeRegistry) func() error {
+	mimeTypeFiles := []string{}
+	flagSet.Func("mime-types", "load extension to MIME type mappings from a mime.types, JSON or YAML file", func(s string) error {
+		mimeTypeFiles = append(mimeTypeFiles, s)
+		return nil
+	})
+	system := false
+	flagSet.BoolVar(&system, "system-mime-types", system, "load the system mime.types file, e.g. /etc/mime.types")
+	return func() error {
+		if system {
+			if err := r.LoadSystem(); err != nil {
+				return err
+			}
+		}
+		for _, fName := range mimeTypeFiles {
+			if err := r.Load(fName); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,76 @@
+package analysistools
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMimeRegistry(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"mime.types": `# local types
+message/rfc822		eml mht
+application/warc	warc
+text/x-brief		BRF
+`,
+		"local.json": `{".msg": "application/x-outlook-msg", "mbox": "application/mbox"}`,
+		"local.yaml": `# overrides
+.txt: text/x-notes
+dat: application/x-case-data
+`,
+		"bad.types": "message/rfc822 eml\nnot-a-type ext\n",
+	})
+	r := NewMimeRegistry()
+	if got := r.TypeByExtension(".warc"); got != "application/octet-stream" {
+		t.Errorf("expected .warc to be unknown, got %q", got)
+	}
+	for _, name := range []string{"mime.types", "local.json", "local.yaml"} {
+		if err := r.Load(filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Register("CASE", "application/x-case"); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		".eml":  "message/rfc822",
+		".MHT":  "message/rfc822",
+		".warc": "application/warc",
+		".brf":  "text/x-brief",
+		".msg":  "application/x-outlook-msg",
+		".mbox": "application/mbox",
+		".txt":  "text/x-notes",
+		"dat":   "application/x-case-data",
+		".case": "application/x-case",
+		".pdf":  "application/pdf",
+		".xyz":  "application/octet-stream",
+	}
+	for ext, want := range expected {
+		if got := r.TypeByExtension(ext); got != want {
+			t.Errorf("%s: expected %q, got %q", ext, want, got)
+		}
+	}
+	// The default registry is unchanged
+	if got := DefaultMimeRegistry.TypeByExtension(".txt"); got != "text/plain" {
+		t.Errorf("expected the default registry to map .txt to text/plain, got %q", got)
+	}
+	err := r.Load(filepath.Join(dir, "bad.types"))
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected an error for line 2, got %v", err)
+	}
+	if err := r.Register("", "text/plain"); err == nil {
+		t.Errorf("expected an error registering an empty extension")
+	}
+
+	saved := SystemMimeTypeFiles
+	defer func() { SystemMimeTypeFiles = saved }()
+	SystemMimeTypeFiles = []string{filepath.Join(dir, "missing.types"), filepath.Join(dir, "mime.types")}
+	r = NewMimeRegistry()
+	if err := r.LoadSystem(); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.TypeByExtension(".warc"); got != "application/warc" {
+		t.Errorf("expected the system types to map .warc, got %q", got)
+	}
+}
@@ -0,0 +1,127 @@
+package analysistools
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// NormalForm names a Unicode normalization form.
+type NormalForm string
+
+const (
+	NoForm NormalForm = ""
+	NFC    NormalForm = "NFC"
+	NFKC   NormalForm = "NFKC"
+)
+
+// Normalization describes how words are normalized before they are
+// compared. The zero value compares words exactly as written.
+type Normalization struct {
+	// FoldCase compares words without regard to case, e.g. "Attorney" matches "attorn*".
+	FoldCase bool
+	// Form applies Unicode NFC or NFKC normalization.
+	Form NormalForm
+	// FoldDiacritics removes accents and other combining marks, e.g. "café" matches "cafe".
+	FoldDiacritics bool
+}
+
+// ParseNormalForm parses the name of a normalization form, e.g. "NFC" or "nfkc".
+func ParseNormalForm(name string) (NormalForm, error) {
+	switch form := NormalForm(strings.ToUpper(strings.TrimSpace(name))); form {
+	case NoForm, NFC, NFKC:
+		return form, nil
+	}
+	return NoForm, fmt.Errorf("unsupported normalization form %q, expected NFC or NFKC", name)
+}
+
+// ParseNormalizationFlags parses the flags used in a pattern's "(?flags)"
+// prefix. The flags are "i" fold case, "d" fold diacritics, "c" NFC and
+// "k" NFKC normalization.
+func ParseNormalizationFlags(flags string) (Normalization, error) {
+	n := Normalization{}
+	for _, flag := range flags {
+		switch flag {
+		case 'i':
+			n.FoldCase = true
+		case 'd':
+			n.FoldDiacritics = true
+		case 'c':
+			n.Form = NFC
+		case 'k':
+			n.Form = NFKC
+		default:
+			return n, fmt.Errorf("unknown pattern flag %q", flag)
+		}
+	}
+	return n, nil
+}
+
+// splitPatternFlags removes a leading "(?flags)" from a pattern returning
+// the flags and the remaining pattern.
+func splitPatternFlags(pattern string) (string, string) {
+	if !strings.HasPrefix(pattern, "(?") {
+		return "", pattern
+	}
+	end := strings.Index(pattern, ")")
+	if end < 0 {
+		return "", pattern
+	}
+	return pattern[2:end], strings.TrimSpace(pattern[end+1:])
+}
+
+// IsZero reports if no normalization is applied.
+func (n Normalization) IsZero() bool {
+	return n == Normalization{}
+}
+
+// Merge combines two normalizations. Options set in either are set in the
+// result, the form of o is used when both set one.
+func (n Normalization) Merge(o Normalization) Normalization {
+	n.FoldCase = n.FoldCase || o.FoldCase
+	n.FoldDiacritics = n.FoldDiacritics || o.FoldDiacritics
+	if o.Form != NoForm {
+		n.Form = o.Form
+	}
+	return n
+}
+
+// Normalize returns the normalized form of a word.
+func (n Normalization) Normalize(s string) string {
+	if n.FoldDiacritics {
+		s = foldDiacritics(s)
+	}
+	switch n.Form {
+	case NFC:
+		s = norm.NFC.String(s)
+	case NFKC:
+		s = norm.NFKC.String(s)
+	}
+	if n.FoldCase {
+		s = strings.ToLower(s)
+	}
+	return s
+}
+
+// foldDiacritics decomposes a string and drops its combining marks.
+func foldDiacritics(s string) string {
+	decomposed := norm.NFD.String(s)
+	var sb strings.Builder
+	sb.Grow(len(decomposed))
+	for _, r := range decomposed {
+		if !unicode.Is(unicode.Mn, r) {
+			sb.WriteRune(r)
+		}
+	}
+	return norm.NFC.String(sb.String())
+}
+
+// termMatches compares a word and a pattern term after normalizing both.
+func termMatches(s string, term string, n Normalization) bool {
+	if n.IsZero() {
+		return tokenMatches(s, term)
+	}
+	return tokenMatches(n.Normalize(s), n.Normalize(term))
+}
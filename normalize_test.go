@@ -0,0 +1,98 @@
+package analysistools
+
+import (
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		n     Normalization
+		input string
+		want  string
+	}{
+		{n: Normalization{}, input: "Attorney", want: "Attorney"},
+		{n: Normalization{FoldCase: true}, input: "ATTY-CLIENT", want: "atty-client"},
+		{n: Normalization{FoldDiacritics: true}, input: "Café résumé", want: "Cafe resume"},
+		{n: Normalization{Form: NFC}, input: "café", want: "café"},
+		{n: Normalization{Form: NFKC}, input: "ﬁnal", want: "final"},
+		{n: Normalization{FoldCase: true, FoldDiacritics: true, Form: NFKC}, input: "DÉPOSITION", want: "deposition"},
+	}
+	for _, tt := range tests {
+		if got := tt.n.Normalize(tt.input); got != tt.want {
+			t.Errorf("%+v Normalize(%q) = %q, want %q", tt.n, tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParseNormalizationFlags(t *testing.T) {
+	n, err := ParseNormalizationFlags("idk")
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	want := Normalization{FoldCase: true, FoldDiacritics: true, Form: NFKC}
+	if n != want {
+		t.Errorf("expected %+v, got %+v", want, n)
+	}
+	if _, err := ParseNormalizationFlags("x"); err == nil {
+		t.Errorf("expected an error for unknown flag")
+	}
+	if _, err := ParseNormalForm("nfd"); err == nil {
+		t.Errorf("expected an error for unsupported form")
+	}
+}
+
+func TestNormalizedPatterns(t *testing.T) {
+	txt := `The Attorney and the DÉPOSITION transcript.
+The attorney-client privilege was asserted.`
+	tests := []struct {
+		pattern string
+		run     Normalization
+		want    string
+	}{
+		{
+			pattern: "attorn*",
+			want:    `1,"attorn*","attorney-client"`,
+		},
+		{
+			pattern: "attorn*",
+			run:     Normalization{FoldCase: true},
+			want:    "0,\"attorn*\",\"Attorney\"\n1,\"attorn*\",\"attorney-client\"",
+		},
+		{
+			pattern: "(?i)attorn*",
+			want:    "0,\"(?i)attorn*\",\"Attorney\"\n1,\"(?i)attorn*\",\"attorney-client\"",
+		},
+		{
+			pattern: "(?id)deposition w/2 transcript*",
+			want:    `0,"(?id)deposition w/2 transcript*","DÉPOSITION"`,
+		},
+		{
+			pattern: "deposition w/2 transcript*",
+			run:     Normalization{FoldCase: true},
+			want:    "",
+		},
+		{
+			pattern: "(?i)ATTORNEY AND (deposition OR privilege)",
+			want:    "0,\"(?i)ATTORNEY AND (deposition OR privilege)\",\"Attorney\"\n1,\"(?i)ATTORNEY AND (deposition OR privilege)\",\"privilege\"",
+		},
+	}
+	for _, tt := range tests {
+		pattern, err := ParsePattern(tt.pattern)
+		if err != nil {
+			t.Errorf("ParsePattern(%q) unexpected error %s", tt.pattern, err)
+			continue
+		}
+		pattern.ApplyNormalization(tt.run)
+		matched, err := PhraseCheck(txt, []*Pattern{pattern}, false)
+		if err != nil {
+			t.Errorf("PhraseCheck(%q) unexpected error %s", tt.pattern, err)
+			continue
+		}
+		if got := MatchedStrings(matched); got != tt.want {
+			t.Errorf("PhraseCheck(%q) with %+v = %q, want %q", tt.pattern, tt.run, got, tt.want)
+		}
+	}
+	if _, err := ParsePattern("(?z)attorn*"); err == nil {
+		t.Errorf("expected an error for unknown pattern flag")
+	}
+}
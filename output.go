@@ -0,0 +1,203 @@
+package analysistools
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OutputFormat selects how an action writes its report.
+type OutputFormat string
+
+const (
+	// CSVFormat writes RFC 4180 CSV with a header row
+	CSVFormat OutputFormat = "csv"
+	// JSONFormat writes an array of objects
+	JSONFormat OutputFormat = "json"
+	// JSONLFormat writes an object per line, JSON Lines
+	JSONLFormat OutputFormat = "jsonl"
+)
+
+// ParseOutputFormat parses an output format name, csv, json or jsonl.
+func ParseOutputFormat(s string) (OutputFormat, error) {
+	switch format := OutputFormat(strings.ToLower(strings.TrimSpace(s))); format {
+	case CSVFormat, JSONFormat, JSONLFormat:
+		return format, nil
+	}
+	return "", fmt.Errorf("unknown output format %q, expected csv, json or jsonl", s)
+}
+
+// addFormatFlag adds the -format option selecting the report format.
+func addFormatFlag(flagSet *flag.FlagSet, format *OutputFormat) {
+	*format = CSVFormat
+	flagSet.Func("format", "write the report as csv, json or jsonl", func(s string) error {
+		var err error
+		*format, err = ParseOutputFormat(s)
+		return err
+	})
+}
+
+// RecordWriter writes the rows of a report. Each row has a value for
+// each column of the header. A value may be a string, bool, int, int64,
+// float64, time.Time or nil for a missing value.
+type RecordWriter interface {
+	Write(values ...any) error
+	// Close ends the report, it doesn't close the underlying writer
+	Close() error
+}
+
+// NewRecordWriter returns a writer for a report with the header's
+// columns. The JSON keys are the column names with spaces replaced by
+// underscores, e.g. "line no" is "line_no". An empty format is CSV.
+func NewRecordWriter(out io.Writer, format OutputFormat, header []string) (RecordWriter, error) {
+	switch format {
+	case CSVFormat, "":
+		w := &csvRecordWriter{w: csv.NewWriter(out), columns: len(header)}
+		if err := w.w.Write(header); err != nil {
+			return nil, err
+		}
+		return w, nil
+	case JSONFormat, JSONLFormat:
+		keys := make([][]byte, len(header))
+		for i, col := range header {
+			key, err := json.Marshal(strings.ReplaceAll(col, " ", "_"))
+			if err != nil {
+				return nil, err
+			}
+			keys[i] = key
+		}
+		w := &jsonRecordWriter{out: out, keys: keys, lines: format == JSONLFormat}
+		// Text such as "<[[attorney]]>" is kept as written
+		w.enc = json.NewEncoder(&w.buf)
+		w.enc.SetEscapeHTML(false)
+		return w, nil
+	}
+	return nil, fmt.Errorf("unknown output format %q, expected csv, json or jsonl", format)
+}
+
+// csvRecordWriter writes a report with encoding/csv.
+type csvRecordWriter struct {
+	w       *csv.Writer
+	columns int
+	row     []string
+}
+
+func (w *csvRecordWriter) Write(values ...any) error {
+	if len(values) != w.columns {
+		return fmt.Errorf("expected %d values, got %d", w.columns, len(values))
+	}
+	w.row = w.row[:0]
+	for _, value := range values {
+		w.row = append(w.row, formatValue(value))
+	}
+	return w.w.Write(w.row)
+}
+
+func (w *csvRecordWriter) Close() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+// formatValue returns the CSV text of a value.
+func formatValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	}
+	return fmt.Sprint(value)
+}
+
+// jsonRecordWriter writes a report as a JSON array of objects, or with
+// lines set, an object per line. The object's keys are in the order of
+// the header.
+type jsonRecordWriter struct {
+	out   io.Writer
+	keys  [][]byte
+	lines bool
+	rows  int
+	buf   bytes.Buffer
+	enc   *json.Encoder
+}
+
+func (w *jsonRecordWriter) Write(values ...any) error {
+	if len(values) != len(w.keys) {
+		return fmt.Errorf("expected %d values, got %d", len(w.keys), len(values))
+	}
+	w.buf.Reset()
+	switch {
+	case w.lines:
+	case w.rows == 0:
+		w.buf.WriteString("[\n")
+	default:
+		w.buf.WriteString(",\n")
+	}
+	w.buf.WriteByte('{')
+	for i, value := range values {
+		if i > 0 {
+			w.buf.WriteByte(',')
+		}
+		if t, ok := value.(time.Time); ok {
+			value = t.Format(time.RFC3339)
+		}
+		w.buf.Write(w.keys[i])
+		w.buf.WriteByte(':')
+		if err := w.enc.Encode(value); err != nil {
+			return err
+		}
+		// Encode ends each value with a newline
+		w.buf.Truncate(w.buf.Len() - 1)
+	}
+	w.buf.WriteByte('}')
+	if w.lines {
+		w.buf.WriteByte('\n')
+	}
+	w.rows++
+	_, err := w.out.Write(w.buf.Bytes())
+	return err
+}
+
+func (w *jsonRecordWriter) Close() error {
+	var err error
+	switch {
+	case w.lines:
+	case w.rows == 0:
+		_, err = io.WriteString(w.out, "[]\n")
+	default:
+		_, err = io.WriteString(w.out, "\n]\n")
+	}
+	return err
+}
+
+// nullString returns nil, a missing value, for an empty string.
+func nullString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// closeRecords closes a report keeping the first error.
+func closeRecords(w RecordWriter, err error) error {
+	if closeErr := w.Close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	return err
+}
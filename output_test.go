@@ -0,0 +1,88 @@
+package analysistools
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecordWriter(t *testing.T) {
+	header := []string{"file path", "line no", "match", "mismatch", "similarity", "modified", "keyword 2"}
+	modified := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	rows := [][]any{
+		{"box1/memo, \"draft\".txt", 3, "<attorney>", false, 0.85, modified, nil},
+		{`C:\archive\letter.txt`, int64(12), "line one\nline two", true, 1.0, modified, "client"},
+	}
+	write := func(format OutputFormat) string {
+		t.Helper()
+		out := new(bytes.Buffer)
+		w, err := NewRecordWriter(out, format, header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, row := range rows {
+			if err := w.Write(row...); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return out.String()
+	}
+
+	// CSV is RFC 4180, quotes are doubled rather than escaped
+	expected := `file path,line no,match,mismatch,similarity,modified,keyword 2
+"box1/memo, ""draft"".txt",3,<attorney>,false,0.85,2024-03-01T12:30:00Z,
+C:\archive\letter.txt,12,"line one
+line two",true,1,2024-03-01T12:30:00Z,client
+`
+	src := write(CSVFormat)
+	if src != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, src)
+	}
+	records, err := csv.NewReader(strings.NewReader(src)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || records[1][0] != `box1/memo, "draft".txt` || records[2][2] != "line one\nline two" {
+		t.Errorf("expected the CSV to read back, got %q", records)
+	}
+
+	expected = `{"file_path":"box1/memo, \"draft\".txt","line_no":3,"match":"<attorney>","mismatch":false,"similarity":0.85,"modified":"2024-03-01T12:30:00Z","keyword_2":null}
+{"file_path":"C:\\archive\\letter.txt","line_no":12,"match":"line one\nline two","mismatch":true,"similarity":1,"modified":"2024-03-01T12:30:00Z","keyword_2":"client"}
+`
+	if src := write(JSONLFormat); src != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, src)
+	}
+
+	objects := []map[string]any{}
+	if err := json.Unmarshal([]byte(write(JSONFormat)), &objects); err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 2 || objects[1]["line_no"] != 12.0 || objects[0]["keyword_2"] != nil {
+		t.Errorf("expected the JSON array to read back, got %v", objects)
+	}
+
+	// An empty report is still a JSON array
+	out := new(bytes.Buffer)
+	w, err := NewRecordWriter(out, JSONFormat, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write("too few"); err == nil {
+		t.Errorf("expected an error for a row without a value for each column")
+	}
+	if err := w.Close(); err != nil || out.String() != "[]\n" {
+		t.Errorf("expected an empty array, got %q %v", out.String(), err)
+	}
+	if _, err := ParseOutputFormat("XML"); err == nil {
+		t.Errorf("expected an error for an unknown format")
+	}
+	if format, err := ParseOutputFormat(" JSONL "); err != nil || format != JSONLFormat {
+		t.Errorf("expected jsonl, got %q %v", format, err)
+	}
+}
@@ -0,0 +1,1598 @@
+package analysistools
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"context"
+	"encoding/ascii85"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// The objects of a PDF file. Integers are int, reals float64, booleans
+// bool and null nil.
+type (
+	pdfName    string
+	pdfKeyword string
+	pdfString  []byte
+	pdfArray   []any
+	pdfDict    map[pdfName]any
+	pdfRef     struct{ num, gen int }
+)
+
+// pdfStream is a stream object, data is still encoded.
+type pdfStream struct {
+	dict pdfDict
+	data []byte
+}
+
+// pdfMaxStream limits the size of a decoded stream.
+const pdfMaxStream = 256 << 20
+
+// pdfMaxFile limits the size of a PDF file, it is held in memory.
+const pdfMaxFile = 512 << 20
+
+// pdfLexer reads the tokens and objects of a PDF file or content stream.
+// In a content stream, content is set, "1 0 R" isn't a reference.
+type pdfLexer struct {
+	data    []byte
+	pos     int
+	content bool
+}
+
+// isPDFSpace reports if a byte is PDF white space.
+func isPDFSpace(c byte) bool {
+	switch c {
+	case 0, '\t', '\n', '\f', '\r', ' ':
+		return true
+	}
+	return false
+}
+
+// isPDFDelimiter reports if a byte ends a name, number or keyword.
+func isPDFDelimiter(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return isPDFSpace(c)
+}
+
+// skipSpace skips white space and comments.
+func (lex *pdfLexer) skipSpace() {
+	for lex.pos < len(lex.data) {
+		c := lex.data[lex.pos]
+		switch {
+		case isPDFSpace(c):
+			lex.pos++
+		case c == '%':
+			for lex.pos < len(lex.data) && lex.data[lex.pos] != '\n' && lex.data[lex.pos] != '\r' {
+				lex.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// next returns the next token. Delimiters such as "[" and "<<" are
+// returned as keywords.
+func (lex *pdfLexer) next() (any, error) {
+	lex.skipSpace()
+	if lex.pos >= len(lex.data) {
+		return nil, io.EOF
+	}
+	start := lex.pos
+	switch c := lex.data[lex.pos]; c {
+	case '(':
+		return lex.literalString()
+	case '<':
+		if lex.pos+1 < len(lex.data) && lex.data[lex.pos+1] == '<' {
+			lex.pos += 2
+			return pdfKeyword("<<"), nil
+		}
+		return lex.hexString()
+	case '>':
+		if lex.pos+1 < len(lex.data) && lex.data[lex.pos+1] == '>' {
+			lex.pos += 2
+			return pdfKeyword(">>"), nil
+		}
+		lex.pos++
+		return pdfKeyword(">"), nil
+	case '[', ']', '{', '}', ')':
+		lex.pos++
+		return pdfKeyword(lex.data[start:lex.pos]), nil
+	case '/':
+		lex.pos++
+		for lex.pos < len(lex.data) && !isPDFDelimiter(lex.data[lex.pos]) {
+			lex.pos++
+		}
+		return pdfName(unescapeName(lex.data[start+1 : lex.pos])), nil
+	}
+	for lex.pos < len(lex.data) && !isPDFDelimiter(lex.data[lex.pos]) {
+		lex.pos++
+	}
+	word := string(lex.data[start:lex.pos])
+	switch word {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	if n, ok := parsePDFNumber(word); ok {
+		return n, nil
+	}
+	return pdfKeyword(word), nil
+}
+
+// parsePDFNumber parses an integer or real, e.g. "12", "-3.5" or ".5".
+func parsePDFNumber(word string) (any, bool) {
+	if word == "" {
+		return nil, false
+	}
+	digits, dot := 0, false
+	for i := 0; i < len(word); i++ {
+		switch c := word[i]; {
+		case c >= '0' && c <= '9':
+			digits++
+		case c == '.' && !dot:
+			dot = true
+		case (c == '+' || c == '-') && i == 0:
+		default:
+			return nil, false
+		}
+	}
+	if digits == 0 {
+		return nil, false
+	}
+	if !dot {
+		if n, err := strconv.Atoi(word); err == nil {
+			return n, true
+		}
+	}
+	f, err := strconv.ParseFloat(word, 64)
+	if err != nil {
+		// Some writers produce reals such as "-.002-" or "1.2.3"
+		return 0.0, true
+	}
+	return f, true
+}
+
+// unescapeName decodes the #xx escapes in a name.
+func unescapeName(name []byte) string {
+	if bytes.IndexByte(name, '#') < 0 {
+		return string(name)
+	}
+	out := make([]byte, 0, len(name))
+	for i := 0; i < len(name); i++ {
+		if name[i] == '#' && i+2 < len(name) {
+			if b, err := hex.DecodeString(string(name[i+1 : i+3])); err == nil {
+				out = append(out, b[0])
+				i += 2
+				continue
+			}
+		}
+		out = append(out, name[i])
+	}
+	return string(out)
+}
+
+// literalString reads a string in parentheses, which may hold balanced
+// parentheses and backslash escapes.
+func (lex *pdfLexer) literalString() (any, error) {
+	lex.pos++
+	out := []byte{}
+	depth := 1
+	for lex.pos < len(lex.data) {
+		c := lex.data[lex.pos]
+		lex.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return pdfString(out), nil
+			}
+		case '\\':
+			if lex.pos >= len(lex.data) {
+				break
+			}
+			c = lex.data[lex.pos]
+			lex.pos++
+			switch c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				// A line continuation
+				if lex.pos < len(lex.data) && lex.data[lex.pos] == '\n' {
+					lex.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if c >= '0' && c <= '7' {
+					n := int(c - '0')
+					for i := 0; i < 2 && lex.pos < len(lex.data) && lex.data[lex.pos] >= '0' && lex.data[lex.pos] <= '7'; i++ {
+						n = n*8 + int(lex.data[lex.pos]-'0')
+						lex.pos++
+					}
+					c = byte(n)
+				}
+			}
+		case '\r':
+			// An end of line is a newline however it is written
+			if lex.pos < len(lex.data) && lex.data[lex.pos] == '\n' {
+				lex.pos++
+			}
+			c = '\n'
+		}
+		out = append(out, c)
+	}
+	return pdfString(out), io.ErrUnexpectedEOF
+}
+
+// hexString reads a string of hex digits in angle brackets.
+func (lex *pdfLexer) hexString() (any, error) {
+	lex.pos++
+	out := []byte{}
+	var b byte
+	odd := false
+	for lex.pos < len(lex.data) {
+		c := lex.data[lex.pos]
+		lex.pos++
+		var n byte
+		switch {
+		case c == '>':
+			if odd {
+				out = append(out, b<<4)
+			}
+			return pdfString(out), nil
+		case c >= '0' && c <= '9':
+			n = c - '0'
+		case c >= 'a' && c <= 'f':
+			n = c - 'a' + 10
+		case c >= 'A' && c <= 'F':
+			n = c - 'A' + 10
+		default:
+			continue
+		}
+		if odd {
+			out = append(out, b<<4|n)
+		} else {
+			b = n
+		}
+		odd = !odd
+	}
+	return pdfString(out), io.ErrUnexpectedEOF
+}
+
+// readObject reads an object. Arrays and dictionaries are read whole and
+// in a file "1 0 R" is a reference. Keywords, e.g. "obj" or a content
+// stream's operators, are returned as they are.
+func (lex *pdfLexer) readObject() (any, error) {
+	return lex.readNested(0)
+}
+
+// pdfMaxDepth limits the nesting of arrays, dictionaries and forms.
+const pdfMaxDepth = 64
+
+func (lex *pdfLexer) readNested(depth int) (any, error) {
+	token, err := lex.next()
+	if err != nil {
+		return token, err
+	}
+	if depth > pdfMaxDepth {
+		return nil, fmt.Errorf("objects nested too deeply")
+	}
+	switch t := token.(type) {
+	case pdfKeyword:
+		switch t {
+		case "[":
+			array := pdfArray{}
+			for {
+				item, err := lex.readNested(depth + 1)
+				if err != nil {
+					return array, err
+				}
+				if item == pdfKeyword("]") {
+					return array, nil
+				}
+				array = append(array, item)
+			}
+		case "<<":
+			dict := pdfDict{}
+			for {
+				key, err := lex.readNested(depth + 1)
+				if err != nil {
+					return dict, err
+				}
+				if key == pdfKeyword(">>") {
+					return dict, nil
+				}
+				value, err := lex.readNested(depth + 1)
+				if err != nil {
+					return dict, err
+				}
+				if name, ok := key.(pdfName); ok {
+					dict[name] = value
+				}
+			}
+		}
+	case int:
+		if lex.content {
+			return t, nil
+		}
+		// Look ahead for a reference, "num gen R"
+		pos := lex.pos
+		if gen, err := lex.next(); err == nil {
+			if gen, ok := gen.(int); ok {
+				if r, err := lex.next(); err == nil && r == pdfKeyword("R") {
+					return pdfRef{num: t, gen: gen}, nil
+				}
+			}
+		}
+		lex.pos = pos
+	}
+	return token, nil
+}
+
+// pdfXref locates an object, at an offset in the file or the index'th
+// object of an object stream.
+type pdfXref struct {
+	offset     int
+	stream     int
+	index      int
+	compressed bool
+}
+
+// pdfDocument is a PDF file held in memory.
+type pdfDocument struct {
+	data    []byte
+	xref    map[int]pdfXref
+	trailer pdfDict
+	objects map[int]any
+	// reading holds the objects being read to break reference loops
+	reading map[int]bool
+	// objStms holds the decoded object streams
+	objStms map[int]*pdfObjStm
+	fonts   map[pdfRef]*pdfFont
+}
+
+// pdfObjStm is a decoded object stream.
+type pdfObjStm struct {
+	header  []byte
+	data    []byte
+	offsets []int
+}
+
+// openPDF reads the cross reference table and trailer of a PDF file.
+// When the table is damaged it is rebuilt by scanning the file for
+// objects.
+func openPDF(data []byte) (*pdfDocument, error) {
+	if bytes.Index(data[:min(len(data), 1024)], []byte("%PDF-")) < 0 {
+		return nil, fmt.Errorf("not a PDF file")
+	}
+	doc := &pdfDocument{
+		data:    data,
+		xref:    make(map[int]pdfXref),
+		objects: make(map[int]any),
+		reading: make(map[int]bool),
+		objStms: make(map[int]*pdfObjStm),
+		fonts:   make(map[pdfRef]*pdfFont),
+	}
+	rebuilt := false
+	if err := doc.readXref(); err != nil || doc.trailer["Root"] == nil || doc.resolveDict(doc.trailer["Root"]) == nil {
+		doc.xref = make(map[int]pdfXref)
+		doc.objects = make(map[int]any)
+		doc.rebuildXref()
+		rebuilt = true
+	}
+	if rebuilt {
+		doc.indexObjectStreams()
+	}
+	return doc, nil
+}
+
+// readXref reads the cross reference sections from the last one, each
+// section's entries taking precedence over those of the earlier ones.
+func (doc *pdfDocument) readXref() error {
+	i := bytes.LastIndex(doc.data, []byte("startxref"))
+	if i < 0 {
+		return fmt.Errorf("startxref is missing")
+	}
+	lex := &pdfLexer{data: doc.data, pos: i + len("startxref")}
+	token, err := lex.next()
+	offset, ok := token.(int)
+	if err != nil || !ok {
+		return fmt.Errorf("startxref is damaged")
+	}
+	seen := map[int]bool{}
+	for !seen[offset] {
+		seen[offset] = true
+		trailer, err := doc.readXrefSection(offset)
+		if err != nil {
+			return err
+		}
+		if doc.trailer == nil {
+			doc.trailer = trailer
+		}
+		// A hybrid file lists its compressed objects in a stream
+		if stm, ok := trailer["XRefStm"].(int); ok && !seen[stm] {
+			seen[stm] = true
+			doc.readXrefSection(stm)
+		}
+		prev, ok := trailer["Prev"].(int)
+		if !ok {
+			break
+		}
+		offset = prev
+	}
+	return nil
+}
+
+// addXref adds an entry unless a later section already has the object.
+func (doc *pdfDocument) addXref(num int, x pdfXref) {
+	if _, ok := doc.xref[num]; !ok && num >= 0 {
+		doc.xref[num] = x
+	}
+}
+
+// readXrefSection reads a cross reference table or stream returning its
+// trailer.
+func (doc *pdfDocument) readXrefSection(offset int) (pdfDict, error) {
+	if offset < 0 || offset >= len(doc.data) {
+		return nil, fmt.Errorf("cross reference offset %d is outside the file", offset)
+	}
+	lex := &pdfLexer{data: doc.data, pos: offset}
+	lex.skipSpace()
+	if !bytes.HasPrefix(doc.data[lex.pos:], []byte("xref")) {
+		return doc.readXrefStream(offset)
+	}
+	lex.pos += len("xref")
+	for {
+		token, err := lex.next()
+		if err != nil {
+			return nil, err
+		}
+		if token == pdfKeyword("trailer") {
+			trailer, err := lex.readObject()
+			dict, ok := trailer.(pdfDict)
+			if err != nil || !ok {
+				return nil, fmt.Errorf("trailer is damaged")
+			}
+			return dict, nil
+		}
+		start, ok := token.(int)
+		if !ok {
+			return nil, fmt.Errorf("cross reference table is damaged")
+		}
+		token, err = lex.next()
+		count, ok := token.(int)
+		if err != nil || !ok || count < 0 || count > len(doc.data)/18 {
+			return nil, fmt.Errorf("cross reference table is damaged")
+		}
+		for i := 0; i < count; i++ {
+			fields := [3]any{}
+			for j := range fields {
+				if fields[j], err = lex.next(); err != nil {
+					return nil, err
+				}
+			}
+			offset, ok := fields[0].(int)
+			if !ok {
+				return nil, fmt.Errorf("cross reference table is damaged")
+			}
+			if fields[2] == pdfKeyword("n") {
+				doc.addXref(start+i, pdfXref{offset: offset})
+			}
+		}
+	}
+}
+
+// readXrefStream reads a cross reference stream, PDF 1.5.
+func (doc *pdfDocument) readXrefStream(offset int) (pdfDict, error) {
+	obj, _, err := doc.readIndirect(offset)
+	if err != nil {
+		return nil, err
+	}
+	stream, ok := obj.(*pdfStream)
+	if !ok || stream.dict["Type"] != pdfName("XRef") {
+		return nil, fmt.Errorf("cross reference stream is missing")
+	}
+	data, err := doc.streamData(stream)
+	if err != nil {
+		return nil, err
+	}
+	widths := [3]int{}
+	w, _ := stream.dict["W"].(pdfArray)
+	if len(w) < 3 {
+		return nil, fmt.Errorf("cross reference stream has no widths")
+	}
+	rowLen := 0
+	for i := range widths {
+		widths[i], _ = w[i].(int)
+		if widths[i] < 0 || widths[i] > 8 {
+			return nil, fmt.Errorf("cross reference stream widths are damaged")
+		}
+		rowLen += widths[i]
+	}
+	if rowLen == 0 {
+		return nil, fmt.Errorf("cross reference stream widths are damaged")
+	}
+	size, _ := stream.dict["Size"].(int)
+	index, _ := stream.dict["Index"].(pdfArray)
+	if index == nil {
+		index = pdfArray{0, size}
+	}
+	field := func(row []byte, i int, def int) int {
+		if widths[i] == 0 {
+			return def
+		}
+		n := 0
+		for _, b := range row[:widths[i]] {
+			n = n<<8 | int(b)
+		}
+		return n
+	}
+	for i := 0; i+1 < len(index); i += 2 {
+		start, _ := index[i].(int)
+		count, _ := index[i+1].(int)
+		for j := 0; j < count && len(data) >= rowLen; j++ {
+			row := data[:rowLen]
+			data = data[rowLen:]
+			typ := field(row, 0, 1)
+			f2 := field(row[widths[0]:], 1, 0)
+			f3 := field(row[widths[0]+widths[1]:], 2, 0)
+			switch typ {
+			case 1:
+				doc.addXref(start+j, pdfXref{offset: f2})
+			case 2:
+				doc.addXref(start+j, pdfXref{stream: f2, index: f3, compressed: true})
+			}
+		}
+	}
+	return stream.dict, nil
+}
+
+// pdfObjectHeader finds the "num gen obj" starting each object.
+var pdfObjectHeader = regexp.MustCompile(`(\d+)[\x00\t\n\f\r ]+(\d+)[\x00\t\n\f\r ]+obj\b`)
+
+// rebuildXref finds the objects by scanning the file, a later object
+// replaces an earlier one with the same number as an update would. The
+// trailer is the last one with a document catalog.
+func (doc *pdfDocument) rebuildXref() {
+	for _, m := range pdfObjectHeader.FindAllSubmatchIndex(doc.data, -1) {
+		if m[0] > 0 && !isPDFDelimiter(doc.data[m[0]-1]) {
+			continue
+		}
+		num, err := strconv.Atoi(string(doc.data[m[2]:m[3]]))
+		if err != nil {
+			continue
+		}
+		doc.xref[num] = pdfXref{offset: m[0]}
+	}
+	for i := 0; ; {
+		j := bytes.Index(doc.data[i:], []byte("trailer"))
+		if j < 0 {
+			break
+		}
+		i += j + len("trailer")
+		lex := &pdfLexer{data: doc.data, pos: i}
+		if trailer, err := lex.readObject(); err == nil {
+			if dict, ok := trailer.(pdfDict); ok && dict["Root"] != nil {
+				doc.trailer = dict
+			}
+		}
+	}
+	if doc.trailer != nil {
+		return
+	}
+	// A file with cross reference streams has its trailers in them, failing
+	// that look for the catalog
+	nums := make([]int, 0, len(doc.xref))
+	for num := range doc.xref {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+	for _, num := range nums {
+		obj, _, err := doc.readIndirect(doc.xref[num].offset)
+		if err != nil {
+			continue
+		}
+		var dict pdfDict
+		switch o := obj.(type) {
+		case pdfDict:
+			dict = o
+		case *pdfStream:
+			dict = o.dict
+		}
+		switch {
+		case dict["Type"] == pdfName("XRef") && dict["Root"] != nil:
+			doc.trailer = dict
+			return
+		case dict["Type"] == pdfName("Catalog") && doc.trailer == nil:
+			doc.trailer = pdfDict{"Root": pdfRef{num: num}}
+		}
+	}
+}
+
+// indexObjectStreams adds the objects held in object streams to a rebuilt
+// cross reference table.
+func (doc *pdfDocument) indexObjectStreams() {
+	nums := []int{}
+	for num, x := range doc.xref {
+		if !x.compressed {
+			nums = append(nums, num)
+		}
+	}
+	for _, num := range nums {
+		stream, ok := doc.object(num).(*pdfStream)
+		if !ok || stream.dict["Type"] != pdfName("ObjStm") {
+			continue
+		}
+		objStm := doc.objectStream(num)
+		if objStm == nil {
+			continue
+		}
+		lex := &pdfLexer{data: objStm.header}
+		for i := 0; ; i++ {
+			token, err := lex.next()
+			objNum, ok := token.(int)
+			if err != nil || !ok {
+				break
+			}
+			lex.next()
+			doc.addXref(objNum, pdfXref{stream: num, index: i, compressed: true})
+		}
+	}
+}
+
+// readIndirect reads the object at an offset, "num gen obj ... endobj",
+// returning it and its reference.
+func (doc *pdfDocument) readIndirect(offset int) (any, pdfRef, error) {
+	if offset < 0 || offset >= len(doc.data) {
+		return nil, pdfRef{}, fmt.Errorf("object offset %d is outside the file", offset)
+	}
+	lex := &pdfLexer{data: doc.data, pos: offset}
+	header := [3]any{}
+	for i := range header {
+		token, err := lex.next()
+		if err != nil {
+			return nil, pdfRef{}, err
+		}
+		header[i] = token
+	}
+	num, ok1 := header[0].(int)
+	gen, ok2 := header[1].(int)
+	if !ok1 || !ok2 || header[2] != pdfKeyword("obj") {
+		return nil, pdfRef{}, fmt.Errorf("no object at offset %d", offset)
+	}
+	ref := pdfRef{num: num, gen: gen}
+	obj, err := lex.readObject()
+	if err != nil {
+		return nil, ref, err
+	}
+	dict, ok := obj.(pdfDict)
+	if !ok {
+		return obj, ref, nil
+	}
+	pos := lex.pos
+	if token, err := lex.next(); err != nil || token != pdfKeyword("stream") {
+		lex.pos = pos
+		return dict, ref, nil
+	}
+	// The data starts after the end of line following "stream"
+	start := lex.pos
+	if start < len(doc.data) && doc.data[start] == '\r' {
+		start++
+	}
+	if start < len(doc.data) && doc.data[start] == '\n' {
+		start++
+	}
+	stream := &pdfStream{dict: dict}
+	if length, ok := doc.resolve(dict["Length"]).(int); ok && length >= 0 && start+length <= len(doc.data) {
+		end := &pdfLexer{data: doc.data, pos: start + length}
+		if token, err := end.next(); err == nil && token == pdfKeyword("endstream") {
+			stream.data = doc.data[start : start+length]
+			return stream, ref, nil
+		}
+	}
+	// The length is missing or wrong, the data runs up to endstream
+	end := bytes.Index(doc.data[start:], []byte("endstream"))
+	if end < 0 {
+		end = len(doc.data) - start
+	}
+	stream.data = bytes.TrimRight(doc.data[start:start+end], "\r\n")
+	return stream, ref, nil
+}
+
+// object returns an object by its number, nil if it is missing.
+func (doc *pdfDocument) object(num int) any {
+	if obj, ok := doc.objects[num]; ok {
+		return obj
+	}
+	x, ok := doc.xref[num]
+	if !ok || doc.reading[num] {
+		return nil
+	}
+	doc.reading[num] = true
+	defer delete(doc.reading, num)
+	var obj any
+	if x.compressed {
+		obj = doc.compressedObject(x.stream, x.index)
+	} else {
+		o, ref, err := doc.readIndirect(x.offset)
+		if err == nil && ref.num == num {
+			obj = o
+		}
+	}
+	doc.objects[num] = obj
+	return obj
+}
+
+// objectStream returns a decoded object stream, nil if it can't be read.
+func (doc *pdfDocument) objectStream(num int) *pdfObjStm {
+	if objStm, ok := doc.objStms[num]; ok {
+		return objStm
+	}
+	doc.objStms[num] = nil
+	stream, ok := doc.object(num).(*pdfStream)
+	if !ok {
+		return nil
+	}
+	data, err := doc.streamData(stream)
+	if err != nil {
+		return nil
+	}
+	first, _ := stream.dict["First"].(int)
+	if first < 0 || first > len(data) {
+		return nil
+	}
+	objStm := &pdfObjStm{data: data[first:], header: data[:first]}
+	lex := &pdfLexer{data: objStm.header}
+	for {
+		_, err := lex.next()
+		if err != nil {
+			break
+		}
+		token, err := lex.next()
+		offset, ok := token.(int)
+		if err != nil || !ok {
+			break
+		}
+		objStm.offsets = append(objStm.offsets, offset)
+	}
+	doc.objStms[num] = objStm
+	return objStm
+}
+
+// compressedObject returns the index'th object of an object stream.
+func (doc *pdfDocument) compressedObject(num int, index int) any {
+	objStm := doc.objectStream(num)
+	if objStm == nil || index < 0 || index >= len(objStm.offsets) || objStm.offsets[index] >= len(objStm.data) {
+		return nil
+	}
+	lex := &pdfLexer{data: objStm.data, pos: objStm.offsets[index]}
+	obj, err := lex.readObject()
+	if err != nil {
+		return nil
+	}
+	return obj
+}
+
+// resolve follows a reference returning the object.
+func (doc *pdfDocument) resolve(obj any) any {
+	for i := 0; i < 8; i++ {
+		ref, ok := obj.(pdfRef)
+		if !ok {
+			return obj
+		}
+		obj = doc.object(ref.num)
+	}
+	return nil
+}
+
+// resolveDict returns a dictionary or a stream's dictionary, nil if the
+// object is neither.
+func (doc *pdfDocument) resolveDict(obj any) pdfDict {
+	switch o := doc.resolve(obj).(type) {
+	case pdfDict:
+		return o
+	case *pdfStream:
+		return o.dict
+	}
+	return nil
+}
+
+// resolveNumber returns a number as a float64.
+func (doc *pdfDocument) resolveNumber(obj any) (float64, bool) {
+	switch n := doc.resolve(obj).(type) {
+	case int:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+// streamData decodes a stream's data.
+func (doc *pdfDocument) streamData(stream *pdfStream) ([]byte, error) {
+	data := stream.data
+	filters := pdfArray{}
+	params := pdfArray{}
+	switch f := doc.resolve(stream.dict["Filter"]).(type) {
+	case pdfName:
+		filters = pdfArray{f}
+		params = pdfArray{stream.dict["DecodeParms"]}
+	case pdfArray:
+		filters = f
+		params, _ = doc.resolve(stream.dict["DecodeParms"]).(pdfArray)
+	}
+	for i, f := range filters {
+		name, _ := doc.resolve(f).(pdfName)
+		var param pdfDict
+		if i < len(params) {
+			param = doc.resolveDict(params[i])
+		}
+		var err error
+		if data, err = doc.decode(name, param, data); err != nil {
+			return data, err
+		}
+	}
+	return data, nil
+}
+
+// decode applies a stream filter.
+func (doc *pdfDocument) decode(name pdfName, param pdfDict, data []byte) ([]byte, error) {
+	var err error
+	switch name {
+	case "FlateDecode", "Fl":
+		data, err = inflate(data)
+		if err != nil {
+			return data, err
+		}
+		return doc.unpredict(param, data)
+	case "LZWDecode", "LZW":
+		earlyChange := 1
+		if n, ok := doc.resolve(param["EarlyChange"]).(int); ok {
+			earlyChange = n
+		}
+		if data, err = lzwDecode(data, earlyChange); err != nil {
+			return data, err
+		}
+		return doc.unpredict(param, data)
+	case "ASCIIHexDecode", "AHx":
+		if i := bytes.IndexByte(data, '>'); i >= 0 {
+			data = data[:i]
+		}
+		lex := &pdfLexer{data: append(append([]byte{'<'}, data...), '>')}
+		s, err := lex.hexString()
+		return s.(pdfString), err
+	case "ASCII85Decode", "A85":
+		data = bytes.Map(func(r rune) rune {
+			if r < 256 && isPDFSpace(byte(r)) {
+				return -1
+			}
+			return r
+		}, data)
+		data = bytes.TrimPrefix(data, []byte("<~"))
+		if i := bytes.Index(data, []byte("~>")); i >= 0 {
+			data = data[:i]
+		}
+		out := make([]byte, len(data)*5)
+		n, _, err := ascii85.Decode(out, data, true)
+		return out[:n], err
+	case "RunLengthDecode", "RL":
+		return runLengthDecode(data), nil
+	case "Crypt":
+		return data, nil
+	}
+	return nil, fmt.Errorf("unsupported filter %s", name)
+}
+
+// inflate decompresses zlib data, keeping what could be read from a
+// truncated stream. Streams without a zlib header are read as deflate.
+func inflate(data []byte) ([]byte, error) {
+	var r io.ReadCloser
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		r = flate.NewReader(bytes.NewReader(data))
+	}
+	defer r.Close()
+	out, err := io.ReadAll(io.LimitReader(r, pdfMaxStream))
+	if err != nil && len(out) > 0 && (errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, zlib.ErrChecksum)) {
+		err = nil
+	}
+	return out, err
+}
+
+// unpredict reverses the PNG or TIFF predictor of a Flate or LZW stream.
+func (doc *pdfDocument) unpredict(param pdfDict, data []byte) ([]byte, error) {
+	intParam := func(key pdfName, def int) int {
+		if n, ok := doc.resolve(param[key]).(int); ok && n > 0 {
+			return n
+		}
+		return def
+	}
+	predictor := intParam("Predictor", 1)
+	if predictor < 2 {
+		return data, nil
+	}
+	colors, bits, columns := intParam("Colors", 1), intParam("BitsPerComponent", 8), intParam("Columns", 1)
+	if colors > 32 || bits > 16 || columns > pdfMaxStream {
+		return nil, fmt.Errorf("predictor parameters are damaged")
+	}
+	bpp := max(1, (colors*bits+7)/8)
+	rowLen := (colors*bits*columns + 7) / 8
+	if rowLen <= 0 || rowLen > pdfMaxStream {
+		return nil, fmt.Errorf("predictor parameters are damaged")
+	}
+	if predictor == 2 {
+		if bits != 8 {
+			return nil, fmt.Errorf("unsupported TIFF predictor with %d bits", bits)
+		}
+		for row := 0; row+rowLen <= len(data); row += rowLen {
+			for i := row + bpp; i < row+rowLen; i++ {
+				data[i] += data[i-bpp]
+			}
+		}
+		return data, nil
+	}
+	out := make([]byte, 0, len(data))
+	prev := make([]byte, rowLen)
+	for len(data) > 0 {
+		filter := data[0]
+		data = data[1:]
+		row := make([]byte, rowLen)
+		n := copy(row, data)
+		data = data[n:]
+		for i := range row {
+			var left, upLeft byte
+			if i >= bpp {
+				left, upLeft = row[i-bpp], prev[i-bpp]
+			}
+			up := prev[i]
+			switch filter {
+			case 1:
+				row[i] += left
+			case 2:
+				row[i] += up
+			case 3:
+				row[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				row[i] += paeth(left, up, upLeft)
+			}
+		}
+		out = append(out, row[:n]...)
+		prev = row
+	}
+	return out, nil
+}
+
+// paeth is the PNG Paeth predictor.
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	switch {
+	case pa <= pb && pa <= pc:
+		return a
+	case pb <= pc:
+		return b
+	}
+	return c
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// lzwDecode decompresses LZW data. The code width grows one code early
+// when earlyChange is 1, the default for PDF.
+func lzwDecode(data []byte, earlyChange int) ([]byte, error) {
+	out := []byte{}
+	table := make([][]byte, 258, 4096)
+	for i := 0; i < 256; i++ {
+		table[i] = []byte{byte(i)}
+	}
+	codeLen := 9
+	var prev []byte
+	bits, nbits := uint32(0), 0
+	for _, b := range data {
+		bits = bits<<8 | uint32(b)
+		nbits += 8
+		for nbits >= codeLen {
+			code := int(bits>>(nbits-codeLen)) & (1<<codeLen - 1)
+			nbits -= codeLen
+			switch {
+			case code == 256:
+				table, codeLen, prev = table[:258], 9, nil
+				continue
+			case code == 257:
+				return out, nil
+			}
+			var entry []byte
+			switch {
+			case code < len(table) && code != 256:
+				entry = table[code]
+			case code == len(table) && prev != nil:
+				entry = append(append([]byte{}, prev...), prev[0])
+			default:
+				return out, fmt.Errorf("LZW data is damaged")
+			}
+			if len(out)+len(entry) > pdfMaxStream {
+				return out, fmt.Errorf("LZW data is too large")
+			}
+			out = append(out, entry...)
+			if prev != nil && len(table) < 4096 {
+				table = append(table, append(append([]byte{}, prev...), entry[0]))
+			}
+			prev = entry
+			switch n := len(table) + earlyChange; {
+			case n >= 2048:
+				codeLen = 12
+			case n >= 1024:
+				codeLen = 11
+			case n >= 512:
+				codeLen = 10
+			default:
+				codeLen = 9
+			}
+		}
+	}
+	return out, nil
+}
+
+// runLengthDecode decompresses RunLengthDecode data.
+func runLengthDecode(data []byte) []byte {
+	out := []byte{}
+	for i := 0; i < len(data); {
+		n := int(data[i])
+		i++
+		switch {
+		case n < 128:
+			end := min(i+n+1, len(data))
+			out = append(out, data[i:end]...)
+			i = end
+		case n > 128 && i < len(data):
+			out = append(out, bytes.Repeat(data[i:i+1], 257-n)...)
+			i++
+		default:
+			return out
+		}
+	}
+	return out
+}
+
+// pdfPage is a page of the document with the resources it inherits.
+type pdfPage struct {
+	dict      pdfDict
+	resources pdfDict
+}
+
+// pages returns the pages of the document in order.
+func (doc *pdfDocument) pages() []*pdfPage {
+	pages := []*pdfPage{}
+	root := doc.resolveDict(doc.trailer["Root"])
+	seen := map[pdfRef]bool{}
+	var walk func(node any, resources pdfDict, depth int)
+	walk = func(node any, resources pdfDict, depth int) {
+		if ref, ok := node.(pdfRef); ok {
+			if seen[ref] {
+				return
+			}
+			seen[ref] = true
+		}
+		dict := doc.resolveDict(node)
+		if dict == nil || depth > pdfMaxDepth {
+			return
+		}
+		if r := doc.resolveDict(dict["Resources"]); r != nil {
+			resources = r
+		}
+		kids, ok := doc.resolve(dict["Kids"]).(pdfArray)
+		if !ok || dict["Type"] == pdfName("Page") {
+			pages = append(pages, &pdfPage{dict: dict, resources: resources})
+			return
+		}
+		for _, kid := range kids {
+			walk(kid, resources, depth+1)
+		}
+	}
+	if root != nil {
+		walk(root["Pages"], nil, 0)
+	}
+	if len(pages) == 0 {
+		pages = doc.findPages()
+	}
+	return pages
+}
+
+// findPages returns the pages of a document whose page tree is missing,
+// e.g. a truncated file, in the order of their object numbers.
+func (doc *pdfDocument) findPages() []*pdfPage {
+	nums := make([]int, 0, len(doc.xref))
+	for num := range doc.xref {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+	pages := []*pdfPage{}
+	for _, num := range nums {
+		dict, ok := doc.object(num).(pdfDict)
+		if !ok || dict["Type"] != pdfName("Page") {
+			continue
+		}
+		// The resources may be inherited from the page's parents
+		page := &pdfPage{dict: dict}
+		for node, depth := dict, 0; node != nil && page.resources == nil && depth < pdfMaxDepth; depth++ {
+			page.resources = doc.resolveDict(node["Resources"])
+			node = doc.resolveDict(node["Parent"])
+		}
+		pages = append(pages, page)
+	}
+	return pages
+}
+
+// contents returns a page's content streams joined together.
+func (doc *pdfDocument) contents(page pdfDict) []byte {
+	var streams pdfArray
+	switch c := doc.resolve(page["Contents"]).(type) {
+	case *pdfStream:
+		streams = pdfArray{c}
+	case pdfArray:
+		streams = c
+	}
+	out := []byte{}
+	for _, s := range streams {
+		if stream, ok := doc.resolve(s).(*pdfStream); ok {
+			// A damaged stream may still hold some of the text
+			data, _ := doc.streamData(stream)
+			out = append(append(out, data...), '\n')
+		}
+	}
+	return out
+}
+
+// ExtractPDF returns the text of a PDF document. Each page after the first
+// starts with a form feed so the page numbers can be reported. The text is
+// read from the pages' content streams in the order it is drawn, lines and
+// the spaces between words are found from the position of the text. A
+// scanned document without a text layer has no text, as has an encrypted
+// one. The document is held in memory, a file larger than pdfMaxFile is an
+// error.
+func ExtractPDF(ctx context.Context, r io.ReaderAt, size int64) (io.Reader, error) {
+	if size > pdfMaxFile {
+		return nil, fmt.Errorf("the PDF is larger than the %d MiB limit", pdfMaxFile>>20)
+	}
+	data, err := io.ReadAll(&ctxReader{ctx: ctx, r: io.NewSectionReader(r, 0, size)})
+	if err != nil {
+		return nil, err
+	}
+	doc, err := openPDF(data)
+	if err != nil {
+		return nil, err
+	}
+	if doc.trailer["Encrypt"] != nil {
+		return new(textBuffer), nil
+	}
+	pages := doc.pages()
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("the document has no pages")
+	}
+	buf := new(textBuffer)
+	for i, page := range pages {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			buf.WriteByte('\f')
+		}
+		pt := newPDFPageText(ctx, doc, buf)
+		if err := pt.run(doc.contents(page.dict), page.resources, 0); err != nil {
+			return nil, err
+		}
+		if pt.started {
+			buf.endLine()
+		}
+	}
+	return buf, nil
+}
+
+// pdfMatrix is a transformation matrix [a b c d e f].
+type pdfMatrix [6]float64
+
+var pdfIdentity = pdfMatrix{1, 0, 0, 1, 0, 0}
+
+// mul returns m × n.
+func (m pdfMatrix) mul(n pdfMatrix) pdfMatrix {
+	return pdfMatrix{
+		m[0]*n[0] + m[1]*n[2],
+		m[0]*n[1] + m[1]*n[3],
+		m[2]*n[0] + m[3]*n[2],
+		m[2]*n[1] + m[3]*n[3],
+		m[4]*n[0] + m[5]*n[2] + n[4],
+		m[4]*n[1] + m[5]*n[3] + n[5],
+	}
+}
+
+// pdfGraphicsState is the part of the graphics state used to place text.
+type pdfGraphicsState struct {
+	ctm       pdfMatrix
+	font      *pdfFont
+	fontSize  float64
+	charSpace float64
+	wordSpace float64
+	scale     float64
+	leading   float64
+	rise      float64
+}
+
+// pdfPageText writes the text of a page's content stream.
+type pdfPageText struct {
+	ctx   context.Context
+	doc   *pdfDocument
+	out   *textBuffer
+	state pdfGraphicsState
+	stack []pdfGraphicsState
+	tm    pdfMatrix
+	tlm   pdfMatrix
+	// started is set once the page has text, lastX and lastY are where
+	// the last glyph ended and lastSize its height
+	started  bool
+	lastX    float64
+	lastY    float64
+	lastDir  [2]float64
+	lastSize float64
+	space    bool
+}
+
+func newPDFPageText(ctx context.Context, doc *pdfDocument, out *textBuffer) *pdfPageText {
+	return &pdfPageText{
+		ctx:   ctx,
+		doc:   doc,
+		out:   out,
+		state: pdfGraphicsState{ctm: pdfIdentity, scale: 1},
+		tm:    pdfIdentity,
+		tlm:   pdfIdentity,
+	}
+}
+
+// pdfNumbers returns the operands as numbers, false if there are too few
+// or they aren't numbers.
+func pdfNumbers(operands []any, n int) ([]float64, bool) {
+	if len(operands) < n {
+		return nil, false
+	}
+	numbers := make([]float64, n)
+	for i, operand := range operands[len(operands)-n:] {
+		switch v := operand.(type) {
+		case int:
+			numbers[i] = float64(v)
+		case float64:
+			numbers[i] = v
+		default:
+			return nil, false
+		}
+	}
+	return numbers, true
+}
+
+// run interprets a content stream, stopping with the context's error when
+// it is done.
+func (pt *pdfPageText) run(data []byte, resources pdfDict, depth int) error {
+	lex := &pdfLexer{data: data, content: true}
+	operands := []any{}
+	for n := 0; ; n++ {
+		// Checking every operator would slow the extraction down
+		if n%1024 == 0 && pt.ctx.Err() != nil {
+			return pt.ctx.Err()
+		}
+		obj, err := lex.readObject()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			if lex.pos >= len(data) {
+				return nil
+			}
+			operands = operands[:0]
+			continue
+		}
+		op, ok := obj.(pdfKeyword)
+		if !ok {
+			if len(operands) < 64 {
+				operands = append(operands, obj)
+			}
+			continue
+		}
+		if err := pt.operator(string(op), operands, resources, depth, lex); err != nil {
+			return err
+		}
+		operands = operands[:0]
+	}
+}
+
+// operator carries out the operators which draw or place text.
+func (pt *pdfPageText) operator(op string, operands []any, resources pdfDict, depth int, lex *pdfLexer) error {
+	switch op {
+	case "q":
+		if len(pt.stack) < 256 {
+			pt.stack = append(pt.stack, pt.state)
+		}
+	case "Q":
+		if n := len(pt.stack); n > 0 {
+			pt.state, pt.stack = pt.stack[n-1], pt.stack[:n-1]
+		}
+	case "cm":
+		if n, ok := pdfNumbers(operands, 6); ok {
+			pt.state.ctm = pdfMatrix(n).mul(pt.state.ctm)
+		}
+	case "BT":
+		pt.tm, pt.tlm = pdfIdentity, pdfIdentity
+	case "Tf":
+		if len(operands) >= 2 {
+			if name, ok := operands[len(operands)-2].(pdfName); ok {
+				pt.state.font = pt.doc.font(resources, name)
+			}
+			if n, ok := pdfNumbers(operands, 1); ok {
+				pt.state.fontSize = n[0]
+			}
+		}
+	case "Tc":
+		if n, ok := pdfNumbers(operands, 1); ok {
+			pt.state.charSpace = n[0]
+		}
+	case "Tw":
+		if n, ok := pdfNumbers(operands, 1); ok {
+			pt.state.wordSpace = n[0]
+		}
+	case "Tz":
+		if n, ok := pdfNumbers(operands, 1); ok {
+			pt.state.scale = n[0] / 100
+		}
+	case "TL":
+		if n, ok := pdfNumbers(operands, 1); ok {
+			pt.state.leading = n[0]
+		}
+	case "Ts":
+		if n, ok := pdfNumbers(operands, 1); ok {
+			pt.state.rise = n[0]
+		}
+	case "Td":
+		if n, ok := pdfNumbers(operands, 2); ok {
+			pt.moveLine(n[0], n[1])
+		}
+	case "TD":
+		if n, ok := pdfNumbers(operands, 2); ok {
+			pt.state.leading = -n[1]
+			pt.moveLine(n[0], n[1])
+		}
+	case "Tm":
+		if n, ok := pdfNumbers(operands, 6); ok {
+			pt.tm, pt.tlm = pdfMatrix(n), pdfMatrix(n)
+		}
+	case "T*":
+		pt.moveLine(0, -pt.state.leading)
+	case "Tj":
+		if len(operands) > 0 {
+			if s, ok := operands[len(operands)-1].(pdfString); ok {
+				pt.show(s)
+			}
+		}
+	case "'":
+		pt.moveLine(0, -pt.state.leading)
+		if len(operands) > 0 {
+			if s, ok := operands[len(operands)-1].(pdfString); ok {
+				pt.show(s)
+			}
+		}
+	case "\"":
+		if len(operands) >= 3 {
+			if n, ok := pdfNumbers(operands[:len(operands)-1], 2); ok {
+				pt.state.wordSpace, pt.state.charSpace = n[0], n[1]
+			}
+			pt.moveLine(0, -pt.state.leading)
+			if s, ok := operands[len(operands)-1].(pdfString); ok {
+				pt.show(s)
+			}
+		}
+	case "TJ":
+		if len(operands) == 0 {
+			return nil
+		}
+		array, _ := operands[len(operands)-1].(pdfArray)
+		for _, item := range array {
+			switch v := item.(type) {
+			case pdfString:
+				pt.show(v)
+			case int, float64:
+				n, _ := pdfNumbers([]any{v}, 1)
+				tx := -n[0] / 1000 * pt.state.fontSize * pt.state.scale
+				pt.tm = pdfMatrix{1, 0, 0, 1, tx, 0}.mul(pt.tm)
+			}
+		}
+	case "Do":
+		if len(operands) > 0 && depth < 16 {
+			if name, ok := operands[len(operands)-1].(pdfName); ok {
+				return pt.form(name, resources, depth)
+			}
+		}
+	case "BI":
+		skipInlineImage(lex)
+	}
+	return nil
+}
+
+// moveLine starts a new line of text offset from the start of the
+// current line.
+func (pt *pdfPageText) moveLine(tx, ty float64) {
+	pt.tlm = pdfMatrix{1, 0, 0, 1, tx, ty}.mul(pt.tlm)
+	pt.tm = pt.tlm
+}
+
+// form draws a form XObject, text is often placed in forms.
+func (pt *pdfPageText) form(name pdfName, resources pdfDict, depth int) error {
+	xobjects := pt.doc.resolveDict(resources["XObject"])
+	stream, ok := pt.doc.resolve(xobjects[name]).(*pdfStream)
+	if !ok || stream.dict["Subtype"] != pdfName("Form") {
+		return nil
+	}
+	data, err := pt.doc.streamData(stream)
+	if err != nil && len(data) == 0 {
+		return nil
+	}
+	if r := pt.doc.resolveDict(stream.dict["Resources"]); r != nil {
+		resources = r
+	}
+	saved, tm, tlm := pt.state, pt.tm, pt.tlm
+	if m, ok := pt.doc.resolve(stream.dict["Matrix"]).(pdfArray); ok {
+		if n, ok := pdfNumbers(m, 6); ok {
+			pt.state.ctm = pdfMatrix(n).mul(pt.state.ctm)
+		}
+	}
+	err = pt.run(data, resources, depth+1)
+	pt.state, pt.tm, pt.tlm = saved, tm, tlm
+	return err
+}
+
+// skipInlineImage skips an inline image's parameters and data, "BI ...
+// ID data EI".
+func skipInlineImage(lex *pdfLexer) {
+	for {
+		token, err := lex.next()
+		if err != nil {
+			return
+		}
+		if token == pdfKeyword("ID") {
+			break
+		}
+	}
+	lex.pos++
+	// The data ends at "EI" between white space
+	for lex.pos < len(lex.data) {
+		i := bytes.Index(lex.data[lex.pos:], []byte("EI"))
+		if i < 0 {
+			lex.pos = len(lex.data)
+			return
+		}
+		end := lex.pos + i
+		lex.pos = end + 2
+		if (end == 0 || isPDFSpace(lex.data[end-1])) && (lex.pos >= len(lex.data) || isPDFDelimiter(lex.data[lex.pos])) {
+			return
+		}
+	}
+}
+
+// show writes the text of a string and moves past its glyphs.
+func (pt *pdfPageText) show(s pdfString) {
+	font := pt.state.font
+	if font == nil {
+		return
+	}
+	for len(s) > 0 {
+		code, n := font.nextCode(s)
+		s = s[n:]
+		text := font.text(code)
+		if text != "" {
+			pt.place(pdfMatrix{pt.state.fontSize * pt.state.scale, 0, 0, pt.state.fontSize, 0, pt.state.rise}.mul(pt.tm).mul(pt.state.ctm))
+			for _, r := range text {
+				pt.writeRune(r)
+			}
+		}
+		tx := font.width(code)*pt.state.fontSize + pt.state.charSpace
+		if n == 1 && code == 32 {
+			tx += pt.state.wordSpace
+		}
+		pt.tm = pdfMatrix{1, 0, 0, 1, tx * pt.state.scale, 0}.mul(pt.tm)
+		if text != "" {
+			end := pdfMatrix{pt.state.fontSize * pt.state.scale, 0, 0, pt.state.fontSize, 0, pt.state.rise}.mul(pt.tm).mul(pt.state.ctm)
+			pt.lastX, pt.lastY = end[4], end[5]
+		}
+	}
+}
+
+// place starts a line or adds a space when a glyph is drawn away from
+// where the last one ended. The offset is measured along and across the
+// baseline so rotated text is read too.
+func (pt *pdfPageText) place(trm pdfMatrix) {
+	size := math.Hypot(trm[2], trm[3])
+	dir := [2]float64{trm[0], trm[1]}
+	if l := math.Hypot(dir[0], dir[1]); l > 0 {
+		dir[0], dir[1] = dir[0]/l, dir[1]/l
+	}
+	if !pt.started {
+		pt.lastX, pt.lastY, pt.lastDir, pt.lastSize = trm[4], trm[5], dir, size
+		return
+	}
+	dx, dy := trm[4]-pt.lastX, trm[5]-pt.lastY
+	along := dx*pt.lastDir[0] + dy*pt.lastDir[1]
+	across := math.Abs(dy*pt.lastDir[0] - dx*pt.lastDir[1])
+	height := max(size, pt.lastSize)
+	switch {
+	case height == 0:
+	case across > 2.5*height:
+		pt.out.endParagraph()
+		pt.space = true
+	case across > 0.5*height || along < -2*height:
+		pt.out.endLine()
+		pt.space = true
+	case along > 0.2*height && !pt.space:
+		pt.out.WriteByte(' ')
+		pt.space = true
+	}
+	pt.lastX, pt.lastY, pt.lastDir, pt.lastSize = trm[4], trm[5], dir, size
+}
+
+// pdfLigatures are written as their letters so they match the patterns.
+var pdfLigatures = map[rune]string{
+	'\ufb00': "ff",
+	'\ufb01': "fi",
+	'\ufb02': "fl",
+	'\ufb03': "ffi",
+	'\ufb04': "ffl",
+	'\ufb05': "st",
+	'\ufb06': "st",
+}
+
+// writeRune writes a character of the text. Control characters, which
+// include the form feed separating pages, are written as a space.
+func (pt *pdfPageText) writeRune(r rune) {
+	pt.started = true
+	switch {
+	case r == '\ufffd' || r == 0:
+		return
+	case r == ' ' || r < 0x20 || (r >= 0x7f && r < 0xa0) || r == '\u00a0':
+		if !pt.space {
+			pt.out.WriteByte(' ')
+			pt.space = true
+		}
+		return
+	}
+	if s, ok := pdfLigatures[r]; ok {
+		pt.out.WriteString(s)
+	} else {
+		pt.out.WriteRune(r)
+	}
+	pt.space = false
+}
@@ -0,0 +1,263 @@
+package analysistools
+
+import (
+	"bytes"
+	"compress/lzw"
+	"compress/zlib"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// buildPDF returns a PDF file holding the objects, numbered from one, with
+// the first as its catalog.
+func buildPDF(objects ...string) []byte {
+	buf := bytes.NewBufferString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := []int{}
+	for i, obj := range objects {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(buf, "xref\n0 %d\n0000000000 65535 f\r\n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(buf, "%010d 00000 n\r\n", offset)
+	}
+	fmt.Fprintf(buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
+
+// pdfStreamObject returns a stream object, the data is compressed with
+// FlateDecode when flate is set.
+func pdfStreamObject(dict string, data string, flate bool) string {
+	if flate {
+		buf := new(bytes.Buffer)
+		zw := zlib.NewWriter(buf)
+		zw.Write([]byte(data))
+		zw.Close()
+		data = buf.String()
+		dict += " /Filter /FlateDecode"
+	}
+	return fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+}
+
+// memoPDF is a two page document. The first page uses a standard font and
+// draws some of its text in a form, the second is compressed and uses a
+// composite font with a ToUnicode map and a font with a Differences
+// encoding.
+func memoPDF() []byte {
+	toUnicode := `/CIDInit /ProcSet findresource begin
+12 dict begin
+begincmap
+1 begincodespacerange
+<0000> <FFFF>
+endcodespacerange
+3 beginbfchar
+<0005> <FB01>
+<0006> <006C>
+<0007> <0065>
+endbfchar
+1 beginbfrange
+<0002> <0004> <0061>
+endbfrange
+endcmap
+end end`
+	return buildPDF(
+		`<< /Type /Catalog /Pages 2 0 R >>`,
+		`<< /Type /Pages /Kids [3 0 R 8 0 R] /Count 2
+   /Resources << /Font << /F1 4 0 R /F2 5 0 R /F3 7 0 R >> /XObject << /X1 10 0 R >> >> >>`,
+		`<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 9 0 R >>`,
+		`<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>`,
+		`<< /Type /Font /Subtype /Type0 /BaseFont /Memo /Encoding /Identity-H /DescendantFonts [11 0 R] /ToUnicode 6 0 R >>`,
+		pdfStreamObject("", toUnicode, false),
+		`<< /Type /Font /Subtype /Type1 /BaseFont /Times-Roman /Encoding << /BaseEncoding /WinAnsiEncoding /Differences [65 /eacute] >> >>`,
+		`<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents [12 0 R] >>`,
+		pdfStreamObject("", `BT /F1 12 Tf 72 720 Td (The attorney) Tj 0 -14 Td [(client) -3000 (privilege)] TJ ET
+q 1 0 0 1 0 -100 cm /X1 Do Q`, false),
+		pdfStreamObject("/Type /XObject /Subtype /Form /BBox [0 0 612 792]", `BT /F1 12 Tf 72 700 Td (in a form) Tj ET`, false),
+		`<< /Type /Font /Subtype /CIDFontType2 /BaseFont /Memo /DW 1000 /W [5 [500 250] 2 4 500] >>`,
+		pdfStreamObject("", `BT /F2 10 Tf 1 0 0 1 100 500 Tm <000500060007> Tj 1 0 0 1 200 500 Tm <000400020003> Tj
+/F3 10 Tf 1 0 0 1 100 486 Tm (cafA) Tj ET`, true),
+	)
+}
+
+// scanPDF is a scanned page, an image without a text layer.
+func scanPDF() []byte {
+	return buildPDF(
+		`<< /Type /Catalog /Pages 2 0 R >>`,
+		`<< /Type /Pages /Kids [3 0 R] /Count 1 >>`,
+		`<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Resources << /XObject << /Im1 5 0 R >> >> /Contents 4 0 R >>`,
+		pdfStreamObject("", "q 612 0 0 792 0 0 cm /Im1 Do Q\nBI /W 2 /H 1 /CS /G /BPC 8 ID \x00(\xff EI Q", false),
+		pdfStreamObject("/Type /XObject /Subtype /Image /Width 1 /Height 1 /ColorSpace /DeviceGray /BitsPerComponent 8 /Filter /DCTDecode", "\xff\xd8\xff\xd9", false),
+	)
+}
+
+func TestExtractPDF(t *testing.T) {
+	memo := memoPDF()
+	// A damaged cross reference table is rebuilt from the objects
+	damaged := bytes.Replace(memo, []byte("startxref\n"), []byte("startxref\n9"), 1)
+	// An encrypted document isn't decrypted, it has no text
+	encrypted := bytes.Replace(memo, []byte("/Root 1 0 R"), []byte("/Root 1 0 R /Encrypt << /Filter /Standard /V 2 /R 3 >>"), 1)
+	tests := []struct {
+		name     string
+		src      []byte
+		expected string
+	}{
+		{name: "memo", src: memo, expected: "The attorney\nclient privilege\n\nin a form\n\ffile cab\ncafé\n"},
+		{name: "damaged", src: damaged, expected: "The attorney\nclient privilege\n\nin a form\n\ffile cab\ncafé\n"},
+		{name: "scan", src: scanPDF(), expected: ""},
+		{name: "encrypted", src: encrypted, expected: ""},
+	}
+	for _, test := range tests {
+		text, err := ExtractPDF(context.Background(), bytes.NewReader(test.src), int64(len(test.src)))
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		src, _ := io.ReadAll(text)
+		if string(src) != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.name, test.expected, src)
+		}
+	}
+	if _, err := ExtractPDF(context.Background(), strings.NewReader("%PDF-1.4\ntruncated"), 18); err == nil {
+		t.Errorf("expected an error for a PDF without pages")
+	}
+	if _, err := ExtractPDF(context.Background(), strings.NewReader("%PDF-1.4\n"), pdfMaxFile+1); err == nil {
+		t.Errorf("expected an error for a PDF over the size limit")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ExtractPDF(ctx, bytes.NewReader(memo), int64(len(memo))); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the extraction to be cancelled, got %v", err)
+	}
+
+	// A damaged document gives an error or what text could be read, the
+	// parser mustn't panic
+	for i := 0; i < len(memo); i += 7 {
+		damaged := append([]byte{}, memo...)
+		damaged[i] ^= 0x55
+		for _, src := range [][]byte{memo[:i], damaged} {
+			if text, err := ExtractPDF(context.Background(), bytes.NewReader(src), int64(len(src))); err == nil {
+				io.ReadAll(text)
+			}
+		}
+	}
+
+	// The tokens know the page they are on
+	tokens, err := TokenReader(strings.NewReader("The attorney\nclient privilege\n\nin a form\n\ffile cab\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file := tokens[7]; file.Value != "file" || file.PageNo != 2 || file.LineNo != 4 || file.Column != 0 {
+		t.Errorf("expected file on page 2 line 4 column 0, got %+v", file)
+	}
+	if tokens[0].PageNo != 1 {
+		t.Errorf("expected the first page to be 1, got %d", tokens[0].PageNo)
+	}
+}
+
+func TestPDFFilters(t *testing.T) {
+	src := bytes.Repeat([]byte("attorney client privilege "), 400)
+	buf := new(bytes.Buffer)
+	w := lzw.NewWriter(buf, lzw.MSB, 8)
+	w.Write(src)
+	w.Close()
+	doc := &pdfDocument{}
+	tests := []struct {
+		name  string
+		param pdfDict
+		data  []byte
+	}{
+		{name: "LZWDecode", param: pdfDict{"EarlyChange": 0}, data: buf.Bytes()},
+		{name: "ASCIIHexDecode", data: []byte("61 74 74\n6f726e6579 20636c69656e7420707269766\n96c656765 2>")},
+		{name: "ASCII85Decode", data: []byte("<~@<?U0Ec,H6+Cf5%ASuT4\nE,oZ9Bl%?nAKU~>")},
+		{name: "RunLengthDecode", data: []byte("\x00a\xfft\x16orney client privilege \x80")},
+	}
+	for _, test := range tests {
+		expected := "attorney client privilege "
+		if test.name == "LZWDecode" {
+			expected = string(src)
+		}
+		out, err := doc.decode(pdfName(test.name), test.param, test.data)
+		if err != nil || string(out) != expected {
+			t.Errorf("%s: expected %q, got %q %v", test.name, expected, out, err)
+		}
+	}
+
+	// PNG predictors, as used by cross reference streams
+	rows := []byte{2, 1, 2, 3, 2, 1, 1, 1, 1, 0, 0, 1}
+	out, err := doc.unpredict(pdfDict{"Predictor": 12, "Columns": 3}, rows)
+	if err != nil || !bytes.Equal(out, []byte{1, 2, 3, 2, 3, 4, 0, 0, 1}) {
+		t.Errorf("expected the rows to be restored, got %v %v", out, err)
+	}
+}
+
+func TestCheckPDF(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string][]byte{
+		"memo.pdf":  memoPDF(),
+		"scan.pdf":  scanPDF(),
+		"notes.txt": []byte("file notes\n"),
+	})
+	pattern, err := ParsePattern("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, workers := range []int{1, 3} {
+		noText := []string{}
+		options := &CheckOptions{Format: JSONLFormat, Workers: workers, NoText: func(fName string) error {
+			noText = append(noText, filepath.Base(fName))
+			return nil
+		}}
+		out := new(bytes.Buffer)
+		if err := checkDirectory(context.Background(), out, dir, []*Pattern{pattern}, nil, options); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(out.String(), `memo.pdf","line_no":4,"page_no":2,"pattern":"file","phrase":"file"`) ||
+			!strings.Contains(out.String(), `notes.txt","line_no":0,"page_no":1,`) {
+			t.Errorf("%d workers: expected matches on page 2 of memo.pdf and page 1 of notes.txt, got\n%s", workers, out)
+		}
+		if strings.Join(noText, ",") != "scan.pdf" {
+			t.Errorf("%d workers: expected scan.pdf to have no text, got %v", workers, noText)
+		}
+	}
+
+	// The results database records the pages and the documents without
+	// text
+	dbName := filepath.Join(t.TempDir(), "results.db")
+	err = recordRun(dbName, "check-directory", []string{"patterns.txt", dir}, []*Pattern{pattern}, func(run *ResultsRun) error {
+		return recordDirectory(context.Background(), run, dir, []*Pattern{pattern}, nil, &CheckOptions{NoText: func(string) error { return nil }})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite", dbName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	got := []string{}
+	rows, err := db.Query(`SELECT f.path, f.no_text, IFNULL(m.page_no, 0) FROM files f LEFT JOIN matches m USING (file_id) ORDER BY f.path`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			path           string
+			noText, pageNo int
+		)
+		if err := rows.Scan(&path, &noText, &pageNo); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, fmt.Sprintf("%s %d %d", filepath.Base(path), noText, pageNo))
+	}
+	if strings.Join(got, ",") != "memo.pdf 0 2,notes.txt 0 1,scan.pdf 1 0" {
+		t.Errorf("expected the pages and scan.pdf without text, got %v", got)
+	}
+}
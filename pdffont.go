@@ -0,0 +1,505 @@
+package analysistools
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/unicode/norm"
+)
+
+// pdfFont turns the codes of a font's strings into text and gives their
+// widths. The text of a code comes from the font's ToUnicode map, failing
+// that from its encoding. A code without text, e.g. a glyph of a
+// composite font without a ToUnicode map, is skipped.
+type pdfFont struct {
+	// codes splits a composite font's strings into codes, nil for a
+	// simple font whose codes are single bytes
+	codes     *pdfCMap
+	toUnicode *pdfCMap
+	encoding  *[256]string
+	widths    map[uint32]float64
+	// defaultWidth is the width of a code missing from widths
+	defaultWidth float64
+	// widthScale turns a width into text space, 1/1000 except for Type3
+	// fonts
+	widthScale float64
+}
+
+// pdfDefaultFont is used when a font is missing, e.g. from a damaged
+// file, most fonts encode the letters and digits as ASCII.
+var pdfDefaultFont = &pdfFont{encoding: &pdfStandardEncoding, defaultWidth: 500, widthScale: 0.001}
+
+// font returns a font from the resources by its name, the fonts are read
+// once.
+func (doc *pdfDocument) font(resources pdfDict, name pdfName) *pdfFont {
+	fonts := doc.resolveDict(resources["Font"])
+	obj := fonts[name]
+	ref, isRef := obj.(pdfRef)
+	if isRef {
+		if font, ok := doc.fonts[ref]; ok {
+			return font
+		}
+	}
+	dict := doc.resolveDict(obj)
+	if dict == nil {
+		return pdfDefaultFont
+	}
+	font := doc.newFont(dict)
+	if isRef {
+		doc.fonts[ref] = font
+	}
+	return font
+}
+
+// newFont reads a font dictionary.
+func (doc *pdfDocument) newFont(dict pdfDict) *pdfFont {
+	font := &pdfFont{widths: make(map[uint32]float64), widthScale: 0.001}
+	if stream, ok := doc.resolve(dict["ToUnicode"]).(*pdfStream); ok {
+		if data, err := doc.streamData(stream); err == nil || len(data) > 0 {
+			font.toUnicode = parseCMap(data)
+		}
+	}
+	subtype := doc.resolve(dict["Subtype"])
+	if subtype == pdfName("Type0") {
+		switch enc := doc.resolve(dict["Encoding"]).(type) {
+		case *pdfStream:
+			if data, err := doc.streamData(enc); err == nil || len(data) > 0 {
+				font.codes = parseCMap(data)
+			}
+		case pdfName:
+			if strings.HasPrefix(string(enc), "Identity-") || strings.Contains(string(enc), "UCS2") || strings.Contains(string(enc), "UTF16") {
+				font.codes = &pdfCMap{spaces: []pdfCodeSpace{{n: 2, lo: 0, hi: 0xffff}}}
+			}
+		}
+		if font.codes == nil || len(font.codes.spaces) == 0 {
+			font.codes = &pdfCMap{spaces: []pdfCodeSpace{{n: 2, lo: 0, hi: 0xffff}}}
+		}
+		// UCS-2 and UTF-16 encodings are their own text
+		if name, ok := doc.resolve(dict["Encoding"]).(pdfName); ok && font.toUnicode == nil && (strings.Contains(string(name), "UCS2") || strings.Contains(string(name), "UTF16")) {
+			font.toUnicode = &pdfCMap{unicode: true}
+		}
+		font.defaultWidth = 1000
+		if descendants, ok := doc.resolve(dict["DescendantFonts"]).(pdfArray); ok && len(descendants) > 0 {
+			doc.cidWidths(font, doc.resolveDict(descendants[0]))
+		}
+		return font
+	}
+
+	// A simple font, its codes are single bytes
+	base := &pdfStandardEncoding
+	if subtype == pdfName("TrueType") {
+		base = &pdfWinAnsiEncoding
+	}
+	var differences pdfArray
+	switch enc := doc.resolve(dict["Encoding"]).(type) {
+	case pdfName:
+		base = pdfBaseEncoding(enc, base)
+	case pdfDict:
+		if name, ok := doc.resolve(enc["BaseEncoding"]).(pdfName); ok {
+			base = pdfBaseEncoding(name, base)
+		}
+		differences, _ = doc.resolve(enc["Differences"]).(pdfArray)
+	}
+	if len(differences) > 0 {
+		encoding := *base
+		code := 0
+		for _, item := range differences {
+			switch v := doc.resolve(item).(type) {
+			case int:
+				code = v
+			case pdfName:
+				if code >= 0 && code < 256 {
+					encoding[code] = glyphText(string(v))
+				}
+				code++
+			}
+		}
+		base = &encoding
+	}
+	font.encoding = base
+
+	firstChar, _ := doc.resolve(dict["FirstChar"]).(int)
+	if widths, ok := doc.resolve(dict["Widths"]).(pdfArray); ok {
+		for i, w := range widths {
+			if n, ok := doc.resolveNumber(w); ok {
+				font.widths[uint32(firstChar+i)] = n
+			}
+		}
+	}
+	// Without widths, e.g. the standard 14 fonts, an average is used
+	font.defaultWidth = 500
+	if descriptor := doc.resolveDict(dict["FontDescriptor"]); descriptor != nil {
+		if n, ok := doc.resolveNumber(descriptor["MissingWidth"]); ok && n > 0 {
+			font.defaultWidth = n
+		}
+	}
+	if subtype == pdfName("Type3") {
+		if m, ok := doc.resolve(dict["FontMatrix"]).(pdfArray); ok && len(m) > 0 {
+			if n, ok := doc.resolveNumber(m[0]); ok {
+				font.widthScale = n
+				font.defaultWidth = 0.5 / n
+			}
+		}
+	}
+	return font
+}
+
+// cidWidths reads the widths of a composite font's descendant, the W
+// array lists "c [w1 w2 ...]" or "cFirst cLast w".
+func (doc *pdfDocument) cidWidths(font *pdfFont, cidFont pdfDict) {
+	if n, ok := doc.resolveNumber(cidFont["DW"]); ok {
+		font.defaultWidth = n
+	}
+	w, _ := doc.resolve(cidFont["W"]).(pdfArray)
+	for i := 0; i+1 < len(w); {
+		first, ok := doc.resolve(w[i]).(int)
+		if !ok || first < 0 {
+			return
+		}
+		if widths, ok := doc.resolve(w[i+1]).(pdfArray); ok {
+			for j, width := range widths {
+				if n, ok := doc.resolveNumber(width); ok {
+					font.widths[uint32(first+j)] = n
+				}
+			}
+			i += 2
+			continue
+		}
+		if i+2 >= len(w) {
+			return
+		}
+		last, ok1 := doc.resolve(w[i+1]).(int)
+		width, ok2 := doc.resolveNumber(w[i+2])
+		if !ok1 || !ok2 || last-first > 0xffff {
+			return
+		}
+		for j := 0; j <= last-first; j++ {
+			font.widths[uint32(first+j)] = width
+		}
+		i += 3
+	}
+}
+
+// nextCode returns the first code of a string and its length in bytes.
+func (font *pdfFont) nextCode(s []byte) (uint32, int) {
+	if font.codes == nil {
+		return uint32(s[0]), 1
+	}
+	return font.codes.nextCode(s)
+}
+
+// text returns the text of a code.
+func (font *pdfFont) text(code uint32) string {
+	if font.toUnicode != nil {
+		if text, ok := font.toUnicode.lookup(code); ok {
+			return text
+		}
+	}
+	if font.encoding != nil && code < 256 {
+		return font.encoding[code]
+	}
+	return ""
+}
+
+// width returns the width of a code in text space for a font size of one.
+func (font *pdfFont) width(code uint32) float64 {
+	if w, ok := font.widths[code]; ok {
+		return w * font.widthScale
+	}
+	return font.defaultWidth * font.widthScale
+}
+
+// pdfCodeSpace is a range of codes n bytes long.
+type pdfCodeSpace struct {
+	n      int
+	lo, hi uint32
+}
+
+// pdfCMap maps the codes of a font's strings to text. With unicode set
+// the codes are UTF-16 themselves.
+type pdfCMap struct {
+	spaces  []pdfCodeSpace
+	text    map[uint32]string
+	unicode bool
+}
+
+// nextCode returns the first code of a string and its length in bytes
+// from the code space ranges. A code outside them is the length of the
+// shortest range.
+func (cmap *pdfCMap) nextCode(s []byte) (uint32, int) {
+	shortest := 0
+	for _, space := range cmap.spaces {
+		if space.n > len(s) {
+			continue
+		}
+		code := uint32(0)
+		for _, b := range s[:space.n] {
+			code = code<<8 | uint32(b)
+		}
+		if code >= space.lo && code <= space.hi {
+			return code, space.n
+		}
+		if shortest == 0 || space.n < shortest {
+			shortest = space.n
+		}
+	}
+	if shortest == 0 {
+		shortest = min(len(s), 2)
+	}
+	code := uint32(0)
+	for _, b := range s[:shortest] {
+		code = code<<8 | uint32(b)
+	}
+	return code, shortest
+}
+
+// lookup returns the text of a code.
+func (cmap *pdfCMap) lookup(code uint32) (string, bool) {
+	if cmap.unicode {
+		return string(rune(code)), true
+	}
+	text, ok := cmap.text[code]
+	return text, ok
+}
+
+// pdfMaxRange limits the codes a range of a CMap may map.
+const pdfMaxRange = 0x10000
+
+// parseCMap reads the code space ranges and the bfchar and bfrange
+// mappings of a CMap, the rest of the program is ignored.
+func parseCMap(data []byte) *pdfCMap {
+	cmap := &pdfCMap{text: make(map[uint32]string)}
+	lex := &pdfLexer{data: data, content: true}
+	operands := []any{}
+	for {
+		obj, err := lex.readObject()
+		if err != nil {
+			if lex.pos >= len(data) {
+				break
+			}
+			continue
+		}
+		op, ok := obj.(pdfKeyword)
+		if !ok {
+			operands = append(operands, obj)
+			continue
+		}
+		switch op {
+		case "endcodespacerange":
+			for i := 0; i+1 < len(operands); i += 2 {
+				lo, ok1 := operands[i].(pdfString)
+				hi, ok2 := operands[i+1].(pdfString)
+				if ok1 && ok2 && len(lo) == len(hi) && len(lo) > 0 && len(lo) <= 4 {
+					cmap.spaces = append(cmap.spaces, pdfCodeSpace{n: len(lo), lo: cmapCode(lo), hi: cmapCode(hi)})
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				if src, ok := operands[i].(pdfString); ok && len(src) <= 4 {
+					cmap.text[cmapCode(src)] = cmapText(operands[i+1])
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, ok1 := operands[i].(pdfString)
+				hi, ok2 := operands[i+1].(pdfString)
+				if !ok1 || !ok2 || len(lo) > 4 || len(hi) > 4 {
+					continue
+				}
+				first, last := cmapCode(lo), cmapCode(hi)
+				if last < first || last-first >= pdfMaxRange {
+					continue
+				}
+				switch dst := operands[i+2].(type) {
+				case pdfString:
+					// The last UTF-16 unit is incremented for each code
+					units := cmapUnits(dst)
+					if len(units) == 0 {
+						continue
+					}
+					for j := uint32(0); j <= last-first; j++ {
+						u := append([]uint16{}, units...)
+						u[len(u)-1] += uint16(j)
+						cmap.text[first+j] = string(utf16.Decode(u))
+					}
+				case pdfArray:
+					for j, item := range dst[:min(len(dst), int(last-first)+1)] {
+						cmap.text[first+uint32(j)] = cmapText(item)
+					}
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+	return cmap
+}
+
+// cmapCode returns the code of a string of bytes.
+func cmapCode(s pdfString) uint32 {
+	code := uint32(0)
+	for _, b := range s {
+		code = code<<8 | uint32(b)
+	}
+	return code
+}
+
+// cmapUnits returns the UTF-16 units of a destination string.
+func cmapUnits(s pdfString) []uint16 {
+	if len(s) == 1 {
+		return []uint16{uint16(s[0])}
+	}
+	units := make([]uint16, 0, len(s)/2)
+	for i := 0; i+1 < len(s); i += 2 {
+		units = append(units, uint16(s[i])<<8|uint16(s[i+1]))
+	}
+	return units
+}
+
+// cmapText returns the text of a destination, a UTF-16 string or a glyph
+// name.
+func cmapText(obj any) string {
+	switch v := obj.(type) {
+	case pdfString:
+		return string(utf16.Decode(cmapUnits(v)))
+	case pdfName:
+		return glyphText(string(v))
+	}
+	return ""
+}
+
+// The base encodings of simple fonts.
+var (
+	pdfStandardEncoding = standardEncoding()
+	pdfWinAnsiEncoding  = charmapEncoding(charmap.Windows1252)
+	pdfMacRomanEncoding = charmapEncoding(charmap.Macintosh)
+)
+
+// pdfBaseEncoding returns an encoding by its name, def if it is unknown.
+func pdfBaseEncoding(name pdfName, def *[256]string) *[256]string {
+	switch name {
+	case "WinAnsiEncoding":
+		return &pdfWinAnsiEncoding
+	case "MacRomanEncoding":
+		return &pdfMacRomanEncoding
+	case "StandardEncoding":
+		return &pdfStandardEncoding
+	}
+	return def
+}
+
+// charmapEncoding returns the text of each byte of a character map.
+func charmapEncoding(cm *charmap.Charmap) [256]string {
+	encoding := [256]string{}
+	for i := 32; i < 256; i++ {
+		if r := cm.DecodeByte(byte(i)); r != '\ufffd' && r != 0x7f {
+			encoding[i] = string(r)
+		}
+	}
+	return encoding
+}
+
+// standardEncoding returns Adobe's standard encoding, ASCII with curly
+// quotes and the letters and symbols above 160.
+func standardEncoding() [256]string {
+	encoding := [256]string{}
+	for i := 32; i < 127; i++ {
+		encoding[i] = string(rune(i))
+	}
+	encoding['\''] = "’"
+	encoding['`'] = "‘"
+	high := map[byte]rune{
+		0xa1: '¡', 0xa2: '¢', 0xa3: '£', 0xa4: '⁄', 0xa5: '¥', 0xa6: 'ƒ', 0xa7: '§', 0xa8: '¤',
+		0xa9: '\'', 0xaa: '“', 0xab: '«', 0xac: '‹', 0xad: '›', 0xae: 'ﬁ', 0xaf: 'ﬂ',
+		0xb1: '–', 0xb2: '†', 0xb3: '‡', 0xb4: '·', 0xb6: '¶', 0xb7: '•', 0xb8: '‚', 0xb9: '„',
+		0xba: '”', 0xbb: '»', 0xbc: '…', 0xbd: '‰', 0xbf: '¿',
+		0xc1: '`', 0xc2: '´', 0xc3: 'ˆ', 0xc4: '˜', 0xc5: '¯', 0xc6: '˘', 0xc7: '˙', 0xc8: '¨',
+		0xca: '˚', 0xcb: '¸', 0xcd: '˝', 0xce: '˛', 0xcf: 'ˇ', 0xd0: '—',
+		0xe1: 'Æ', 0xe3: 'ª', 0xe8: 'Ł', 0xe9: 'Ø', 0xea: 'Œ', 0xeb: 'º',
+		0xf1: 'æ', 0xf5: 'ı', 0xf8: 'ł', 0xf9: 'ø', 0xfa: 'œ', 0xfb: 'ß',
+	}
+	for b, r := range high {
+		encoding[b] = string(r)
+	}
+	return encoding
+}
+
+// pdfGlyphNames are the Adobe glyph list names of the characters in the
+// base encodings other than the letters, whose names are themselves.
+var pdfGlyphNames = map[string]rune{
+	"space": ' ', "exclam": '!', "quotedbl": '"', "numbersign": '#', "dollar": '$', "percent": '%',
+	"ampersand": '&', "quotesingle": '\'', "parenleft": '(', "parenright": ')', "asterisk": '*',
+	"plus": '+', "comma": ',', "hyphen": '-', "period": '.', "slash": '/', "zero": '0', "one": '1',
+	"two": '2', "three": '3', "four": '4', "five": '5', "six": '6', "seven": '7', "eight": '8',
+	"nine": '9', "colon": ':', "semicolon": ';', "less": '<', "equal": '=', "greater": '>',
+	"question": '?', "at": '@', "bracketleft": '[', "backslash": '\\', "bracketright": ']',
+	"asciicircum": '^', "underscore": '_', "grave": '`', "braceleft": '{', "bar": '|',
+	"braceright": '}', "asciitilde": '~', "quoteleft": '‘', "quoteright": '’', "quotedblleft": '“',
+	"quotedblright": '”', "quotesinglbase": '‚', "quotedblbase": '„', "guillemotleft": '«',
+	"guillemotright": '»', "guilsinglleft": '‹', "guilsinglright": '›', "endash": '–',
+	"emdash": '—', "bullet": '•', "ellipsis": '…', "dagger": '†', "daggerdbl": '‡',
+	"periodcentered": '·', "paragraph": '¶', "section": '§', "perthousand": '‰', "trademark": '™',
+	"registered": '®', "copyright": '©', "degree": '°', "plusminus": '±', "multiply": '×',
+	"divide": '÷', "minus": '−', "fraction": '⁄', "exclamdown": '¡', "questiondown": '¿',
+	"cent": '¢', "sterling": '£', "yen": '¥', "currency": '¤', "florin": 'ƒ', "Euro": '€',
+	"brokenbar": '¦', "dieresis": '¨', "ordfeminine": 'ª', "ordmasculine": 'º', "logicalnot": '¬',
+	"macron": '¯', "acute": '´', "mu": 'µ', "cedilla": '¸', "onesuperior": '¹', "twosuperior": '²',
+	"threesuperior": '³', "onequarter": '¼', "onehalf": '½', "threequarters": '¾',
+	"circumflex": 'ˆ', "tilde": '˜', "breve": '˘', "dotaccent": '˙', "ring": '˚', "ogonek": '˛',
+	"caron": 'ˇ', "hungarumlaut": '˝', "dotlessi": 'ı', "germandbls": 'ß', "nbspace": '\u00a0',
+	"sfthyphen": '\u00ad', "AE": 'Æ', "ae": 'æ', "OE": 'Œ', "oe": 'œ', "Oslash": 'Ø', "oslash": 'ø',
+	"Lslash": 'Ł', "lslash": 'ł', "Eth": 'Ð', "eth": 'ð', "Thorn": 'Þ', "thorn": 'þ',
+	"fi": 'ﬁ', "fl": 'ﬂ', "ff": 'ﬀ', "ffi": 'ﬃ', "ffl": 'ﬄ',
+}
+
+// pdfAccents are the suffixes of the names of accented letters, e.g.
+// "eacute".
+var pdfAccents = map[string]rune{
+	"acute": '\u0301', "grave": '\u0300', "circumflex": '\u0302', "dieresis": '\u0308',
+	"tilde": '\u0303', "ring": '\u030a', "cedilla": '\u0327', "caron": '\u030c',
+}
+
+// glyphText returns the text of a glyph name, e.g. "A", "eacute",
+// "uni00E9", "f_i" or "one.oldstyle", empty if it isn't known.
+func glyphText(name string) string {
+	if i := strings.IndexByte(name, '.'); i > 0 {
+		name = name[:i]
+	}
+	if strings.Contains(name, "_") {
+		var text strings.Builder
+		for _, part := range strings.Split(name, "_") {
+			text.WriteString(glyphText(part))
+		}
+		return text.String()
+	}
+	if r, ok := pdfGlyphNames[name]; ok {
+		return string(r)
+	}
+	if len(name) == 1 && (name[0] >= 'a' && name[0] <= 'z' || name[0] >= 'A' && name[0] <= 'Z') {
+		return name
+	}
+	if hexText, ok := strings.CutPrefix(name, "uni"); ok && len(hexText) >= 4 && len(hexText)%4 == 0 {
+		units := []uint16{}
+		for i := 0; i < len(hexText); i += 4 {
+			n, err := strconv.ParseUint(hexText[i:i+4], 16, 16)
+			if err != nil {
+				return ""
+			}
+			units = append(units, uint16(n))
+		}
+		return string(utf16.Decode(units))
+	}
+	if hexText, ok := strings.CutPrefix(name, "u"); ok && len(hexText) >= 4 && len(hexText) <= 6 {
+		if n, err := strconv.ParseUint(hexText, 16, 32); err == nil && n <= 0x10ffff {
+			return string(rune(n))
+		}
+	}
+	// An accented letter, composed so it compares as it is usually typed
+	if len(name) > 1 && (name[0] >= 'a' && name[0] <= 'z' || name[0] >= 'A' && name[0] <= 'Z') {
+		if accent, ok := pdfAccents[name[1:]]; ok {
+			return norm.NFC.String(name[:1] + string(accent))
+		}
+	}
+	return ""
+}
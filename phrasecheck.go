@@ -2,16 +2,21 @@ package analysistools
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"io/fs"
+	"math"
 	"os"
-	"path"
 	"path/filepath"
 	//"regexp"
-	"strconv"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 )
 
 // PatternType represents the type of pattern.
@@ -19,16 +24,55 @@ type PatternType string
 
 const (
 	Keyword   PatternType = "keyword"
+	Phrase    PatternType = "phrase"
 	Proximity PatternType = "proximity"
+	Boolean   PatternType = "boolean"
 )
 
-// Matched patterns
+// Matched patterns, the positions are those of the first token matched
+// except EndOffset and EndColumn which are the end of the last token.
 type Matched struct {
 	Text string
 	Pattern string
 	PatternType PatternType
 	LineNo int
+	PageNo int
 	WordNo int
+	Column int
+	EndColumn int
+	StartOffset int
+	EndOffset int
+	Before string
+	After string
+	// Proximity matches also report where the second keyword was found
+	// and the distance in words between the keywords.
+	Keyword2Text string
+	Keyword2LineNo int
+	Keyword2WordNo int
+	Distance int
+}
+
+// KWIC returns the matched text in its context, the keyword in context, with
+// the matched text marked, e.g. "the client's [[attorney]] filed a".
+func (m *Matched) KWIC() string {
+	return strings.TrimSpace(fmt.Sprintf("%s [[%s]] %s", m.Before, m.Text, m.After))
+}
+
+// newMatched reports a pattern matching a run of tokens.
+func newMatched(pattern *Pattern, span []*Token) *Matched {
+	first, last := span[0], span[len(span)-1]
+	return &Matched{
+		Text: spanText(span),
+		Pattern: pattern.OriginalText,
+		PatternType: pattern.Type,
+		LineNo: first.LineNo,
+		PageNo: first.PageNo,
+		WordNo: first.WordNo,
+		Column: first.Column,
+		EndColumn: last.EndColumn,
+		StartOffset: first.StartOffset,
+		EndOffset: last.EndOffset,
+	}
 }
 
 func (m *Matched) String() string {
@@ -49,54 +93,102 @@ type Pattern struct {
 	Keyword1     string
 	Keyword2     string
 	MaxDistance  int
+	Scope        ProximityScope
+	Ordered      bool
+	Exclude      bool
+	Terms        []string
+	Expr         Expr
+	Normalization Normalization
 	OriginalText string
 }
 
-// ParsePattern parses a pattern into its components.
+// ParsePattern parses a pattern into its components. A single word is a
+// keyword pattern, "KEYWORD w/N KEYWORD" is a proximity pattern and any other
+// run of words is treated as an exact phrase, e.g. "attorney client privilege".
+// Proximity patterns may also use pre/N for an ordered match, w/s and w/p
+// to match in the same sentence or paragraph and "not w/N" or "not pre/N"
+// to exclude keywords found near the second keyword. Patterns
+// using AND, OR, NOT or parentheses are parsed as boolean expressions.
+// A pattern may start with "(?flags)" to normalize its terms, see
+// ParseNormalizationFlags, e.g. "(?i)attorn*".
 func ParsePattern(pattern string) (*Pattern, error) {
 	pattern = strings.TrimSpace(pattern)
+	flags, expr := splitPatternFlags(pattern)
+	normalization, err := ParseNormalizationFlags(flags)
+	if err != nil {
+		return nil, fmt.Errorf("%s in pattern: %q", err, pattern)
+	}
+	p, err := parsePattern(expr)
+	if err != nil {
+		return nil, err
+	}
+	p.OriginalText = pattern
+	p.ApplyNormalization(normalization)
+	return p, nil
+}
+
+// parsePattern parses a pattern without its flags.
+func parsePattern(pattern string) (*Pattern, error) {
 	parts := strings.Fields(pattern)
 	if len(parts) == 0 {
 		return nil, fmt.Errorf("missing pattern")
 	}
-	if len(parts) > 3 {
-		return nil, fmt.Errorf("malformed proximity pattern: %q", pattern)
-	}
 	// Setup the first keyword in pattern
 	p := &Pattern{}
 	p.OriginalText = pattern
 	p.Type = Keyword
 	token := parts[0]
-	if strings.HasPrefix(token, "w/") {
+	if isProximityOperator(token) {
 		return nil, fmt.Errorf("malformed proximity pattern: %q", pattern)
 	}
-	p.Keyword1 = token
 	if len(parts) == 1 {
+		p.Keyword1 = token
 		return p, nil
 	}
-	// We have a proximity pattern so set that up.
-	token = parts[1]
-	p.Type = Proximity
-	if len(parts) == 2 {
-		p.Keyword2 = token
-		if strings.HasPrefix(token, "w/") {
-			return nil, fmt.Errorf("malformed proximity pattern: %q", pattern)
-		}
-		p.MaxDistance = 1
+	// Proximity pattern: e.g., "attorn* w/5 client*" or "law not w/3 school"
+	op, n, err := parseProximityOperator(parts[1:], pattern)
+	if err != nil {
+		return nil, err
+	}
+	if n > 0 && len(parts) == n+2 && !isOperator(parts[0]) && !isOperator(parts[n+1]) {
+		p.Type = Proximity
+		p.Keyword1 = parts[0]
+		p.Keyword2 = parts[n+1]
+		p.MaxDistance = op.maxDistance
+		p.Scope = op.scope
+		p.Ordered = op.ordered
+		p.Exclude = op.exclude
 		return p, nil
-	}	
-	// Proximity pattern: e.g., "attorn* w/5 client*"
-	p.Keyword2 = parts[2]
-	if strings.HasPrefix(parts[1], "w/") {
-		maxDistance, err := strconv.Atoi(parts[1][2:])
+	}
+	if isBooleanPattern(parts) {
+		expr, err := ParseExpression(pattern)
 		if err != nil {
-			return nil, fmt.Errorf("invalid max distance in pattern: %q", pattern)
+			return nil, err
+		}
+		p.Type = Boolean
+		p.Expr = expr
+		return p, nil
+	}
+	// Phrase pattern: e.g., "attorney client privilege"
+	for _, part := range parts {
+		if isProximityOperator(part) {
+			return nil, fmt.Errorf("malformed proximity pattern: %q", pattern)
 		}
-		p.MaxDistance = maxDistance
 	}
+	p.Type = Phrase
+	p.Terms = parts
 	return p, nil
 }
 
+// ApplyNormalization merges a normalization into the pattern's own. It is
+// used to apply a run wide option such as case folding to loaded patterns.
+func (p *Pattern) ApplyNormalization(n Normalization) {
+	p.Normalization = p.Normalization.Merge(n)
+	if p.Expr != nil {
+		normalizeExpr(p.Expr, n)
+	}
+}
+
 // LoadPatterns loads patterns from a file, one per line.
 func LoadPatterns(patternFile string) ([]*Pattern, error) {
 	file, err := os.Open(patternFile)
@@ -145,26 +237,106 @@ func tokenMatches(s string, expr string) bool {
 	}
 }
 
-// CheckProximity checks if keyword2 appears within maxDistance words after keyword1.
+// CheckProximity checks if keyword2 appears within maxDistance words of
+// keyword1, before or after it. It returns the first keyword1 token found.
 func CheckProximity(tokens []*Token, keyword1 string, keyword2 string, maxDistance int) (*Token, bool) {
-	result := &Token{}
-	// Make a copy to iterate through
-	for i, token := range tokens {
-		if tokenMatches(token.Value, keyword1)  {
-			result = token
-			// Look ahead to find the next match based on max distance
-			end := i + maxDistance + 1
-			if end > len(tokens) {
-				end = len(tokens)
-			}
-			for j := i + 1; j < end; j++ {
-				if tokenMatches(tokens[j].Value, keyword2) {
-					return result, true
-				}
+	return checkProximity(tokens, keyword1, keyword2, Normalization{}, &proximityOperator{maxDistance: maxDistance})
+}
+
+// CheckProximityScope checks if keyword2 appears in the same sentence or
+// paragraph as keyword1. It returns the first keyword1 token found.
+func CheckProximityScope(tokens []*Token, keyword1 string, keyword2 string, scope ProximityScope) (*Token, bool) {
+	return checkProximity(tokens, keyword1, keyword2, Normalization{}, &proximityOperator{scope: scope})
+}
+
+// CheckPrecedes checks if keyword2 appears within maxDistance words after
+// keyword1. It returns the first keyword1 token found.
+func CheckPrecedes(tokens []*Token, keyword1 string, keyword2 string, maxDistance int) (*Token, bool) {
+	return checkProximity(tokens, keyword1, keyword2, Normalization{}, &proximityOperator{maxDistance: maxDistance, ordered: true})
+}
+
+// CheckNotProximity checks for a keyword1 which does not have keyword2
+// within maxDistance words. If ordered is true only the words after keyword1
+// are considered. It returns the first keyword1 token found.
+func CheckNotProximity(tokens []*Token, keyword1 string, keyword2 string, maxDistance int, ordered bool) (*Token, bool) {
+	return checkProximity(tokens, keyword1, keyword2, Normalization{}, &proximityOperator{maxDistance: maxDistance, ordered: ordered, exclude: true})
+}
+
+func checkProximity(tokens []*Token, keyword1 string, keyword2 string, n Normalization, op *proximityOperator) (*Token, bool) {
+	matches := proximityMatches(termSpans(tokens, []string{keyword1}, n), termSpans(tokens, []string{keyword2}, n), op)
+	if len(matches) == 0 {
+		return nil, false
+	}
+	return matches[0].Span[0], true
+}
+
+// FindProximity returns every occurrence of a proximity pattern. Each pair
+// of keywords in range is returned, for an exclusion such as "law not w/3
+// school" each keyword1 found without keyword2 is returned.
+func FindProximity(tokens []*Token, pattern *Pattern) []*ProximityMatch {
+	left := termSpans(tokens, []string{pattern.Keyword1}, pattern.Normalization)
+	right := termSpans(tokens, []string{pattern.Keyword2}, pattern.Normalization)
+	return proximityMatches(left, right, pattern.operator())
+}
+
+// operator returns the proximity operator of a proximity pattern.
+func (p *Pattern) operator() *proximityOperator {
+	return &proximityOperator{
+		maxDistance: p.MaxDistance,
+		scope:       p.Scope,
+		ordered:     p.Ordered,
+		exclude:     p.Exclude,
+	}
+}
+
+// CheckPhrase returns each run of consecutive tokens where every token matches
+// the corresponding term. Terms may use the same wildcards as keywords.
+func CheckPhrase(tokens []*Token, terms []string) [][]*Token {
+	return checkPhrase(tokens, terms, Normalization{})
+}
+
+func checkPhrase(tokens []*Token, terms []string, n Normalization) [][]*Token {
+	spans := [][]*Token{}
+	if len(terms) == 0 {
+		return spans
+	}
+	for i := 0; i+len(terms) <= len(tokens); i++ {
+		matched := true
+		for j, term := range terms {
+			// The tokens may be a subset of the text so check they are consecutive words
+			if !termMatches(tokens[i+j].Value, term, n) || tokens[i+j].WordNo != tokens[i].WordNo+j {
+				matched = false
+				break
 			}
 		}
+		if matched {
+			spans = append(spans, tokens[i:i+len(terms)])
+		}
 	}
-	return nil, false
+	return spans
+}
+
+// KeywordInContext returns up to width words before and after a span of
+// tokens. The words are returned as written in the text separated by
+// spaces.
+func KeywordInContext(tokens []*Token, span []*Token, width int) (string, string) {
+	start := sort.Search(len(tokens), func(i int) bool {
+		return tokens[i].WordNo >= span[0].WordNo
+	})
+	end := start + len(span)
+	before := tokens[max(0, start-width):start]
+	after := tokens[min(end, len(tokens)):min(end+width, len(tokens))]
+	return spanText(before), spanText(after)
+}
+
+// spanText joins a run of tokens into a single string as they were
+// written in the text.
+func spanText(span []*Token) string {
+	values := make([]string, len(span))
+	for i, token := range span {
+		values[i] = token.Raw
+	}
+	return strings.Join(values, " ")
 }
 
 // PharseCheck takes a string, patterns and a matchOne boolean and returns
@@ -174,107 +346,475 @@ func PhraseCheck(s string, patterns []*Pattern, matchOne bool) ([]*Matched, erro
 	return PhraseCheckReader(in, patterns, matchOne)
 }
 
+// CheckOptions holds the options used when checking a document.
+type CheckOptions struct {
+	// MatchOne reports only the matches of the first pattern, in the order
+	// given, which matched. A stream stops at the first match found.
+	MatchOne bool
+	// StreamOrder reports each file's matches in the order they are found
+	// in the text rather than grouped by pattern.
+	StreamOrder bool
+	// Mode selects how the document is split into words.
+	Mode TokenizerMode
+	// Context is the number of words before and after a match to report.
+	Context int
+	// Workers is the number of files check-directory checks at once.
+	Workers int
+	// FileTimeout limits the time spent checking a single document.
+	FileTimeout time.Duration
+	// Filter limits the files check-directory checks.
+	Filter *FileFilter
+	// Format selects the report format, CSV when empty.
+	Format OutputFormat
+	// NoText is called with each document which has no extractable text,
+	// e.g. a scanned PDF needing OCR. When nil they are noted on standard
+	// error.
+	NoText func(fName string) error
+}
+
+// ErrPartialResults is wrapped by the errors returned when a check or walk
+// is cancelled or times out. The results found up to then are returned
+// along with the error.
+var ErrPartialResults = errors.New("cancelled before completion, results are partial")
+
+// partialResults wraps the reason a check or walk stopped early.
+func partialResults(err error) error {
+	return fmt.Errorf("%w: %w", ErrPartialResults, err)
+}
+
+// runContext returns the context for an action limited to the timeout if
+// it is more than zero.
+func runContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(context.Background(), timeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
 // PhraseCheckReader evaluates the input from an io.Reader for all patterns.
 func PhraseCheckReader(reader io.Reader, patterns []*Pattern, matchOne bool) ([]*Matched, error) {
-	result := []*Matched{}
-	tokens, err := TokenReader(reader)
-	if err != nil {
-		return nil, err
-	}
-	for _, pattern := range patterns {
-		switch pattern.Type {
-		case Keyword:
-			for _, token := range tokens {
-				if tokenMatches(token.Value, pattern.Keyword1) {
-					result = append(result, &Matched{
-						Text: token.Value,
-						Pattern: pattern.OriginalText,
-						LineNo: token.LineNo,
-					})
-				}
-			}
-		case Proximity:
-			if token, ok := CheckProximity(tokens, pattern.Keyword1, pattern.Keyword2, pattern.MaxDistance); ok {
-				result = append(result, &Matched{
-					Text: token.Value,
-					Pattern: pattern.OriginalText,
-					LineNo: token.LineNo,
-				})
-			}
-		}
-		if matchOne && len(result) > 0 {
-			return result, nil
-		}
-	}
-	return result, nil
+	return PhraseCheckReaderWithOptions(reader, patterns, &CheckOptions{MatchOne: matchOne})
+}
+
+// PhraseCheckReaderWithOptions evaluates the input from an io.Reader for all
+// patterns using the check options. The matches are grouped by pattern in
+// the order the patterns are given. See PhraseCheckStream to handle the
+// matches as they are found.
+func PhraseCheckReaderWithOptions(reader io.Reader, patterns []*Pattern, options *CheckOptions) ([]*Matched, error) {
+	return NewMatcher(patterns).Check(reader, options)
+}
+
+// PhraseCheckReaderContext is PhraseCheckReaderWithOptions stopping when the
+// context is done. The matches found up to then are returned along with an
+// error wrapping ErrPartialResults and the context's error.
+func PhraseCheckReaderContext(ctx context.Context, reader io.Reader, patterns []*Pattern, options *CheckOptions) ([]*Matched, error) {
+	return NewMatcher(patterns).CheckContext(ctx, reader, options)
 }
 
 type PhraseCheckApp struct {
 	appName string
 }
 
-const phraseCheckCSVHeader = "\"filename\",\"line no\",\"pattern\",\"phrase\""
+// newCheckWriter starts the report for the check actions.
+func newCheckWriter(out io.Writer, options *CheckOptions) (RecordWriter, error) {
+	header := []string{"filename", "line no", "page no", "pattern", "phrase", "word no", "column", "end column", "start offset", "end offset", "keyword 2", "keyword 2 line no", "distance"}
+	if options.Context > 0 {
+		header = append(header, "context")
+	}
+	return NewRecordWriter(out, options.Format, append(header, "error"))
+}
+
+// writeMatch writes a match as a row of the check report.
+func writeMatch(w RecordWriter, fName string, match *Matched, options *CheckOptions) error {
+	values := []any{fName, match.LineNo, match.PageNo, match.Pattern, match.Text, match.WordNo, match.Column, match.EndColumn, match.StartOffset, match.EndOffset, nil, nil, nil}
+	if match.Keyword2Text != "" {
+		values[10], values[11], values[12] = match.Keyword2Text, match.Keyword2LineNo, match.Distance
+	}
+	if options.Context > 0 {
+		values = append(values, match.KWIC())
+	}
+	return w.Write(append(values, nil)...)
+}
+
+// writeFileError writes a row holding the error of a file whose check
+// couldn't be completed, e.g. one wrapping ErrBooleanLimit.
+func writeFileError(w RecordWriter, fName string, err error, options *CheckOptions) error {
+	values := make([]any, 13, 15)
+	values[0] = fName
+	if options.Context > 0 {
+		values = append(values, nil)
+	}
+	return w.Write(append(values, err.Error())...)
+}
+
+// errNoText is returned by checkFile for a document with no extractable
+// text, see reportNoText.
+var errNoText = errors.New("no extractable text")
+
+// fileContext returns the context for checking a single file, it is done
+// when options.FileTimeout passes.
+func fileContext(ctx context.Context, options *CheckOptions) (context.Context, context.CancelFunc) {
+	if options.FileTimeout > 0 {
+		return context.WithTimeout(ctx, options.FileTimeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// skipExtractError reports a document whose text can't be extracted and
+// returns nil so it is skipped. An extraction stopped by the context
+// returns its error.
+func skipExtractError(fName string, err error) error {
+	if errors.Is(err, ErrPartialResults) {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "skipping %s: %s\n", fName, err)
+	return nil
+}
+
+// fileErrors keeps the errors of the files whose check couldn't be
+// completed but whose matches were reported, i.e. those wrapping
+// ErrBooleanLimit. The walk goes on and the action fails once it is done.
+type fileErrors struct {
+	last  error
+	count int
+}
+
+// keep keeps a file's ErrBooleanLimit error and returns nil, other errors
+// are returned.
+func (fe *fileErrors) keep(fName string, err error) error {
+	if errors.Is(err, ErrBooleanLimit) {
+		fe.last = fmt.Errorf("%s: %w", fName, err)
+		fe.count++
+		return nil
+	}
+	return err
+}
+
+// result returns the walk's error or, when it is nil, the last file error
+// kept.
+func (fe *fileErrors) result(err error) error {
+	switch {
+	case err != nil || fe.count == 0:
+		return err
+	case fe.count > 1:
+		return fmt.Errorf("%w (%d files in all)", fe.last, fe.count)
+	}
+	return fe.last
+}
+
+// checkText calls emit for each match in the text grouped by pattern, as
+// Matcher.Check returns them, or with options.StreamOrder as each is found.
+func checkText(ctx context.Context, matcher *Matcher, text io.Reader, options *CheckOptions, emit func(*Matched) error) error {
+	if options.StreamOrder {
+		return matcher.StreamContext(ctx, text, options, emit)
+	}
+	matches, err := matcher.CheckContext(ctx, text, options)
+	for _, match := range matches {
+		if emitErr := emit(match); emitErr != nil {
+			return emitErr
+		}
+	}
+	return err
+}
 
-// checkFile will read a file stream and display matches to standard out and return any errors
-func checkFile(fName string, patterns []*Pattern, matchOne bool) error {
+// checkFile will read a file stream calling emit for each match and return any errors.
+// The text of documents such as .docx files is extracted first, see DefaultExtractors.
+// A document whose text can't be extracted is reported and skipped, one without any
+// text returns errNoText. options.FileTimeout covers the extraction and the check.
+func checkFile(ctx context.Context, fName string, matcher *Matcher, options *CheckOptions, emit func(*Matched) error) error {
+	ctx, cancel := fileContext(ctx, options)
+	defer cancel()
 	in, err := os.Open(fName)
 	if err != nil {
 		return err
 	}
 	defer in.Close()
-	matches, err := PhraseCheckReader(bufio.NewReader(in), patterns, matchOne)
+	text, doc, err := extractText(ctx, in)
 	if err != nil {
-		return err
+		return skipExtractError(fName, err)
 	}
-	for _, match := range matches {
-		fmt.Printf("%q,%s\n", fName, match.String())
+	err = checkText(ctx, matcher, text, options, emit)
+	if err == nil && doc != nil && !doc.hasText {
+		return errNoText
+	}
+	return err
+}
+
+// reportNoText reports a document without extractable text through
+// options.NoText or, when it is nil, on standard error.
+func reportNoText(fName string, options *CheckOptions) error {
+	if options.NoText != nil {
+		return options.NoText(fName)
 	}
+	fmt.Fprintf(os.Stderr, "no text in %s, it may need OCR\n", fName)
 	return nil
 }
 
-// checkDirectory takes an initial path, a set of pattens and optional exclude list and
-// walks the directory and reports matches for any text files found.
-func checkDirectory(startDir string, patterns []*Pattern, excludeList []string, matchOne bool) error {
+// openNoTextReport creates a report of the documents without extractable
+// text and sets options.NoText to add them to it. The function returned
+// closes the report keeping the first error.
+func openNoTextReport(fName string, options *CheckOptions) (func(error) error, error) {
+	out, err := os.Create(fName)
+	if err != nil {
+		return nil, err
+	}
+	w, err := NewRecordWriter(out, options.Format, []string{"filename", "mime type", "size"})
+	if err != nil {
+		out.Close()
+		return nil, err
+	}
+	options.NoText = func(path string) error {
+		var size int64
+		if info, err := os.Stat(path); err == nil {
+			size = info.Size()
+		}
+		return w.Write(path, mimeTypeOf(filepath.Ext(path)), size)
+	}
+	return func(err error) error {
+		err = closeRecords(w, err)
+		if closeErr := out.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+		return err
+	}, nil
+}
+
+// walkFiles walks a directory and calls fn for each file not in the exclude
+// list which passes the filter. The exclude list entries use gitignore
+// syntax, see ExcludeList. The filter may be nil. Errors reading the
+// directory are reported and the walk continues. If the context is done the
+// walk stops returning an ErrPartialResults error.
+func walkFiles(ctx context.Context, startDir string, excludeList []string, filter *FileFilter, fn func(path string) error) error {
 	var lastErr error
 
-	fmt.Println(phraseCheckCSVHeader)
-	err := filepath.WalkDir(startDir, func(path string, d fs.DirEntry, err error) error {
+	exclude, err := newWalkExcludeList(startDir, excludeList)
+	if err != nil {
+		return err
+	}
+	err = filepath.WalkDir(startDir, func(path string, d fs.DirEntry, err error) error {
+		if ctx.Err() != nil {
+			return partialResults(ctx.Err())
+		}
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "skipping %+v: %s\n", d.Type(), err)
-            lastErr = err
-            return nil
+			fmt.Fprintf(os.Stderr, "skipping %s: %s\n", path, err)
+			lastErr = err
+			return nil
 		}
-		// Skip if it's a directory and in the exclude list
-		if d.IsDir() {
-			for _, exclude := range excludeList {
-				if strings.Contains(path, exclude) {
-					return filepath.SkipDir
-				}
+		// Skip the file or directory if it is in the exclude list
+		if rel, err := filepath.Rel(startDir, path); err == nil && (exclude.Excluded(filepath.ToSlash(rel), d.IsDir()) || exclude.excludedFullPath(filepath.ToSlash(rel))) {
+			if d.IsDir() {
+				return filepath.SkipDir
 			}
 			return nil
 		}
-
-		// Skip if the file is in the exclude list
-		for _, exclude := range excludeList {
-			if strings.Contains(path, exclude) {
-				return nil
+		if d.IsDir() {
+			return nil
+		}
+		if ok, err := filter.Include(path, d); !ok {
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "skipping %s: %s\n", path, err)
+				lastErr = err
 			}
+			return nil
 		}
-		return checkFile(path, patterns, matchOne)
+		return fn(path)
 	})
 	if lastErr != nil {
 		if err != nil {
-	    	return fmt.Errorf("%s\n%s\n", lastErr, err)
-			
+			return fmt.Errorf("%s\n%w\n", lastErr, err)
 		}
 		return lastErr
 	}
-    if err != nil {
-    	return err
-    }
-	return nil
+	return err
 }
 
+// checkFileOrSkip checks a file. A file taking longer than
+// options.FileTimeout is reported and nil is returned so the next file is
+// checked, as is a document without extractable text.
+func checkFileOrSkip(ctx context.Context, w RecordWriter, path string, matcher *Matcher, options *CheckOptions) error {
+	err := checkFile(ctx, path, matcher, options, func(match *Matched) error {
+		return writeMatch(w, path, match, options)
+	})
+	if errors.Is(err, errNoText) {
+		return reportNoText(path, options)
+	}
+	if errors.Is(err, ErrBooleanLimit) {
+		if writeErr := writeFileError(w, path, err, options); writeErr != nil {
+			return writeErr
+		}
+		return err
+	}
+	return skipFileTimeout(ctx, path, err)
+}
+
+// skipFileTimeout reports a file which took longer than
+// options.FileTimeout to check and returns nil, other errors are returned.
+func skipFileTimeout(ctx context.Context, path string, err error) error {
+	if err != nil && ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+		fmt.Fprintf(os.Stderr, "skipping rest of %s: %s\n", path, err)
+		return nil
+	}
+	return err
+}
+
+// reportFile reports a checked file, see parallelOrdered. A cancelled
+// file's partial report is written before its error is returned.
+func reportFile(report func() error, err error) error {
+	if report != nil {
+		if reportErr := report(); reportErr != nil && err == nil {
+			err = reportErr
+		}
+	}
+	return err
+}
+
+// checkDirectory takes an initial path, a set of pattens and optional exclude list and
+// walks the directory and reports matches for any text files found. When
+// options.Workers is more than one the files are checked in parallel.
+func checkDirectory(ctx context.Context, out io.Writer, startDir string, patterns []*Pattern, excludeList []string, options *CheckOptions) error {
+	w, err := newCheckWriter(out, options)
+	if err != nil {
+		return err
+	}
+	matcher := NewMatcher(patterns)
+	errs := &fileErrors{}
+	if options.Workers > 1 {
+		err = checkDirectoryParallel(ctx, w, startDir, matcher, excludeList, options, errs)
+	} else {
+		err = walkFiles(ctx, startDir, excludeList, options.Filter, func(path string) error {
+			return errs.keep(path, checkFileOrSkip(ctx, w, path, matcher, options))
+		})
+	}
+	return closeRecords(w, errs.result(err))
+}
+
+// orderedResult holds the report for a path checked by a worker of
+// parallelOrdered. Done is closed once the path has been checked.
+type orderedResult struct {
+	path   string
+	report func() error
+	err    error
+	done   chan struct{}
+}
+
+// errStopWalk ends a directory walk after a file could not be checked.
+var errStopWalk = errors.New("stop walk")
+
+// checkDirectoryParallel checks the files found by the walk with a pool of
+// workers, see walkFilesParallel. Each file's matches are held until they
+// are written.
+func checkDirectoryParallel(ctx context.Context, w RecordWriter, startDir string, matcher *Matcher, excludeList []string, options *CheckOptions, errs *fileErrors) error {
+	return walkFilesParallel(ctx, startDir, excludeList, options.Filter, options.Workers, func(path string) (func() error, error) {
+		matches := []*Matched{}
+		err := checkFile(ctx, path, matcher, options, func(match *Matched) error {
+			matches = append(matches, match)
+			return nil
+		})
+		noText := errors.Is(err, errNoText)
+		if noText {
+			err = nil
+		}
+		var limitErr error
+		if errors.Is(err, ErrBooleanLimit) {
+			limitErr, err = err, nil
+		}
+		return func() error {
+			for _, match := range matches {
+				if err := writeMatch(w, path, match, options); err != nil {
+					return err
+				}
+			}
+			if limitErr != nil {
+				if err := writeFileError(w, path, limitErr, options); err != nil {
+					return err
+				}
+				return errs.keep(path, limitErr)
+			}
+			if noText {
+				return reportNoText(path, options)
+			}
+			return nil
+		}, skipFileTimeout(ctx, path, err)
+	})
+}
+
+// walkFilesParallel checks the files found by the walk with a pool of
+// workers, see parallelOrdered. The report is the same as a sequential
+// walk's.
+func walkFilesParallel(ctx context.Context, startDir string, excludeList []string, filter *FileFilter, workers int, check func(path string) (func() error, error)) error {
+	return parallelOrdered(workers, func(add func(path string) error) error {
+		return walkFiles(ctx, startDir, excludeList, filter, add)
+	}, check)
+}
+
+// parallelOrdered checks the paths sent by feed with a pool of workers.
+// Feed sends each path to the workers and, in the same order, to a single
+// writer which waits for each path's report in turn so the output is the
+// same as checking them one at a time. The check returns a function the
+// writer calls to report the path, see reportFile. At most a few paths per
+// worker are held waiting to be reported. It stops at the first path which
+// can't be checked or reported.
+func parallelOrdered(workerCount int, feed func(add func(path string) error) error, check func(path string) (func() error, error)) error {
+	workerCount = max(workerCount, 1)
+	jobs := make(chan *orderedResult)
+	results := make(chan *orderedResult, workerCount*4)
+	stop := make(chan struct{})
+
+	var workers sync.WaitGroup
+	for i := 0; i < workerCount; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for r := range jobs {
+				select {
+				case <-stop:
+					r.err = errStopWalk
+				default:
+					r.report, r.err = check(r.path)
+				}
+				close(r.done)
+			}
+		}()
+	}
+
+	var writeErr error
+	writer := make(chan struct{})
+	go func() {
+		defer close(writer)
+		for r := range results {
+			if writeErr != nil {
+				continue
+			}
+			<-r.done
+			if err := reportFile(r.report, r.err); err != nil {
+				writeErr = err
+				close(stop)
+			}
+		}
+	}()
+
+	err := feed(func(path string) error {
+		r := &orderedResult{path: path, done: make(chan struct{})}
+		select {
+		case <-stop:
+			return errStopWalk
+		case results <- r:
+		}
+		jobs <- r
+		return nil
+	})
+	close(jobs)
+	close(results)
+	workers.Wait()
+	<-writer
+	if writeErr != nil {
+		return writeErr
+	}
+	if err == errStopWalk {
+		return nil
+	}
+	return err
+}
 
 func (app *PhraseCheckApp) CheckFile(params []string) error {
 	appName := filepath.Base(os.Args[0])
@@ -285,6 +825,25 @@ func (app *PhraseCheckApp) CheckFile(params []string) error {
 	flagSet.BoolVar(&showHelp, "h", showHelp, "display help")
 	flagSet.BoolVar(&matchOne, "match-one", matchOne, "stop at first match")
 	flagSet.BoolVar(&matchOne, "1", matchOne, "stop at first match")
+	streamOrder := false
+	flagSet.BoolVar(&streamOrder, "stream-order", streamOrder, "report the matches in the order found in the text")
+	normalization := Normalization{}
+	addNormalizationFlags(flagSet, &normalization)
+	splitPunctuation := false
+	flagSet.BoolVar(&splitPunctuation, "punctuation", splitPunctuation, "strip leading and trailing punctuation from words")
+	contextWidth := 0
+	flagSet.IntVar(&contextWidth, "context", contextWidth, "include N words before and after each match")
+	timeout := time.Duration(0)
+	flagSet.DurationVar(&timeout, "timeout", timeout, "stop after the duration, e.g. 2h")
+	fileTimeout := time.Duration(0)
+	flagSet.DurationVar(&fileTimeout, "file-timeout", fileTimeout, "stop checking a file after the duration, e.g. 30s")
+	dbName := ""
+	flagSet.StringVar(&dbName, "db", dbName, "record the results in a SQLite database")
+	noTextName := ""
+	flagSet.StringVar(&noTextName, "no-text", noTextName, "list the documents without extractable text in FILE")
+	var format OutputFormat
+	addFormatFlag(flagSet, &format)
+	arguments := params
 	flagSet.Parse(params)
 	params = flagSet.Args()
 	if len(params) > 0 && params[0] == "help" {
@@ -303,13 +862,47 @@ func (app *PhraseCheckApp) CheckFile(params []string) error {
 	if err != nil {
 		return err
 	}
-	fmt.Println(phraseCheckCSVHeader)
-	for _, checkFName := range params {
-		if err := checkFile(checkFName, patterns, matchOne); err != nil {
+	for _, pattern := range patterns {
+		pattern.ApplyNormalization(normalization)
+	}
+	options := &CheckOptions{
+		MatchOne: matchOne,
+		StreamOrder: streamOrder,
+		Mode: tokenizerMode(splitPunctuation),
+		Context: contextWidth,
+		FileTimeout: fileTimeout,
+		Format: format,
+	}
+	closeNoText := func(err error) error { return err }
+	if noTextName != "" {
+		if closeNoText, err = openNoTextReport(noTextName, options); err != nil {
 			return err
 		}
 	}
-	return err
+	ctx, cancel := runContext(timeout)
+	defer cancel()
+	matcher := NewMatcher(patterns)
+	errs := &fileErrors{}
+	if dbName != "" {
+		return closeNoText(recordRun(dbName, "check", arguments, patterns, func(run *ResultsRun) error {
+			for _, checkFName := range params {
+				if err := errs.keep(checkFName, reportFile(recordFileReport(ctx, run, checkFName, matcher, options))); err != nil {
+					return err
+				}
+			}
+			return errs.result(nil)
+		}))
+	}
+	w, err := newCheckWriter(os.Stdout, options)
+	if err != nil {
+		return closeNoText(err)
+	}
+	for _, checkFName := range params {
+		if err := errs.keep(checkFName, checkFileOrSkip(ctx, w, checkFName, matcher, options)); err != nil {
+			return closeNoText(closeRecords(w, err))
+		}
+	}
+	return closeNoText(closeRecords(w, errs.result(nil)))
 }
 
 func (app *PhraseCheckApp) CheckDirectory(params []string) error {
@@ -321,6 +914,29 @@ func (app *PhraseCheckApp) CheckDirectory(params []string) error {
 	flagSet.BoolVar(&showHelp, "h", showHelp, "display help")
 	flagSet.BoolVar(&matchOne, "match-one", matchOne, "stop at first match")
 	flagSet.BoolVar(&matchOne, "1", matchOne, "stop at first match")
+	streamOrder := false
+	flagSet.BoolVar(&streamOrder, "stream-order", streamOrder, "report the matches in the order found in the text")
+	normalization := Normalization{}
+	addNormalizationFlags(flagSet, &normalization)
+	splitPunctuation := false
+	flagSet.BoolVar(&splitPunctuation, "punctuation", splitPunctuation, "strip leading and trailing punctuation from words")
+	contextWidth := 0
+	flagSet.IntVar(&contextWidth, "context", contextWidth, "include N words before and after each match")
+	workers := 1
+	flagSet.IntVar(&workers, "workers", workers, "number of files to check at once")
+	timeout := time.Duration(0)
+	flagSet.DurationVar(&timeout, "timeout", timeout, "stop after the duration, e.g. 2h")
+	fileTimeout := time.Duration(0)
+	flagSet.DurationVar(&fileTimeout, "file-timeout", fileTimeout, "stop checking a file after the duration, e.g. 30s")
+	filter := &FileFilter{}
+	addFilterFlags(flagSet, filter)
+	dbName := ""
+	flagSet.StringVar(&dbName, "db", dbName, "record the results in a SQLite database")
+	noTextName := ""
+	flagSet.StringVar(&noTextName, "no-text", noTextName, "list the documents without extractable text in FILE")
+	var format OutputFormat
+	addFormatFlag(flagSet, &format)
+	arguments := params
 	flagSet.Parse(params)
 	params = flagSet.Args()
 	if len(params) > 0 && params[0] == "help" {
@@ -353,10 +969,53 @@ func (app *PhraseCheckApp) CheckDirectory(params []string) error {
 	if err != nil {
 		return err
 	}
-	if err := checkDirectory(dirName, patterns, excludeList, matchOne); err != nil {
-		return err
+	for _, pattern := range patterns {
+		pattern.ApplyNormalization(normalization)
 	}
-	return err
+	options := &CheckOptions{
+		MatchOne: matchOne,
+		StreamOrder: streamOrder,
+		Mode: tokenizerMode(splitPunctuation),
+		Context: contextWidth,
+		Workers: workers,
+		FileTimeout: fileTimeout,
+		Filter: filter,
+		Format: format,
+	}
+	closeNoText := func(err error) error { return err }
+	if noTextName != "" {
+		if closeNoText, err = openNoTextReport(noTextName, options); err != nil {
+			return err
+		}
+	}
+	ctx, cancel := runContext(timeout)
+	defer cancel()
+	if dbName != "" {
+		return closeNoText(recordRun(dbName, "check-directory", arguments, patterns, func(run *ResultsRun) error {
+			return recordDirectory(ctx, run, dirName, patterns, excludeList, options)
+		}))
+	}
+	return closeNoText(checkDirectory(ctx, os.Stdout, dirName, patterns, excludeList, options))
+}
+
+// tokenizerMode returns the tokenizer mode selected on the command line.
+func tokenizerMode(splitPunctuation bool) TokenizerMode {
+	if splitPunctuation {
+		return SplitPunctuation
+	}
+	return SplitWhitespace
+}
+
+// addNormalizationFlags adds the options controlling how words are compared.
+func addNormalizationFlags(flagSet *flag.FlagSet, n *Normalization) {
+	flagSet.BoolVar(&n.FoldCase, "ignore-case", n.FoldCase, "compare words without regard to case")
+	flagSet.BoolVar(&n.FoldCase, "i", n.FoldCase, "compare words without regard to case")
+	flagSet.BoolVar(&n.FoldDiacritics, "fold-diacritics", n.FoldDiacritics, "compare words without accents and other diacritics")
+	flagSet.Func("form", "apply Unicode normalization form NFC or NFKC", func(s string) error {
+		form, err := ParseNormalForm(s)
+		n.Form = form
+		return err
+	})
 }
 
 func parseExcludeListFile(excludeListName string) ([]string, error) {
@@ -381,6 +1040,19 @@ func (app *PhraseCheckApp) MimeTypes(params []string) error {
 	showHelp := false
 	flagSet.BoolVar(&showHelp, "help", showHelp, "display help")
 	flagSet.BoolVar(&showHelp, "h", showHelp, "display help")
+	timeout := time.Duration(0)
+	flagSet.DurationVar(&timeout, "timeout", timeout, "stop after the duration, e.g. 2h")
+	sniff := false
+	flagSet.BoolVar(&sniff, "sniff", sniff, "identify the MIME type from the file content too")
+	pronom := false
+	flagSet.BoolVar(&pronom, "pronom", pronom, "identify the PRONOM format of each file")
+	signatureFile := ""
+	flagSet.StringVar(&signatureFile, "signature-file", signatureFile, "identify formats using a DROID signature file")
+	filter := &FileFilter{}
+	addFilterFlags(flagSet, filter)
+	loadMimeTypes := addMimeTypeFlags(flagSet, DefaultMimeRegistry)
+	var format OutputFormat
+	addFormatFlag(flagSet, &format)
 	flagSet.Parse(params)
 	params = flagSet.Args()
 	if len(params) > 0 && params[0] == "help" {
@@ -414,15 +1086,90 @@ func (app *PhraseCheckApp) MimeTypes(params []string) error {
 			return err
 		}
 	}
-	fileTypes, err := FileTypes(startDir, excludeList)
-	if err != nil {
+	if err := loadMimeTypes(); err != nil {
+		return err
+	}
+	var sigs *Signatures
+	if signatureFile != "" {
+		if sigs, err = LoadSignatures(signatureFile); err != nil {
+			return err
+		}
+	} else if pronom {
+		if sigs, err = BundledSignatures(); err != nil {
+			return err
+		}
+	}
+	ctx, cancel := runContext(timeout)
+	defer cancel()
+	if sniff || sigs != nil {
+		return identifyFiles(ctx, os.Stdout, format, startDir, excludeList, filter, sniff, sigs)
+	}
+	fileTypes, err := FileTypesWithFilter(ctx, startDir, excludeList, filter)
+	if err != nil && !errors.Is(err, ErrPartialResults) {
 		return err
 	}
-	fmt.Printf("\"file path\",\"mime type\"\n")
+	w, wErr := NewRecordWriter(os.Stdout, format, []string{"file path", "mime type"})
+	if wErr != nil {
+		return wErr
+	}
 	for file, fileType := range fileTypes {
-		fmt.Printf("%q,%q\n", file, fileType)
+		if wErr := w.Write(file, fileType); wErr != nil {
+			return closeRecords(w, wErr)
+		}
 	}
-	return nil
+	return closeRecords(w, err)
+}
+
+// identifyFiles writes the MIME type of each file found along with the
+// sniffed type when sniff is true and the PRONOM formats when sigs is not
+// nil. A file identified as more than one format has a row per format.
+func identifyFiles(ctx context.Context, out io.Writer, format OutputFormat, startDir string, excludeList []string, filter *FileFilter, sniff bool, sigs *Signatures) error {
+	header := []string{"file path", "mime type"}
+	if sniff {
+		header = append(header, "sniffed type", "mismatch")
+	}
+	if sigs != nil {
+		header = append(header, "puid", "format name", "format version", "basis", "warning")
+	}
+	w, err := NewRecordWriter(out, format, header)
+	if err != nil {
+		return err
+	}
+	var lastErr error
+	err = walkFiles(ctx, startDir, excludeList, filter, func(path string) error {
+		row := []any{path, mimeTypeOf(filepath.Ext(path))}
+		if sniff {
+			ft, err := DetectFileType(path)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "skipping %s: %s\n", path, err)
+				lastErr = err
+				return nil
+			}
+			row = append(row, ft.SniffedType, ft.Mismatch)
+		}
+		if sigs == nil {
+			return w.Write(row...)
+		}
+		ids, err := sigs.Identify(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "skipping %s: %s\n", path, err)
+			lastErr = err
+			return nil
+		}
+		if len(ids) == 0 {
+			return w.Write(append(row, nil, nil, nil, nil, "no match")...)
+		}
+		for _, id := range ids {
+			if err := w.Write(append(row, id.PUID, id.Name, nullString(id.Version), id.Basis, nullString(id.Warning))...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		err = lastErr
+	}
+	return closeRecords(w, err)
 }
 
 func (app *PhraseCheckApp) FileTypeCounts(params []string) error {
@@ -431,6 +1178,13 @@ func (app *PhraseCheckApp) FileTypeCounts(params []string) error {
 	showHelp := false
 	flagSet.BoolVar(&showHelp, "help", showHelp, "display help")
 	flagSet.BoolVar(&showHelp, "h", showHelp, "display help")
+	timeout := time.Duration(0)
+	flagSet.DurationVar(&timeout, "timeout", timeout, "stop after the duration, e.g. 2h")
+	filter := &FileFilter{}
+	addFilterFlags(flagSet, filter)
+	loadMimeTypes := addMimeTypeFlags(flagSet, DefaultMimeRegistry)
+	var format OutputFormat
+	addFormatFlag(flagSet, &format)
 	flagSet.Parse(params)
 	params = flagSet.Args()
 	if len(params) > 0 && params[0] == "help" {
@@ -464,42 +1218,228 @@ func (app *PhraseCheckApp) FileTypeCounts(params []string) error {
 			return err
 		}
 	}
-	fileTypes, err := FileTypes(startDir, excludeList)
+	if err := loadMimeTypes(); err != nil {
+		return err
+	}
+	ctx, cancel := runContext(timeout)
+	defer cancel()
+	counts, err := ExtensionCounts(ctx, startDir, excludeList, filter)
+	if err != nil && !errors.Is(err, ErrPartialResults) {
+		return err
+	}
+	w, wErr := NewRecordWriter(os.Stdout, format, []string{"file ext", "mime type", "count", "total bytes", "min size", "max size", "average size", "oldest modified", "newest modified"})
+	if wErr != nil {
+		return wErr
+	}
+	for _, stats := range counts {
+		if wErr := w.Write(stats.Extension, stats.MimeType, stats.Count,
+			stats.TotalBytes, stats.MinSize, stats.MaxSize, stats.AverageSize(),
+			stats.Oldest, stats.Newest); wErr != nil {
+			return closeRecords(w, wErr)
+		}
+	}
+	return closeRecords(w, err)
+}
+
+func (app *PhraseCheckApp) Inventory(params []string) error {
+	appName := filepath.Base(os.Args[0])
+	flagSet := flag.NewFlagSet("inventory", flag.ContinueOnError)
+	showHelp := false
+	flagSet.BoolVar(&showHelp, "help", showHelp, "display help")
+	flagSet.BoolVar(&showHelp, "h", showHelp, "display help")
+	digests := "sha256"
+	flagSet.StringVar(&digests, "digests", digests, "comma separated digests to record, md5, sha1, sha256 or sha512")
+	workers := runtime.NumCPU()
+	flagSet.IntVar(&workers, "workers", workers, "number of files to hash at once")
+	verify := ""
+	flagSet.StringVar(&verify, "verify", verify, "compare the directory with a saved inventory")
+	timeout := time.Duration(0)
+	flagSet.DurationVar(&timeout, "timeout", timeout, "stop after the duration, e.g. 2h")
+	filter := &FileFilter{}
+	addFilterFlags(flagSet, filter)
+	loadMimeTypes := addMimeTypeFlags(flagSet, DefaultMimeRegistry)
+	var format OutputFormat
+	addFormatFlag(flagSet, &format)
+	flagSet.Parse(params)
+	params = flagSet.Args()
+	if len(params) > 0 && params[0] == "help" {
+		showHelp = true
+	}
+	if showHelp {
+		fmt.Printf("%s\n", FmtHelp(InventoryHelp, appName, Version, ReleaseDate, ReleaseHash))
+		return nil
+	}
+	if len(params) == 0 {
+		return fmt.Errorf("expected a starting directory to crawl")
+	}
+	if len(params) > 2 {
+		return fmt.Errorf("too many parameters provided")
+	}
+	var (
+		startDir string
+		excludeList []string
+		err error
+	)
+	startDir = params[0]
+	if len(params) == 2 {
+		excludeList, err = parseExcludeListFile(params[1])
+		if err != nil {
+			return err
+		}
+	}
+	if err := loadMimeTypes(); err != nil {
+		return err
+	}
+	options := &InventoryOptions{
+		Workers: workers,
+		Filter: filter,
+		Format: format,
+	}
+	ctx, cancel := runContext(timeout)
+	defer cancel()
+	if verify == "" {
+		if options.Algorithms, err = ParseDigests(digests); err != nil {
+			return err
+		}
+		return WriteInventory(ctx, os.Stdout, startDir, excludeList, options)
+	}
+	in, err := os.Open(verify)
 	if err != nil {
 		return err
 	}
-	cnts := map[string]int{}
-	for file, _ := range fileTypes {
-		ext := path.Ext(file)
-		if cnt, ok := cnts[ext]; ok {
-			cnts[ext] = cnt + 1
-		} else {
-			cnts[ext] = 1
+	saved, algorithms, err := ReadInventory(in)
+	in.Close()
+	if err != nil {
+		return fmt.Errorf("%s, %s", verify, err)
+	}
+	options.Algorithms = algorithms
+	changes, err := VerifyInventory(ctx, startDir, excludeList, saved, options)
+	if err != nil && !errors.Is(err, ErrPartialResults) && len(changes) == 0 {
+		return err
+	}
+	w, wErr := NewRecordWriter(os.Stdout, format, []string{"status", "path", "detail"})
+	if wErr != nil {
+		return wErr
+	}
+	for _, change := range changes {
+		if wErr := w.Write(change.Status, change.Path, nullString(change.Detail)); wErr != nil {
+			return closeRecords(w, wErr)
 		}
 	}
-	fmt.Printf("\"file ext\",\"mime type\",\"count\"\n")
-	for k, v := range cnts {
-		if mimeType, ok := extensionToMIME[k]; ok {
-			fmt.Printf("%q,%q,%d\n", k, mimeType, v)
-		} else {
-			fmt.Printf("%q,%q,%d\n", k, "", v)
+	if wErr := w.Close(); wErr != nil {
+		return wErr
+	}
+	if err == nil && len(changes) > 0 {
+		err = fmt.Errorf("verify found %d differences from %s", len(changes), verify)
+	}
+	return err
+}
+
+func (app *PhraseCheckApp) Duplicates(params []string) error {
+	appName := filepath.Base(os.Args[0])
+	flagSet := flag.NewFlagSet("duplicates", flag.ContinueOnError)
+	showHelp := false
+	flagSet.BoolVar(&showHelp, "help", showHelp, "display help")
+	flagSet.BoolVar(&showHelp, "h", showHelp, "display help")
+	threshold := 0.8
+	flagSet.Float64Var(&threshold, "threshold", threshold, "similarity from 0 to 1 of near-duplicate text files, 0 for exact duplicates only")
+	shingleSize := 5
+	flagSet.IntVar(&shingleSize, "shingle-size", shingleSize, "number of words in each shingle compared")
+	workers := runtime.NumCPU()
+	flagSet.IntVar(&workers, "workers", workers, "number of files to read at once")
+	timeout := time.Duration(0)
+	flagSet.DurationVar(&timeout, "timeout", timeout, "stop after the duration, e.g. 2h")
+	filter := &FileFilter{}
+	addFilterFlags(flagSet, filter)
+	loadMimeTypes := addMimeTypeFlags(flagSet, DefaultMimeRegistry)
+	var format OutputFormat
+	addFormatFlag(flagSet, &format)
+	flagSet.Parse(params)
+	params = flagSet.Args()
+	if len(params) > 0 && params[0] == "help" {
+		showHelp = true
+	}
+	if showHelp {
+		fmt.Printf("%s\n", FmtHelp(DuplicatesHelp, appName, Version, ReleaseDate, ReleaseHash))
+		return nil
+	}
+	if len(params) == 0 {
+		return fmt.Errorf("expected a starting directory to crawl")
+	}
+	if len(params) > 2 {
+		return fmt.Errorf("too many parameters provided")
+	}
+	if threshold < 0 || threshold > 1 {
+		return fmt.Errorf("threshold should be from 0 to 1, got %g", threshold)
+	}
+	var (
+		startDir string
+		excludeList []string
+		err error
+	)
+	startDir = params[0]
+	if len(params) == 2 {
+		excludeList, err = parseExcludeListFile(params[1])
+		if err != nil {
+			return err
 		}
 	}
-	return nil
+	if err := loadMimeTypes(); err != nil {
+		return err
+	}
+	options := &DuplicateOptions{
+		Threshold: threshold,
+		ShingleSize: shingleSize,
+		Workers: workers,
+		Filter: filter,
+	}
+	ctx, cancel := runContext(timeout)
+	defer cancel()
+	files, err := FindDuplicates(ctx, startDir, excludeList, options)
+	if err != nil && len(files) == 0 {
+		return err
+	}
+	w, wErr := NewRecordWriter(os.Stdout, format, []string{"group", "representative", "match", "similarity", "file path", "size", "sha256"})
+	if wErr != nil {
+		return wErr
+	}
+	for _, f := range files {
+		var similarity any
+		if f.Match != "" {
+			similarity = math.Round(f.Similarity*100) / 100
+		}
+		if wErr := w.Write(f.Group, f.Representative, nullString(f.Match), similarity, f.Path, f.Size, f.SHA256); wErr != nil {
+			return closeRecords(w, wErr)
+		}
+	}
+	return closeRecords(w, err)
 }
 
-func tokenizeFile(fName string) error {
+func tokenizeFile(w RecordWriter, fName string, mode TokenizerMode, normalization Normalization) error {
 	in, err := os.Open(fName)
 	if err != nil {
 		return err
 	}
 	defer in.Close()
-	tokens, err := TokenReader(in)
+	text, _, err := extractText(context.Background(), in)
+	if err != nil {
+		return err
+	}
+	tokens, err := TokenReaderWithMode(text, mode)
 	if err != nil {
 		return err
 	}
 	for _, token := range tokens {
-		fmt.Printf("%q,%q,%d,%d\n", fName, token.Value, token.WordNo, token.LineNo)
+		row := []any{fName, token.Value, token.WordNo, token.LineNo, token.SentenceNo, token.ParagraphNo}
+		if mode == SplitPunctuation {
+			row = append(row, token.Raw)
+		}
+		if !normalization.IsZero() {
+			row = append(row, normalization.Normalize(token.Value))
+		}
+		if err := w.Write(row...); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -511,6 +1451,12 @@ func (app *PhraseCheckApp) Tokens(params []string) error {
 	showHelp := false
 	flagSet.BoolVar(&showHelp, "help", showHelp, "display help")
 	flagSet.BoolVar(&showHelp, "h", showHelp, "display help")
+	normalization := Normalization{}
+	addNormalizationFlags(flagSet, &normalization)
+	splitPunctuation := false
+	flagSet.BoolVar(&splitPunctuation, "punctuation", splitPunctuation, "strip leading and trailing punctuation from words")
+	var format OutputFormat
+	addFormatFlag(flagSet, &format)
 	flagSet.Parse(params)
 	params = flagSet.Args()
 	if len(params) > 0 && params[0] == "help" {
@@ -525,15 +1471,107 @@ func (app *PhraseCheckApp) Tokens(params []string) error {
 		return fmt.Errorf("must include a filename to tokenize")
 	}
 	
-	fmt.Printf("%q,%q,%q,%q\n", "name", "token", "word", "line")
+	mode := tokenizerMode(splitPunctuation)
+	header := []string{"name", "token", "word", "line", "sentence", "paragraph"}
+	if mode == SplitPunctuation {
+		header = append(header, "raw")
+	}
+	if !normalization.IsZero() {
+		header = append(header, "normalized")
+	}
+	w, err := NewRecordWriter(os.Stdout, format, header)
+	if err != nil {
+		return err
+	}
 	var lastErr error
 	for _, fName := range params {
-		if err := tokenizeFile(fName); err != nil {
+		if err := tokenizeFile(w, fName, mode, normalization); err != nil {
 			fmt.Fprintf(os.Stderr, "%s: %s\n", fName, err)
 			lastErr = err
 		}
 	}
-	return lastErr
+	return closeRecords(w, lastErr)
+}
+
+// Concordance walks the paths given and displays the keyword in context
+// lines for a single pattern in CSV format.
+func (app *PhraseCheckApp) Concordance(params []string) error {
+	appName := filepath.Base(os.Args[0])
+	flagSet := flag.NewFlagSet("concordance", flag.ContinueOnError)
+	showHelp := false
+	flagSet.BoolVar(&showHelp, "help", showHelp, "display help")
+	flagSet.BoolVar(&showHelp, "h", showHelp, "display help")
+	normalization := Normalization{}
+	addNormalizationFlags(flagSet, &normalization)
+	splitPunctuation := false
+	flagSet.BoolVar(&splitPunctuation, "punctuation", splitPunctuation, "strip leading and trailing punctuation from words")
+	contextWidth := 5
+	flagSet.IntVar(&contextWidth, "width", contextWidth, "number of words before and after each match")
+	timeout := time.Duration(0)
+	flagSet.DurationVar(&timeout, "timeout", timeout, "stop after the duration, e.g. 2h")
+	fileTimeout := time.Duration(0)
+	flagSet.DurationVar(&fileTimeout, "file-timeout", fileTimeout, "stop checking a file after the duration, e.g. 30s")
+	var format OutputFormat
+	addFormatFlag(flagSet, &format)
+	flagSet.Parse(params)
+	params = flagSet.Args()
+	if len(params) > 0 && params[0] == "help" {
+		showHelp = true
+	}
+	if showHelp {
+		fmt.Printf("%s\n", FmtHelp(ConcordanceHelp, appName, Version, ReleaseDate, ReleaseHash))
+		return nil
+	}
+	if len(params) < 2 {
+		return fmt.Errorf("missing pattern and path to process")
+	}
+	if len(params) > 3 {
+		return fmt.Errorf("too many parameters provided")
+	}
+	var excludeList []string
+	if len(params) == 3 {
+		var err error
+		excludeList, err = parseExcludeListFile(params[2])
+		if err != nil {
+			return err
+		}
+	}
+	pattern, err := ParsePattern(params[0])
+	if err != nil {
+		return err
+	}
+	pattern.ApplyNormalization(normalization)
+	options := &CheckOptions{
+		Mode: tokenizerMode(splitPunctuation),
+		Context: max(contextWidth, 1),
+		FileTimeout: fileTimeout,
+	}
+	ctx, cancel := runContext(timeout)
+	defer cancel()
+	w, err := NewRecordWriter(os.Stdout, format, []string{"filename", "line no", "before", "match", "after"})
+	if err != nil {
+		return err
+	}
+	matcher := NewMatcher([]*Pattern{pattern})
+	errs := &fileErrors{}
+	err = walkFiles(ctx, params[1], excludeList, nil, func(path string) error {
+		in, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		fileCtx, cancel := fileContext(ctx, options)
+		defer cancel()
+		text, _, err := extractText(fileCtx, in)
+		if err != nil {
+			return skipFileTimeout(ctx, path, skipExtractError(path, err))
+		}
+		err = matcher.StreamContext(fileCtx, text, options, func(m *Matched) error {
+			return w.Write(path, m.LineNo, m.Before, m.Text, m.After)
+		})
+		return skipFileTimeout(ctx, path, errs.keep(path, err))
+	})
+	return closeRecords(w, errs.result(err))
 }
 
 // Run provides the command line interface handling
@@ -549,12 +1587,17 @@ func (app *PhraseCheckApp) Run(appName string, action string, params []string) e
 		return app.MimeTypes(params)
 	case "filetypes":
 		return app.FileTypeCounts(params)
+	case "inventory":
+		return app.Inventory(params)
+	case "duplicates":
+		return app.Duplicates(params)
 	case "check":
 		return app.CheckFile(params)
 	case "check-directory":
 		return app.CheckDirectory(params)
+	case "concordance":
+		return app.Concordance(params)
 	default:
 		return fmt.Errorf("%q action not supported", action)
 	}
-	return nil
 }
\ No newline at end of file
@@ -1,10 +1,14 @@
 package analysistools
 
 import (
-	//"bytes"
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -138,6 +142,21 @@ The preparation for litigation is ongoing.
 `
 )
 
+// writeTree writes the files under dir, the names are slash separated
+// paths and the directories are created as needed.
+func writeTree[T string | []byte](t *testing.T, dir string, files map[string]T) {
+	t.Helper()
+	for name, src := range files {
+		fName := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fName), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fName, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
 func TestParsePattern(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -165,12 +184,103 @@ func TestParsePattern(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			input: "attorney client privilege",
+			want: &Pattern{
+				Type:         Phrase,
+				Terms:        []string{"attorney", "client", "privilege"},
+				OriginalText: "attorney client privilege",
+			},
+			wantErr: false,
+		},
+		{
+			input: "Legal Counsel",
+			want: &Pattern{
+				Type:         Phrase,
+				Terms:        []string{"Legal", "Counsel"},
+				OriginalText: "Legal Counsel",
+			},
+			wantErr: false,
+		},
+		{
+			input: "attorn* pre/5 client*",
+			want: &Pattern{
+				Type:         Proximity,
+				Keyword1:     "attorn*",
+				Keyword2:     "client*",
+				MaxDistance:  5,
+				Ordered:      true,
+				OriginalText: "attorn* pre/5 client*",
+			},
+			wantErr: false,
+		},
+		{
+			input: "law not w/3 school",
+			want: &Pattern{
+				Type:         Proximity,
+				Keyword1:     "law",
+				Keyword2:     "school",
+				MaxDistance:  3,
+				Exclude:      true,
+				OriginalText: "law not w/3 school",
+			},
+			wantErr: false,
+		},
+		{
+			input: "privilege* w/s counsel*",
+			want: &Pattern{
+				Type:         Proximity,
+				Keyword1:     "privilege*",
+				Keyword2:     "counsel*",
+				Scope:        SentenceScope,
+				OriginalText: "privilege* w/s counsel*",
+			},
+			wantErr: false,
+		},
+		{
+			input: "privilege* not w/p counsel*",
+			want: &Pattern{
+				Type:         Proximity,
+				Keyword1:     "privilege*",
+				Keyword2:     "counsel*",
+				Scope:        ParagraphScope,
+				Exclude:      true,
+				OriginalText: "privilege* not w/p counsel*",
+			},
+			wantErr: false,
+		},
+		{
+			input:   "law not w/x school",
+			want:    nil,
+			wantErr: true,
+			errMsg:  "invalid max distance in pattern: \"law not w/x school\"",
+		},
+		{
+			input:   "attorney w/5 client privilege",
+			want:    nil,
+			wantErr: true,
+			errMsg:  "malformed proximity pattern: \"attorney w/5 client privilege\"",
+		},
+		{
+			input: "(attorn* OR counsel*) AND NOT newsletter",
+			want: &Pattern{
+				Type:         Boolean,
+				OriginalText: "(attorn* OR counsel*) AND NOT newsletter",
+			},
+			wantErr: false,
+		},
 		{
 			input:   "attorn* w/ client*",
 			want:    nil,
 			wantErr: true,
 			errMsg:  "invalid max distance in pattern: \"attorn* w/ client*\"",
 		},
+		{
+			input:   "attorn* pre/0 client*",
+			want:    nil,
+			wantErr: true,
+			errMsg:  "invalid max distance in pattern: \"attorn* pre/0 client*\"",
+		},
 		{
 			input:   "w/5 client*",
 			want:    nil,
@@ -273,6 +383,20 @@ func TestCheckProximity(t *testing.T) {
 			maxDistance: 2,
 			want:        false,
 		},
+		{
+			tokens: tokens,
+			keyword1:    "fox",
+			keyword2:    "quick",
+			maxDistance: 2,
+			want:        true,
+		},
+		{
+			tokens: tokens,
+			keyword1:    "jumps",
+			keyword2:    "the",
+			maxDistance: 3,
+			want:        false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -285,6 +409,204 @@ func TestCheckProximity(t *testing.T) {
 	}
 }
 
+func TestFindProximity(t *testing.T) {
+	txt := `The attorney met the client.
+Another client called the attorney
+and the attorney's client, not the attorney, wrote.`
+	tokens, err := Tokenizer(txt)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{
+			pattern: "attorn* w/3 client*",
+			want: []string{
+				"attorney 0:1 client. 0:4 3",
+				"attorney 1:9 client 1:6 3",
+				"attorney's 2:12 client, 2:13 1",
+				"attorney, 2:16 client, 2:13 3",
+			},
+		},
+		{
+			pattern: "attorn* pre/3 client*",
+			want: []string{
+				"attorney 0:1 client. 0:4 3",
+				"attorney's 2:12 client, 2:13 1",
+			},
+		},
+		{
+			pattern: "client* not w/2 attorn*",
+			want:    []string{"client. 0:4", "client 1:6"},
+		},
+	}
+	for _, tt := range tests {
+		pattern, err := ParsePattern(tt.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []string{}
+		for _, m := range FindProximity(tokens, pattern) {
+			s := fmt.Sprintf("%s %d:%d", spanText(m.Span), m.Span[0].LineNo, m.Span[0].WordNo)
+			if m.Near != nil {
+				s += fmt.Sprintf(" %s %d:%d %d", spanText(m.Near), m.Near[0].LineNo, m.Near[0].WordNo, m.Distance)
+			}
+			got = append(got, s)
+		}
+		if !equalStringSlices(got, tt.want) {
+			t.Errorf("FindProximity(%q) = %q, want %q", tt.pattern, got, tt.want)
+		}
+	}
+
+	// Each occurrence is reported with both keywords
+	pattern, _ := ParsePattern("attorn* w/3 client*")
+	matched, err := PhraseCheck(txt, []*Pattern{pattern}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matched) != 4 {
+		t.Fatalf("expected 4 matches, got %d", len(matched))
+	}
+	m := matched[1]
+	if m.Text != "attorney" || m.LineNo != 1 || m.Keyword2Text != "client" || m.Keyword2LineNo != 1 || m.Keyword2WordNo != 6 || m.Distance != 3 {
+		t.Errorf("unexpected match %+v", m)
+	}
+}
+
+func TestCheckProximityScope(t *testing.T) {
+	txt := `The privilege was waived. Our counsel
+disagreed with that view.
+
+Counsel later filed a motion.`
+	tokens, err := Tokenizer(txt)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	tests := []struct {
+		keyword1 string
+		keyword2 string
+		scope    ProximityScope
+		want     bool
+	}{
+		{ keyword1: "privilege", keyword2: "counsel", scope: SentenceScope, want: false },
+		{ keyword1: "privilege", keyword2: "counsel", scope: ParagraphScope, want: true },
+		{ keyword1: "counsel", keyword2: "view.", scope: SentenceScope, want: true },
+		{ keyword1: "view.", keyword2: "counsel", scope: SentenceScope, want: true },
+		{ keyword1: "privilege", keyword2: "motion.", scope: ParagraphScope, want: false },
+		{ keyword1: "Counsel", keyword2: "motion.", scope: SentenceScope, want: true },
+	}
+	for _, tt := range tests {
+		_, got := CheckProximityScope(tokens, tt.keyword1, tt.keyword2, tt.scope)
+		if got != tt.want {
+			t.Errorf("CheckProximityScope(%q, %q, %q) = %v, want %v", tt.keyword1, tt.keyword2, tt.scope, got, tt.want)
+		}
+	}
+}
+
+func TestCheckPrecedes(t *testing.T) {
+	txt := "the client of our attorney asked the attorney about the client"
+	tokens, err := Tokenizer(txt)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	tests := []struct {
+		keyword1    string
+		keyword2    string
+		maxDistance int
+		want        bool
+		wantWordNo  int
+	}{
+		{ keyword1: "client*", keyword2: "attorn*", maxDistance: 3, want: true, wantWordNo: 1 },
+		{ keyword1: "attorn*", keyword2: "client*", maxDistance: 3, want: true, wantWordNo: 7 },
+		{ keyword1: "attorn*", keyword2: "client*", maxDistance: 2, want: false },
+		{ keyword1: "about", keyword2: "asked", maxDistance: 5, want: false },
+	}
+	for _, tt := range tests {
+		token, got := CheckPrecedes(tokens, tt.keyword1, tt.keyword2, tt.maxDistance)
+		if got != tt.want {
+			t.Errorf("CheckPrecedes(%q, %q, %d) = %v, want %v", tt.keyword1, tt.keyword2, tt.maxDistance, got, tt.want)
+			continue
+		}
+		if got && token.WordNo != tt.wantWordNo {
+			t.Errorf("CheckPrecedes(%q, %q, %d) matched word %d, want %d", tt.keyword1, tt.keyword2, tt.maxDistance, token.WordNo, tt.wantWordNo)
+		}
+	}
+}
+
+func TestCheckNotProximity(t *testing.T) {
+	txt := "she went to law school before she studied the law of the sea"
+	tokens, err := Tokenizer(txt)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	tests := []struct {
+		keyword1    string
+		keyword2    string
+		maxDistance int
+		ordered     bool
+		want        bool
+		wantWordNo  int
+	}{
+		{ keyword1: "law", keyword2: "school", maxDistance: 3, want: true, wantWordNo: 9 },
+		{ keyword1: "law", keyword2: "school", maxDistance: 8, want: false },
+		{ keyword1: "law", keyword2: "she", maxDistance: 3, want: false },
+		{ keyword1: "law", keyword2: "she", maxDistance: 3, ordered: true, want: true, wantWordNo: 9 },
+		{ keyword1: "sea", keyword2: "law", maxDistance: 3, ordered: true, want: true, wantWordNo: 12 },
+	}
+	for _, tt := range tests {
+		token, got := CheckNotProximity(tokens, tt.keyword1, tt.keyword2, tt.maxDistance, tt.ordered)
+		if got != tt.want {
+			t.Errorf("CheckNotProximity(%q, %q, %d, %t) = %v, want %v", tt.keyword1, tt.keyword2, tt.maxDistance, tt.ordered, got, tt.want)
+			continue
+		}
+		if got && token.WordNo != tt.wantWordNo {
+			t.Errorf("CheckNotProximity(%q, %q, %d, %t) matched word %d, want %d", tt.keyword1, tt.keyword2, tt.maxDistance, tt.ordered, token.WordNo, tt.wantWordNo)
+		}
+	}
+}
+
+func TestCheckPhrase(t *testing.T) {
+	txt := "This document is privileged and confidential.\nIt is privileged\nand confidential too."
+	tokens, err := Tokenizer(txt)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	tests := []struct {
+		terms []string
+		want  []string
+	}{
+		{
+			terms: []string{"privileged", "and", "confidential*"},
+			want:  []string{"privileged and confidential.", "privileged and confidential"},
+		},
+		{
+			terms: []string{"privil*", "and"},
+			want:  []string{"privileged and", "privileged and"},
+		},
+		{
+			terms: []string{"confidential", "privileged"},
+			want:  []string{},
+		},
+	}
+	for _, tt := range tests {
+		spans := CheckPhrase(tokens, tt.terms)
+		got := []string{}
+		for _, span := range spans {
+			got = append(got, spanText(span))
+		}
+		if !equalStringSlices(got, tt.want) {
+			t.Errorf("CheckPhrase(%q) = %q, want %q", tt.terms, got, tt.want)
+		}
+	}
+}
+
 func TestPhraseCheckReader(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -347,6 +669,37 @@ func TestPhraseCheckReader(t *testing.T) {
 			want: "0,\"attorn* w/5 client*\",\"attorn\"",
 			wantErr: false,
 		},
+		{
+			name:  "unordered proximity match",
+			input: "The client of our attorney called.",
+			patterns: []*Pattern{
+				{
+					Type:         Proximity,
+					Keyword1:     "attorn*",
+					Keyword2:     "client*",
+					MaxDistance:  5,
+					OriginalText: "attorn* w/5 client*",
+				},
+			},
+			want: "0,\"attorn* w/5 client*\",\"attorney\"",
+			wantErr: false,
+		},
+		{
+			name:  "ordered proximity no match",
+			input: "The client of our attorney called.",
+			patterns: []*Pattern{
+				{
+					Type:         Proximity,
+					Keyword1:     "attorn*",
+					Keyword2:     "client*",
+					MaxDistance:  5,
+					Ordered:      true,
+					OriginalText: "attorn* pre/5 client*",
+				},
+			},
+			want: "",
+			wantErr: false,
+		},
 		{
 			name: "proximity match",
 			input: "Regarding ATTY-CLIENT PRIVILEDGE materials you sent",
@@ -377,6 +730,51 @@ func TestPhraseCheckReader(t *testing.T) {
 			want: "0,\"ATTY-CLIENT PRIVILEDGE*\",\"ATTY-CLIENT\"",
 			wantErr: false,
 		},
+		{
+			name: "phrase match",
+			input: "The attorney client privilege was asserted.\nSee attorney client\nprivilege log.",
+			patterns: []*Pattern{
+				{
+					Type:         Phrase,
+					Terms:        []string{"attorney", "client", "privilege"},
+					OriginalText: "attorney client privilege",
+				},
+			},
+			want: "0,\"attorney client privilege\",\"attorney client privilege\"\n1,\"attorney client privilege\",\"attorney client privilege\"",
+			wantErr: false,
+		},
+		{
+			name: "phrase with wildcards",
+			input: "The summary judgments motion was granted.",
+			patterns: []*Pattern{
+				{
+					Type:         Phrase,
+					Terms:        []string{"summary", "judgment*"},
+					OriginalText: "summary judgment*",
+				},
+			},
+			want: "0,\"summary judgment*\",\"summary judgments\"",
+			wantErr: false,
+		},
+		{
+			name: "boolean match",
+			input: "The attorney wrote a memo.\nThe brief was filed.",
+			patterns: []*Pattern{
+				{
+					Type:         Boolean,
+					Expr:         &AndExpr{
+						Left:  &TermExpr{Terms: []string{"attorn*"}},
+						Right: &OrExpr{
+							Left:  &TermExpr{Terms: []string{"memo*"}},
+							Right: &TermExpr{Terms: []string{"brief*"}},
+						},
+					},
+					OriginalText: "attorn* AND (memo* OR brief*)",
+				},
+			},
+			want: "0,\"attorn* AND (memo* OR brief*)\",\"attorney\"\n0,\"attorn* AND (memo* OR brief*)\",\"memo.\"\n1,\"attorn* AND (memo* OR brief*)\",\"brief\"",
+			wantErr: false,
+		},
 	}
 
 	for i, tt := range tests {
@@ -396,6 +794,100 @@ func TestPhraseCheckReader(t *testing.T) {
 	}
 }
 
+func TestPhraseCheckPunctuation(t *testing.T) {
+	txt := `Is this "privileged and confidential"? Ask (counsel).
+The attorney's memo, not the attorney.`
+	patterns := []*Pattern{}
+	for _, line := range []string{"privileged and confidential", "counsel", "attorney"} {
+		pattern, err := ParsePattern(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	matched, err := PhraseCheck(txt, patterns, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := MatchedStrings(matched); got != "" {
+		t.Errorf("expected no matches splitting on whitespace, got %q", got)
+	}
+	options := &CheckOptions{Mode: SplitPunctuation}
+	matched, err = PhraseCheckReaderWithOptions(strings.NewReader(txt), patterns, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `0,"privileged and confidential","\"privileged and confidential\"?"
+0,"counsel","(counsel)."
+1,"attorney","attorney."`
+	if got := MatchedStrings(matched); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestMatchedPositions(t *testing.T) {
+	txt := "Re: memo\n  The attorney client privilege applies."
+	patterns := []*Pattern{}
+	for _, line := range []string{"attorney client privilege", "memo"} {
+		pattern, err := ParsePattern(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	matched, err := PhraseCheck(txt, patterns, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Matched{
+		{ LineNo: 1, WordNo: 3, Column: 6, EndColumn: 31, StartOffset: 15, EndOffset: 40 },
+		{ LineNo: 0, WordNo: 1, Column: 4, EndColumn: 8, StartOffset: 4, EndOffset: 8 },
+	}
+	if len(matched) != len(want) {
+		t.Fatalf("expected %d matches, got %d", len(want), len(matched))
+	}
+	for i, m := range matched {
+		if m.LineNo != want[i].LineNo || m.WordNo != want[i].WordNo || m.Column != want[i].Column ||
+			m.EndColumn != want[i].EndColumn || m.StartOffset != want[i].StartOffset || m.EndOffset != want[i].EndOffset {
+			t.Errorf("match #%d expected %+v, got %+v", i, want[i], m)
+		}
+		if got := txt[m.StartOffset:m.EndOffset]; got != m.Text {
+			t.Errorf("match #%d expected offsets to hold %q, got %q", i, m.Text, got)
+		}
+	}
+}
+
+func TestKeywordInContext(t *testing.T) {
+	txt := `The client asked our attorney
+about the privileged and confidential memo.`
+	patterns := []*Pattern{}
+	for _, line := range []string{"The", "attorney", "privileged and confidential", "memo*"} {
+		pattern, err := ParsePattern(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	matched, err := PhraseCheckReaderWithOptions(strings.NewReader(txt), patterns, &CheckOptions{Context: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"[[The]] client asked",
+		"asked our [[attorney]] about the",
+		"about the [[privileged and confidential]] memo.",
+		"and confidential [[memo.]]",
+	}
+	if len(matched) != len(want) {
+		t.Fatalf("expected %d matches, got %d", len(want), len(matched))
+	}
+	for i, m := range matched {
+		if got := m.KWIC(); got != want[i] {
+			t.Errorf("match #%d expected %q, got %q", i, want[i], got)
+		}
+	}
+}
+
 // Helper functions for testing
 func patternsEqual(a, b *Pattern) bool {
 	if a == nil || b == nil {
@@ -405,6 +897,10 @@ func patternsEqual(a, b *Pattern) bool {
 		a.Keyword1 == b.Keyword1 &&
 		a.Keyword2 == b.Keyword2 &&
 		a.MaxDistance == b.MaxDistance &&
+		a.Scope == b.Scope &&
+		a.Ordered == b.Ordered &&
+		a.Exclude == b.Exclude &&
+		equalStringSlices(a.Terms, b.Terms) &&
 		a.OriginalText == b.OriginalText
 }
 
@@ -422,3 +918,63 @@ func equalStringSlices(a, b []string) bool {
 
 // For capturing stdout in tests
 var stdout io.Writer = os.Stdout
+
+// TestCheckDirectoryParallel checks the parallel report matches the
+// sequential one. Run it with "go test -race" to check the worker pool.
+func TestCheckDirectoryParallel(t *testing.T) {
+	dir := t.TempDir()
+	tree := map[string]string{}
+	for i := 0; i < 40; i++ {
+		tree[fmt.Sprintf("box%d/doc%02d.txt", i%4, i)] = strings.Repeat(fmt.Sprintf("The attorney sent memo %d to the client.\n", i), i%7+1)
+	}
+	writeTree(t, dir, tree)
+	patterns := []*Pattern{}
+	for _, line := range []string{"attorn*", "memo pre/4 client*"} {
+		pattern, err := ParsePattern(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	var want bytes.Buffer
+	if err := checkDirectory(context.Background(), &want, dir, patterns, []string{"box3"}, &CheckOptions{Context: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(want.String(), "\n"); n != 235 {
+		t.Fatalf("expected 235 lines in the sequential report, got %d", n)
+	}
+	for _, workers := range []int{2, 8} {
+		var got bytes.Buffer
+		if err := checkDirectory(context.Background(), &got, dir, patterns, []string{"box3"}, &CheckOptions{Context: 2, Workers: workers}); err != nil {
+			t.Fatal(err)
+		}
+		if got.String() != want.String() {
+			t.Errorf("%d workers expected\n%s\ngot\n%s", workers, want.String(), got.String())
+		}
+	}
+	want.Reset()
+	if err := checkDirectory(context.Background(), &want, dir, patterns, []string{"box3"}, &CheckOptions{Format: JSONLFormat}); err != nil {
+		t.Fatal(err)
+	}
+	var got bytes.Buffer
+	if err := checkDirectory(context.Background(), &got, dir, patterns, []string{"box3"}, &CheckOptions{Format: JSONLFormat, Workers: 4}); err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != want.String() || strings.Count(want.String(), "\n") != 234 {
+		t.Errorf("expected the same 234 JSON lines from 4 workers, got %d and %d", strings.Count(want.String(), "\n"), strings.Count(got.String(), "\n"))
+	}
+
+	// A cancelled walk says its results are partial
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, workers := range []int{1, 8} {
+		var got bytes.Buffer
+		err := checkDirectory(ctx, &got, dir, patterns, nil, &CheckOptions{Workers: workers})
+		if !errors.Is(err, ErrPartialResults) || !errors.Is(err, context.Canceled) {
+			t.Errorf("%d workers expected a partial results error, got %v", workers, err)
+		}
+	}
+	if _, err := FileTypesContext(ctx, dir, nil); !errors.Is(err, ErrPartialResults) {
+		t.Errorf("expected a partial results error, got %v", err)
+	}
+}
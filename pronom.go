@@ -0,0 +1,648 @@
+package analysistools
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// bundledSignatureFile holds a subset of the PRONOM signatures in DROID
+// signature file format.
+//
+//go:embed pronom_signatures.xml
+var bundledSignatureFile []byte
+
+// sigReadLen is the number of bytes read from the start and the end of a
+// file to match signatures against. Variable offset signatures are only
+// found within the start of the file.
+const sigReadLen = 65536
+
+// sigStepLimit is the most steps spent matching one signature, four for
+// each byte read. A pattern with several gaps can try every combination of
+// gap lengths, a signature which runs out of steps doesn't match.
+const sigStepLimit = 4 * sigReadLen
+
+// Signatures holds the file formats and signatures of a DROID signature
+// file. Formats are identified by their PRONOM unique identifier (PUID),
+// e.g. "fmt/276" for PDF 1.7.
+type Signatures struct {
+	// Version is the version of the signature file
+	Version string
+	formats []*pronomFormat
+}
+
+// pronomFormat is a file format with the signatures identifying it.
+type pronomFormat struct {
+	id           int
+	puid         string
+	name         string
+	version      string
+	mimeType     string
+	extensions   []string
+	signatures   [][]*byteSequence
+	priorityOver []int
+}
+
+// byteSequence is a pattern anchored at the beginning or end of a file.
+// Sequences anchored at the end are matched against the reversed file.
+type byteSequence struct {
+	fromEOF bool
+	elems   []sigElem
+}
+
+type sigKind int
+
+const (
+	sigByte sigKind = iota
+	sigRange
+	sigAlts
+	sigGap
+)
+
+// sigElem is a single element of a signature pattern.
+type sigElem struct {
+	kind sigKind
+	// lo and hi are the byte or range of bytes matched, negate matches the
+	// bytes outside the range
+	lo, hi byte
+	negate bool
+	// alts are the patterns matched by a set of alternatives
+	alts [][]sigElem
+	// min and max are the bytes skipped by a gap, max < 0 skips any number
+	min, max int
+}
+
+// Identification is a file format identified for a file.
+type Identification struct {
+	PUID     string
+	Name     string
+	Version  string
+	MIMEType string
+	// Basis says how the format was identified, e.g. "extension match pdf;
+	// byte match at 0, 6 from EOF"
+	Basis string
+	// Warning notes a weak identification, e.g. "match on extension only"
+	Warning string
+}
+
+// The DROID signature file elements used to identify formats
+type droidSignatureFile struct {
+	Version    string           `xml:"Version,attr"`
+	Signatures []droidSignature `xml:"InternalSignatureCollection>InternalSignature"`
+	Formats    []droidFormat    `xml:"FileFormatCollection>FileFormat"`
+}
+
+type droidSignature struct {
+	ID            int                 `xml:"ID,attr"`
+	ByteSequences []droidByteSequence `xml:"ByteSequence"`
+}
+
+type droidByteSequence struct {
+	Reference    string             `xml:"Reference,attr"`
+	SubSequences []droidSubSequence `xml:"SubSequence"`
+}
+
+type droidSubSequence struct {
+	Position       int             `xml:"Position,attr"`
+	MinOffset      string          `xml:"SubSeqMinOffset,attr"`
+	MaxOffset      string          `xml:"SubSeqMaxOffset,attr"`
+	Sequence       string          `xml:"Sequence"`
+	LeftFragments  []droidFragment `xml:"LeftFragment"`
+	RightFragments []droidFragment `xml:"RightFragment"`
+}
+
+type droidFragment struct {
+	Position  int    `xml:"Position,attr"`
+	MinOffset string `xml:"MinOffset,attr"`
+	MaxOffset string `xml:"MaxOffset,attr"`
+	Value     string `xml:",chardata"`
+}
+
+type droidFormat struct {
+	ID           int      `xml:"ID,attr"`
+	Name         string   `xml:"Name,attr"`
+	PUID         string   `xml:"PUID,attr"`
+	Version      string   `xml:"Version,attr"`
+	MIMEType     string   `xml:"MIMEType,attr"`
+	SignatureIDs []int    `xml:"InternalSignatureID"`
+	Extensions   []string `xml:"Extension"`
+	PriorityOver []int    `xml:"HasPriorityOverFileFormatID"`
+}
+
+// BundledSignatures returns the subset of the PRONOM signatures bundled
+// with analysistools. It covers common document, image, archive and text
+// formats.
+func BundledSignatures() (*Signatures, error) {
+	return ParseSignatures(bundledSignatureFile)
+}
+
+// LoadSignatures reads a DROID signature file, e.g.
+// "DROID_SignatureFile_V120.xml". Container signatures are not supported.
+func LoadSignatures(fName string) (*Signatures, error) {
+	src, err := os.ReadFile(fName)
+	if err != nil {
+		return nil, err
+	}
+	sigs, err := ParseSignatures(src)
+	if err != nil {
+		return nil, fmt.Errorf("%s, %s", fName, err)
+	}
+	return sigs, nil
+}
+
+// ParseSignatures parses the content of a DROID signature file.
+func ParseSignatures(src []byte) (*Signatures, error) {
+	sigFile := &droidSignatureFile{}
+	if err := xml.Unmarshal(src, sigFile); err != nil {
+		return nil, err
+	}
+	byteSequences := make(map[int][]*byteSequence)
+	for _, sig := range sigFile.Signatures {
+		for _, bs := range sig.ByteSequences {
+			seq, err := newByteSequence(bs)
+			if err != nil {
+				return nil, fmt.Errorf("signature %d, %s", sig.ID, err)
+			}
+			byteSequences[sig.ID] = append(byteSequences[sig.ID], seq)
+		}
+	}
+	sigs := &Signatures{Version: sigFile.Version}
+	for _, f := range sigFile.Formats {
+		format := &pronomFormat{
+			id:           f.ID,
+			puid:         f.PUID,
+			name:         f.Name,
+			version:      f.Version,
+			mimeType:     f.MIMEType,
+			priorityOver: f.PriorityOver,
+		}
+		for _, ext := range f.Extensions {
+			format.extensions = append(format.extensions, strings.ToLower(strings.TrimSpace(ext)))
+		}
+		for _, id := range f.SignatureIDs {
+			if seqs, ok := byteSequences[id]; ok {
+				format.signatures = append(format.signatures, seqs)
+			}
+		}
+		sigs.formats = append(sigs.formats, format)
+	}
+	return sigs, nil
+}
+
+// newByteSequence turns the subsequences of a DROID byte sequence into a
+// single pattern. Each subsequence is the gap before it followed by its
+// left fragments, its sequence and its right fragments.
+func newByteSequence(bs droidByteSequence) (*byteSequence, error) {
+	seq := &byteSequence{fromEOF: bs.Reference == "EOFoffset"}
+	subs := append([]droidSubSequence{}, bs.SubSequences...)
+	sort.SliceStable(subs, func(i, j int) bool { return subs[i].Position < subs[j].Position })
+	for i, sub := range subs {
+		from, to, err := parseOffsets(sub.MinOffset, sub.MaxOffset)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 && bs.Reference != "BOFoffset" && bs.Reference != "EOFoffset" {
+			// A variable sequence may start anywhere
+			to = -1
+		}
+		elems := []sigElem{{kind: sigGap, min: from, max: to}}
+		// Left fragments are numbered outwards from the sequence
+		lefts := append([]droidFragment{}, sub.LeftFragments...)
+		sort.SliceStable(lefts, func(i, j int) bool { return lefts[i].Position > lefts[j].Position })
+		body := []sigElem{}
+		for _, group := range groupFragments(lefts) {
+			frag, gap, err := fragmentElems(group)
+			if err != nil {
+				return nil, err
+			}
+			body = append(append(body, frag...), gap)
+		}
+		pattern, err := parseSigPattern(sub.Sequence)
+		if err != nil {
+			return nil, err
+		}
+		body = append(body, pattern...)
+		rights := append([]droidFragment{}, sub.RightFragments...)
+		sort.SliceStable(rights, func(i, j int) bool { return rights[i].Position < rights[j].Position })
+		for _, group := range groupFragments(rights) {
+			frag, gap, err := fragmentElems(group)
+			if err != nil {
+				return nil, err
+			}
+			body = append(append(body, gap), frag...)
+		}
+		if seq.fromEOF {
+			body = reverseElems(body)
+		}
+		seq.elems = append(seq.elems, append(elems, body...)...)
+	}
+	if len(seq.elems) == 0 {
+		return nil, fmt.Errorf("byte sequence has no subsequences")
+	}
+	return seq, nil
+}
+
+// groupFragments groups sorted fragments sharing a position, these are
+// alternatives.
+func groupFragments(frags []droidFragment) [][]droidFragment {
+	groups := [][]droidFragment{}
+	for i, frag := range frags {
+		if i > 0 && frag.Position == frags[i-1].Position {
+			groups[len(groups)-1] = append(groups[len(groups)-1], frag)
+			continue
+		}
+		groups = append(groups, []droidFragment{frag})
+	}
+	return groups
+}
+
+// fragmentElems returns the pattern for a group of fragments and the gap
+// between it and the sequence.
+func fragmentElems(group []droidFragment) ([]sigElem, sigElem, error) {
+	from, to, err := parseOffsets(group[0].MinOffset, group[0].MaxOffset)
+	if err != nil {
+		return nil, sigElem{}, err
+	}
+	gap := sigElem{kind: sigGap, min: from, max: to}
+	alts := [][]sigElem{}
+	for _, frag := range group {
+		pattern, err := parseSigPattern(frag.Value)
+		if err != nil {
+			return nil, gap, err
+		}
+		alts = append(alts, pattern)
+	}
+	if len(alts) == 1 {
+		return alts[0], gap, nil
+	}
+	return []sigElem{{kind: sigAlts, alts: alts}}, gap, nil
+}
+
+// parseOffsets parses a minimum and maximum offset. A missing maximum
+// means any offset.
+func parseOffsets(minOffset string, maxOffset string) (int, int, error) {
+	from, to := 0, -1
+	var err error
+	if minOffset != "" {
+		if from, err = strconv.Atoi(minOffset); err != nil {
+			return 0, 0, fmt.Errorf("bad offset %q", minOffset)
+		}
+	}
+	if maxOffset != "" {
+		if to, err = strconv.Atoi(maxOffset); err != nil {
+			return 0, 0, fmt.Errorf("bad offset %q", maxOffset)
+		}
+	}
+	return from, to, nil
+}
+
+// parseSigPattern parses a PRONOM byte pattern, e.g.
+// "FFD8FFE0{2}4A464946(00|20)[30:39]??'text'".
+func parseSigPattern(s string) ([]sigElem, error) {
+	elems, rest, err := parseSigElems(strings.Join(strings.Fields(s), ""), false)
+	if err != nil {
+		return nil, err
+	}
+	if rest != "" {
+		return nil, fmt.Errorf("bad signature pattern %q at %q", s, rest)
+	}
+	return elems, nil
+}
+
+// parseSigElems parses the elements of a pattern up to the end of an
+// alternative when inAlt is true.
+func parseSigElems(s string, inAlt bool) ([]sigElem, string, error) {
+	elems := []sigElem{}
+	for s != "" {
+		switch s[0] {
+		case '|', ')':
+			if !inAlt {
+				return nil, s, fmt.Errorf("unexpected %q", s[0])
+			}
+			return elems, s, nil
+		case '(':
+			alts := [][]sigElem{}
+			rest := s[1:]
+			for {
+				alt, r, err := parseSigElems(rest, true)
+				if err != nil {
+					return nil, s, err
+				}
+				if r == "" {
+					return nil, s, fmt.Errorf("missing ) in %q", s)
+				}
+				alts = append(alts, alt)
+				rest = r[1:]
+				if r[0] == ')' {
+					break
+				}
+			}
+			elems = append(elems, sigElem{kind: sigAlts, alts: alts})
+			s = rest
+		case '{':
+			end := strings.IndexByte(s, '}')
+			if end < 0 {
+				return nil, s, fmt.Errorf("missing } in %q", s)
+			}
+			minOffset, maxOffset, isRange := strings.Cut(s[1:end], "-")
+			if !isRange {
+				maxOffset = minOffset
+			} else if maxOffset == "*" {
+				maxOffset = ""
+			}
+			from, to, err := parseOffsets(minOffset, maxOffset)
+			if err != nil {
+				return nil, s, err
+			}
+			elems = append(elems, sigElem{kind: sigGap, min: from, max: to})
+			s = s[end+1:]
+		case '*':
+			elems = append(elems, sigElem{kind: sigGap, max: -1})
+			s = s[1:]
+		case '[':
+			end := strings.IndexByte(s, ']')
+			if end < 0 {
+				return nil, s, fmt.Errorf("missing ] in %q", s)
+			}
+			elem := sigElem{kind: sigRange}
+			r := s[1:end]
+			if strings.HasPrefix(r, "!") {
+				elem.negate, r = true, r[1:]
+			}
+			lo, hi, isRange := strings.Cut(r, ":")
+			if !isRange {
+				hi = lo
+			}
+			b, err := hex.DecodeString(lo + hi)
+			if err != nil || len(b) != 2 {
+				return nil, s, fmt.Errorf("bad byte range %q", s[:end+1])
+			}
+			elem.lo, elem.hi = b[0], b[1]
+			elems = append(elems, elem)
+			s = s[end+1:]
+		case '\'':
+			end := strings.IndexByte(s[1:], '\'')
+			if end < 0 {
+				return nil, s, fmt.Errorf("missing ' in %q", s)
+			}
+			for _, b := range []byte(s[1 : end+1]) {
+				elems = append(elems, sigElem{kind: sigByte, lo: b})
+			}
+			s = s[end+2:]
+		default:
+			if len(s) < 2 {
+				return nil, s, fmt.Errorf("bad hex byte %q", s)
+			}
+			if s[:2] == "??" {
+				elems = append(elems, sigElem{kind: sigRange, lo: 0x00, hi: 0xFF})
+			} else {
+				b, err := hex.DecodeString(s[:2])
+				if err != nil {
+					return nil, s, fmt.Errorf("bad hex byte %q", s[:2])
+				}
+				elems = append(elems, sigElem{kind: sigByte, lo: b[0]})
+			}
+			s = s[2:]
+		}
+	}
+	return elems, "", nil
+}
+
+// reverseElems reverses a pattern so it can be matched against reversed
+// content.
+func reverseElems(elems []sigElem) []sigElem {
+	reversed := make([]sigElem, len(elems))
+	for i, elem := range elems {
+		if elem.kind == sigAlts {
+			alts := make([][]sigElem, len(elem.alts))
+			for j, alt := range elem.alts {
+				alts[j] = reverseElems(alt)
+			}
+			elem.alts = alts
+		}
+		reversed[len(elems)-1-i] = elem
+	}
+	return reversed
+}
+
+// matchElems reports if a pattern matches the content at pos, trying each
+// length of gap and each alternative in turn. Each call and each length of
+// gap tried uses a step, it gives up when steps runs out.
+func matchElems(elems []sigElem, data []byte, pos int, steps *int) bool {
+	if *steps--; *steps < 0 {
+		return false
+	}
+	for i, elem := range elems {
+		switch elem.kind {
+		case sigGap:
+			longest := len(data) - pos
+			if elem.max >= 0 && elem.max < longest {
+				longest = elem.max
+			}
+			rest := elems[i+1:]
+			for skip := elem.min; skip <= longest && *steps > 0; skip++ {
+				if len(rest) > 0 && rest[0].kind == sigByte {
+					// Jump to the next occurrence of a literal byte
+					next := bytes.IndexByte(data[pos+skip:min(pos+longest+1, len(data))], rest[0].lo)
+					if next < 0 {
+						return false
+					}
+					skip += next
+				}
+				if matchElems(rest, data, pos+skip, steps) {
+					return true
+				}
+			}
+			return false
+		case sigAlts:
+			for _, alt := range elem.alts {
+				if matchElems(append(alt[:len(alt):len(alt)], elems[i+1:]...), data, pos, steps) {
+					return true
+				}
+			}
+			return false
+		case sigRange:
+			if pos >= len(data) || (data[pos] >= elem.lo && data[pos] <= elem.hi) == elem.negate {
+				return false
+			}
+			pos++
+		default:
+			if pos >= len(data) || data[pos] != elem.lo {
+				return false
+			}
+			pos++
+		}
+	}
+	return true
+}
+
+// find returns the offset from the beginning, or from the end, of the
+// file where a byte sequence matches, see matchElems for steps.
+func (seq *byteSequence) find(head []byte, reversedTail []byte, steps *int) (int, bool) {
+	data := head
+	if seq.fromEOF {
+		data = reversedTail
+	}
+	// The first element is the gap before the first subsequence
+	first := seq.elems[0]
+	longest := len(data)
+	if first.max >= 0 && first.max < longest {
+		longest = first.max
+	}
+	for offset := first.min; offset <= longest && *steps > 0; offset++ {
+		if len(seq.elems) > 1 && seq.elems[1].kind == sigByte {
+			// Jump to the next occurrence of a literal byte
+			next := bytes.IndexByte(data[min(offset, len(data)):min(longest+1, len(data))], seq.elems[1].lo)
+			if next < 0 {
+				break
+			}
+			offset += next
+		}
+		if matchElems(seq.elems[1:], data, offset, steps) {
+			return offset, true
+		}
+	}
+	return 0, false
+}
+
+// Identify returns the formats identified for a file. Formats are
+// identified by their signatures, a format with priority over another
+// replaces it. A file without a matching signature is identified by its
+// extension. No formats are returned if neither identifies the file.
+func (sigs *Signatures) Identify(fName string) ([]*Identification, error) {
+	in, err := os.Open(fName)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return nil, err
+	}
+	head := make([]byte, min(info.Size(), sigReadLen))
+	if _, err := io.ReadFull(in, head); err != nil {
+		return nil, err
+	}
+	tail := head
+	if info.Size() > sigReadLen {
+		tail = make([]byte, sigReadLen)
+		if _, err := in.ReadAt(tail, info.Size()-sigReadLen); err != nil {
+			return nil, err
+		}
+	}
+	reversedTail := []byte(reverseBytes(string(tail)))
+	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(fName)), ".")
+
+	type match struct {
+		format *pronomFormat
+		basis  []string
+	}
+	matches := []*match{}
+	for _, format := range sigs.formats {
+		for _, signature := range format.signatures {
+			basis, ok := []string{}, true
+			steps := sigStepLimit
+			for _, seq := range signature {
+				offset, found := seq.find(head, reversedTail, &steps)
+				if !found {
+					ok = false
+					break
+				}
+				if seq.fromEOF {
+					basis = append(basis, fmt.Sprintf("%d from EOF", offset))
+				} else {
+					basis = append(basis, strconv.Itoa(offset))
+				}
+			}
+			if ok {
+				matches = append(matches, &match{format: format, basis: basis})
+				break
+			}
+		}
+	}
+	// Drop the formats another match has priority over
+	replaced := make(map[int]bool)
+	for _, m := range matches {
+		for _, id := range m.format.priorityOver {
+			replaced[id] = true
+		}
+	}
+	ids := []*Identification{}
+	for _, m := range matches {
+		if replaced[m.format.id] {
+			continue
+		}
+		id := m.format.identification()
+		id.Basis = "byte match at " + strings.Join(m.basis, ", ")
+		if m.format.hasExtension(ext) {
+			id.Basis = "extension match " + ext + "; " + id.Basis
+		} else if len(m.format.extensions) > 0 {
+			id.Warning = "extension mismatch"
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) > 0 || ext == "" {
+		return ids, nil
+	}
+	for _, format := range sigs.formats {
+		if format.hasExtension(ext) {
+			id := format.identification()
+			id.Basis = "extension match " + ext
+			id.Warning = "match on extension only"
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// identification returns an identification of a format without a basis.
+func (format *pronomFormat) identification() *Identification {
+	return &Identification{
+		PUID:     format.puid,
+		Name:     format.name,
+		Version:  format.version,
+		MIMEType: format.mimeType,
+	}
+}
+
+// hasExtension reports if an extension, without the ".", is one of the
+// format's extensions.
+func (format *pronomFormat) hasExtension(ext string) bool {
+	for _, e := range format.extensions {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// IdentifyFiles walks a directory like FileTypesWithFilter and identifies
+// the format of each file found. Files which can't be read are reported
+// and skipped.
+func IdentifyFiles(ctx context.Context, initialDir string, excludeList []string, filter *FileFilter, sigs *Signatures) (map[string][]*Identification, error) {
+	identified := make(map[string][]*Identification)
+	var lastErr error
+	err := walkFiles(ctx, initialDir, excludeList, filter, func(path string) error {
+		ids, err := sigs.Identify(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "skipping %s: %s\n", path, err)
+			lastErr = err
+			return nil
+		}
+		identified[path] = ids
+		return nil
+	})
+	if err == nil {
+		err = lastErr
+	}
+	return identified, err
+}
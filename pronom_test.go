@@ -0,0 +1,227 @@
+package analysistools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSigPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		data    string
+		want    bool
+	}{
+		{pattern: "255044462D", data: "%PDF-1.4", want: true},
+		{pattern: "255044462D", data: "%PDX-1.4", want: false},
+		{pattern: "25??44", data: "%ZD", want: true},
+		{pattern: "25{2}46", data: "%PDF", want: true},
+		{pattern: "25{0-3}46", data: "%PDF", want: true},
+		{pattern: "25{0-1}46", data: "%PDF", want: false},
+		{pattern: "25{1-*}46", data: "%PD......F", want: true},
+		{pattern: "(4949|4D4D)2A", data: "MM*", want: true},
+		{pattern: "(4949|4D4D)2A", data: "IM*", want: false},
+		{pattern: "[30:39][!30:39]", data: "7a", want: true},
+		{pattern: "[30:39][!30:39]", data: "77", want: false},
+		{pattern: "'PK'0304", data: "PK\x03\x04", want: true},
+	}
+	for _, test := range tests {
+		elems, err := parseSigPattern(test.pattern)
+		if err != nil {
+			t.Errorf("%s: %s", test.pattern, err)
+			continue
+		}
+		steps := sigStepLimit
+		if got := matchElems(elems, []byte(test.data), 0, &steps); got != test.want {
+			t.Errorf("%s matching %q: expected %t, got %t", test.pattern, test.data, test.want, got)
+		}
+	}
+	for _, pattern := range []string{"2", "ZZ", "(25|26", "{2", "[30:3]", "25)"} {
+		if _, err := parseSigPattern(pattern); err == nil {
+			t.Errorf("%s: expected an error", pattern)
+		}
+	}
+}
+
+func TestLoadSignatures(t *testing.T) {
+	// Fragments, a variable sequence and an EOF sequence as found in the
+	// DROID signature files
+	src := `<?xml version="1.0" encoding="UTF-8"?>
+<FFSignatureFile xmlns="http://www.nationalarchives.gov.uk/pronom/SignatureFile" Version="42">
+  <InternalSignatureCollection>
+    <InternalSignature ID="1">
+      <ByteSequence Reference="BOFoffset">
+        <SubSequence Position="1" SubSeqMinOffset="0" SubSeqMaxOffset="4">
+          <Sequence>43415345</Sequence>
+          <DefaultShift>5</DefaultShift>
+          <LeftFragment MaxOffset="1" MinOffset="0" Position="1">23</LeftFragment>
+          <RightFragment MaxOffset="0" MinOffset="0" Position="1">3A</RightFragment>
+          <RightFragment MaxOffset="0" MinOffset="0" Position="1">2D</RightFragment>
+        </SubSequence>
+      </ByteSequence>
+      <ByteSequence Reference="EOFoffset">
+        <SubSequence Position="1" SubSeqMinOffset="0" SubSeqMaxOffset="2">
+          <Sequence>454E44</Sequence>
+        </SubSequence>
+      </ByteSequence>
+    </InternalSignature>
+    <InternalSignature ID="2">
+      <ByteSequence>
+        <SubSequence Position="1" SubSeqMinOffset="0">
+          <Sequence>4A5544474D454E54</Sequence>
+        </SubSequence>
+      </ByteSequence>
+    </InternalSignature>
+  </InternalSignatureCollection>
+  <FileFormatCollection>
+    <FileFormat ID="1" Name="Case File" PUID="x-fmt/9001" Version="1" MIMEType="text/x-case">
+      <InternalSignatureID>1</InternalSignatureID>
+      <Extension>case</Extension>
+    </FileFormat>
+    <FileFormat ID="2" Name="Judgment" PUID="x-fmt/9002">
+      <InternalSignatureID>2</InternalSignatureID>
+      <Extension>jdg</Extension>
+      <HasPriorityOverFileFormatID>1</HasPriorityOverFileFormatID>
+    </FileFormat>
+  </FileFormatCollection>
+</FFSignatureFile>
+`
+	dir := t.TempDir()
+	sigFile := filepath.Join(dir, "signatures.xml")
+	if err := os.WriteFile(sigFile, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sigs, err := LoadSignatures(sigFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sigs.Version != "42" {
+		t.Errorf("expected version 42, got %q", sigs.Version)
+	}
+	tests := []struct {
+		name  string
+		src   string
+		want  string
+		basis string
+	}{
+		{name: "a.case", src: "  #CASE:1234 END\n", want: "x-fmt/9001", basis: "extension match case; byte match at 2, 1 from EOF"},
+		{name: "b.case", src: "#CASE-1234 END", want: "x-fmt/9001", basis: "extension match case; byte match at 0, 0 from EOF"},
+		{name: "c.case", src: "#CASE 1234 END", want: "x-fmt/9001", basis: "extension match case"},
+		{name: "d.case", src: "#CASE:1234 END...", want: "x-fmt/9001", basis: "extension match case"},
+		{name: "e.txt", src: "#CASE:1234 the JUDGMENT follows END", want: "x-fmt/9002", basis: "byte match at 15"},
+		{name: "f.txt", src: "nothing to see", want: "", basis: ""},
+	}
+	for _, test := range tests {
+		fName := filepath.Join(dir, test.name)
+		if err := os.WriteFile(fName, []byte(test.src), 0644); err != nil {
+			t.Fatal(err)
+		}
+		ids, err := sigs.Identify(fName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, basis := "", ""
+		if len(ids) > 0 {
+			got, basis = ids[0].PUID, ids[0].Basis
+		}
+		if len(ids) > 1 {
+			t.Errorf("%s: expected one format, got %d", test.name, len(ids))
+		}
+		if got != test.want || basis != test.basis {
+			t.Errorf("%s: expected %q %q, got %q %q", test.name, test.want, test.basis, got, basis)
+		}
+	}
+}
+
+func TestIdentifyFiles(t *testing.T) {
+	sigs, err := BundledSignatures()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	tar := make([]byte, 512)
+	copy(tar, "memo.txt")
+	copy(tar[257:], "ustar\x0000")
+	files := []struct {
+		name    string
+		src     []byte
+		puid    string
+		warning string
+	}{
+		{name: "brief.pdf", src: []byte("%PDF-1.4\n1 0 obj\n<<>>\nendobj\n%%EOF\n"), puid: "fmt/18"},
+		{name: "memo.doc", src: []byte("%PDF-1.7\n%%EOF\n"), puid: "fmt/276", warning: "extension mismatch"},
+		{name: "photo.jpg", src: []byte("\xFF\xD8\xFF\xE0\x00\x10JFIF\x00\x01\x01\x00\x00\x01"), puid: "fmt/43"},
+		{name: "scan.jpg", src: []byte("\xFF\xD8\xFF\xE1\x00\x10Exif\x00\x00"), puid: "fmt/41"},
+		{name: "report.docx", src: zipFile(t, "", "[Content_Types].xml", "_rels/.rels", "word/document.xml"), puid: "fmt/412"},
+		{name: "papers.zip", src: zipFile(t, "", "a.txt"), puid: "x-fmt/263"},
+		{name: "letter.doc", src: oleFile("WordDocument"), puid: "fmt/111", warning: ""},
+		{name: "exhibits.tar", src: tar, puid: "x-fmt/265"},
+		{name: "index.xml", src: []byte("\xEF\xBB\xBF<?xml version=\"1.0\"?>\n<case/>\n"), puid: "fmt/101"},
+		{name: "notes.txt", src: []byte("See the memo.\n"), puid: "x-fmt/111", warning: "match on extension only"},
+		{name: "unknown.bin", src: []byte("\x00\x01\x02"), puid: "", warning: ""},
+	}
+	tree := map[string][]byte{}
+	for _, f := range files {
+		tree[f.name] = f.src
+	}
+	writeTree(t, dir, tree)
+	identified, err := IdentifyFiles(context.Background(), dir, nil, nil, sigs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		ids := identified[filepath.Join(dir, f.name)]
+		puids, warning := []string{}, ""
+		for _, id := range ids {
+			puids = append(puids, id.PUID)
+			warning = id.Warning
+		}
+		if got := strings.Join(puids, " "); got != f.puid || warning != f.warning {
+			t.Errorf("%s: expected %q %q, got %q %q", f.name, f.puid, f.warning, got, warning)
+		}
+	}
+}
+
+func TestSignatureStepLimit(t *testing.T) {
+	// The bundled signature file with a signature whose gaps backtrack
+	// through every combination of their lengths on a run of one byte
+	src := strings.Replace(string(bundledSignatureFile), "</InternalSignatureCollection>", `<InternalSignature ID="9999">
+      <ByteSequence>
+        <SubSequence Position="1" SubSeqMinOffset="0">
+          <Sequence>61*61*61*61*61*62</Sequence>
+        </SubSequence>
+      </ByteSequence>
+    </InternalSignature>
+  </InternalSignatureCollection>`, 1)
+	src = strings.Replace(src, "</FileFormatCollection>", `<FileFormat ID="9999" Name="Backtracking" PUID="x-fmt/9999">
+      <InternalSignatureID>9999</InternalSignatureID>
+    </FileFormat>
+  </FileFormatCollection>`, 1)
+	sigs, err := ParseSignatures([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"run.txt": strings.Repeat("a", sigReadLen),
+		// Repeated near misses of the OOXML part names
+		"parts.docx": "PK\x03\x04" + strings.Repeat("[Content_Types].xm word/document.xm", sigReadLen/36),
+	})
+	start := time.Now()
+	identified, err := IdentifyFiles(context.Background(), dir, nil, nil, sigs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("expected the step limit to stop the signatures early, took %s", elapsed)
+	}
+	for name, puid := range map[string]string{"run.txt": "x-fmt/111", "parts.docx": "x-fmt/263"} {
+		ids := identified[filepath.Join(dir, name)]
+		if len(ids) != 1 || ids[0].PUID != puid {
+			t.Errorf("%s: expected %s, got %+v", name, puid, ids)
+		}
+	}
+}
@@ -0,0 +1,378 @@
+package analysistools
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	// The pure Go SQLite driver, registered as "sqlite"
+	_ "modernc.org/sqlite"
+)
+
+// resultsMigrations upgrade a results database one schema version at a
+// time. The database's PRAGMA user_version holds the number applied. Add
+// a migration to change the schema, never edit one which has been
+// released. See results_database.md for the schema.
+var resultsMigrations = []string{
+	// Version 1, runs, the files checked, the patterns and their matches
+	`CREATE TABLE runs (
+	run_id INTEGER PRIMARY KEY,
+	action TEXT NOT NULL,
+	arguments TEXT NOT NULL,
+	started TEXT NOT NULL,
+	finished TEXT,
+	status TEXT NOT NULL,
+	error TEXT
+);
+CREATE TABLE files (
+	file_id INTEGER PRIMARY KEY,
+	run_id INTEGER NOT NULL REFERENCES runs(run_id),
+	path TEXT NOT NULL,
+	size INTEGER NOT NULL,
+	mime_type TEXT NOT NULL,
+	sha256 TEXT
+);
+CREATE INDEX files_run_path ON files(run_id, path);
+CREATE INDEX files_sha256 ON files(sha256);
+CREATE TABLE patterns (
+	pattern_id INTEGER PRIMARY KEY,
+	run_id INTEGER NOT NULL REFERENCES runs(run_id),
+	pattern TEXT NOT NULL,
+	pattern_type TEXT NOT NULL,
+	UNIQUE(run_id, pattern)
+);
+CREATE TABLE matches (
+	match_id INTEGER PRIMARY KEY,
+	file_id INTEGER NOT NULL REFERENCES files(file_id),
+	pattern_id INTEGER NOT NULL REFERENCES patterns(pattern_id),
+	phrase TEXT NOT NULL,
+	line_no INTEGER NOT NULL,
+	word_no INTEGER NOT NULL,
+	column_no INTEGER NOT NULL,
+	end_column INTEGER NOT NULL,
+	start_offset INTEGER NOT NULL,
+	end_offset INTEGER NOT NULL,
+	keyword2 TEXT,
+	keyword2_line_no INTEGER,
+	distance INTEGER,
+	context_before TEXT,
+	context_after TEXT
+);
+CREATE INDEX matches_file ON matches(file_id);
+CREATE INDEX matches_pattern ON matches(pattern_id);`,
+	// Version 2, the page of a match and the documents without
+	// extractable text
+	`ALTER TABLE matches ADD COLUMN page_no INTEGER;
+ALTER TABLE files ADD COLUMN no_text INTEGER NOT NULL DEFAULT 0;`,
+	// Version 3, the error of a file whose check couldn't be completed
+	`ALTER TABLE files ADD COLUMN error TEXT;`,
+}
+
+// ResultsDB is a SQLite database holding the results of check runs. Each
+// run is appended under a new run ID.
+type ResultsDB struct {
+	db *sql.DB
+}
+
+// OpenResultsDB opens, or creates, a results database and upgrades its
+// schema to the current version.
+func OpenResultsDB(fName string) (*ResultsDB, error) {
+	db, err := sql.Open("sqlite", "file:"+fName+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	// A single connection keeps the writes in order
+	db.SetMaxOpenConns(1)
+	rdb := &ResultsDB{db: db}
+	if err := rdb.migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s: %w", fName, err)
+	}
+	return rdb, nil
+}
+
+// SchemaVersion returns the version of the database's schema.
+func (rdb *ResultsDB) SchemaVersion() (int, error) {
+	version := 0
+	err := rdb.db.QueryRow("PRAGMA user_version").Scan(&version)
+	return version, err
+}
+
+// migrate applies the migrations the database doesn't have yet, each in
+// its own transaction.
+func (rdb *ResultsDB) migrate() error {
+	version, err := rdb.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	if version > len(resultsMigrations) {
+		return fmt.Errorf("schema version %d is newer than this program's %d", version, len(resultsMigrations))
+	}
+	for ; version < len(resultsMigrations); version++ {
+		tx, err := rdb.db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(resultsMigrations[version]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migrating to schema version %d, %s", version+1, err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the database.
+func (rdb *ResultsDB) Close() error {
+	return rdb.db.Close()
+}
+
+// ResultsRun records the files checked and the matches found by a run.
+type ResultsRun struct {
+	ID int64
+	db *sql.DB
+	// patternIDs maps a pattern's text to its row
+	patternIDs map[string]int64
+}
+
+// StartRun adds a run of the action, with its command line arguments,
+// and the patterns it checks for.
+func (rdb *ResultsDB) StartRun(action string, arguments []string, patterns []*Pattern) (*ResultsRun, error) {
+	src, err := json.Marshal(arguments)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := rdb.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	result, err := tx.Exec(`INSERT INTO runs (action, arguments, started, status) VALUES (?, ?, ?, 'running')`,
+		action, string(src), time.Now().Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	run := &ResultsRun{db: rdb.db, patternIDs: make(map[string]int64)}
+	if run.ID, err = result.LastInsertId(); err != nil {
+		return nil, err
+	}
+	for _, pattern := range patterns {
+		if _, ok := run.patternIDs[pattern.OriginalText]; ok {
+			continue
+		}
+		result, err := tx.Exec(`INSERT INTO patterns (run_id, pattern, pattern_type) VALUES (?, ?, ?)`,
+			run.ID, pattern.OriginalText, string(pattern.Type))
+		if err != nil {
+			return nil, err
+		}
+		if run.patternIDs[pattern.OriginalText], err = result.LastInsertId(); err != nil {
+			return nil, err
+		}
+	}
+	return run, tx.Commit()
+}
+
+// CheckedFile describes a file checked by a run.
+type CheckedFile struct {
+	Path     string
+	Size     int64
+	MimeType string
+	// SHA256 is the hex encoded digest of the file's content, empty if
+	// the file wasn't read to the end
+	SHA256 string
+	// NoText is set for a document without extractable text, e.g. a
+	// scanned PDF needing OCR
+	NoText bool
+	// Error is set when the check couldn't be completed, e.g. a boolean
+	// expression over ErrBooleanLimit, the matches found are recorded
+	Error string
+}
+
+// AddFile records a file and its matches in a single transaction.
+func (run *ResultsRun) AddFile(file *CheckedFile, matches []*Matched) error {
+	tx, err := run.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	result, err := tx.Exec(`INSERT INTO files (run_id, path, size, mime_type, sha256, no_text, error) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		run.ID, file.Path, file.Size, file.MimeType, nullString(file.SHA256), file.NoText, nullString(file.Error))
+	if err != nil {
+		return err
+	}
+	fileID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(`INSERT INTO matches (file_id, pattern_id, phrase, line_no, page_no, word_no, column_no, end_column,
+	start_offset, end_offset, keyword2, keyword2_line_no, distance, context_before, context_after) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, m := range matches {
+		patternID, ok := run.patternIDs[m.Pattern]
+		if !ok {
+			return fmt.Errorf("pattern %q isn't part of run %d", m.Pattern, run.ID)
+		}
+		var keyword2LineNo, distance any
+		if m.Keyword2Text != "" {
+			keyword2LineNo, distance = m.Keyword2LineNo, m.Distance
+		}
+		if _, err := stmt.Exec(fileID, patternID, m.Text, m.LineNo, m.PageNo, m.WordNo, m.Column, m.EndColumn,
+			m.StartOffset, m.EndOffset, nullString(m.Keyword2Text), keyword2LineNo, distance, nullString(m.Before), nullString(m.After)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Finish records the end of a run, its status is "completed", "partial"
+// if it was cancelled or timed out or "failed".
+func (run *ResultsRun) Finish(runErr error) error {
+	status := "completed"
+	var errText any
+	if runErr != nil {
+		status = "failed"
+		if errors.Is(runErr, ErrPartialResults) {
+			status = "partial"
+		}
+		errText = runErr.Error()
+	}
+	_, err := run.db.Exec(`UPDATE runs SET finished = ?, status = ?, error = ? WHERE run_id = ?`,
+		time.Now().Format(time.RFC3339), status, errText, run.ID)
+	return err
+}
+
+// recordFile checks a file returning its details and matches. The file is
+// hashed as it is read.
+func recordFile(ctx context.Context, fName string, matcher *Matcher, options *CheckOptions) (*CheckedFile, []*Matched, error) {
+	fileCtx, cancel := fileContext(ctx, options)
+	defer cancel()
+	in, err := os.Open(fName)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	file := &CheckedFile{Path: fName, Size: info.Size(), MimeType: mimeTypeOf(filepath.Ext(fName))}
+	h := sha256.New()
+	text, doc, err := extractText(fileCtx, in)
+	if err != nil {
+		// Like checkFile the document is skipped, it is recorded without
+		// matches or a digest
+		return file, nil, skipFileTimeout(ctx, fName, skipExtractError(fName, err))
+	}
+	if doc == nil {
+		text = io.TeeReader(in, h)
+	}
+	matches := []*Matched{}
+	err = checkText(fileCtx, matcher, text, options, func(match *Matched) error {
+		matches = append(matches, match)
+		return nil
+	})
+	var limitErr error
+	if errors.Is(err, ErrBooleanLimit) {
+		file.Error = err.Error()
+		limitErr, err = err, nil
+	}
+	if err == nil {
+		file.NoText = doc != nil && !doc.hasText
+		// A match-one check stops reading at the first match, an
+		// extracted document is hashed from the start
+		if doc != nil {
+			_, err = in.Seek(0, io.SeekStart)
+		}
+		if err == nil {
+			if _, err = io.Copy(h, &ctxReader{ctx: ctx, r: in}); err == nil {
+				file.SHA256 = hex.EncodeToString(h.Sum(nil))
+			}
+		}
+	}
+	if err == nil {
+		err = limitErr
+	}
+	return file, matches, skipFileTimeout(ctx, fName, err)
+}
+
+// recordFileReport checks a file returning the function recording it in
+// the run, see walkFilesParallel. An ErrBooleanLimit error is returned by
+// the function once the file is recorded.
+func recordFileReport(ctx context.Context, run *ResultsRun, fName string, matcher *Matcher, options *CheckOptions) (func() error, error) {
+	file, matches, err := recordFile(ctx, fName, matcher, options)
+	if file == nil {
+		return nil, err
+	}
+	var limitErr error
+	if errors.Is(err, ErrBooleanLimit) {
+		limitErr, err = err, nil
+	}
+	return func() error {
+		if err := run.AddFile(file, matches); err != nil {
+			return err
+		}
+		if file.NoText {
+			return reportNoText(fName, options)
+		}
+		return limitErr
+	}, err
+}
+
+// recordDirectory walks a directory like checkDirectory recording the
+// files checked and their matches in a run.
+func recordDirectory(ctx context.Context, run *ResultsRun, startDir string, patterns []*Pattern, excludeList []string, options *CheckOptions) error {
+	matcher := NewMatcher(patterns)
+	errs := &fileErrors{}
+	check := func(path string) (func() error, error) {
+		report, err := recordFileReport(ctx, run, path, matcher, options)
+		if report == nil {
+			return nil, err
+		}
+		return func() error {
+			return errs.keep(path, report())
+		}, err
+	}
+	if options.Workers > 1 {
+		return errs.result(walkFilesParallel(ctx, startDir, excludeList, options.Filter, options.Workers, check))
+	}
+	return errs.result(walkFiles(ctx, startDir, excludeList, options.Filter, func(path string) error {
+		return reportFile(check(path))
+	}))
+}
+
+// recordRun opens a results database and records a run of an action.
+// The run's ID is reported on standard error.
+func recordRun(dbName string, action string, arguments []string, patterns []*Pattern, fn func(*ResultsRun) error) error {
+	rdb, err := OpenResultsDB(dbName)
+	if err != nil {
+		return err
+	}
+	defer rdb.Close()
+	run, err := rdb.StartRun(action, arguments, patterns)
+	if err != nil {
+		return err
+	}
+	err = fn(run)
+	if finishErr := run.Finish(err); finishErr != nil && err == nil {
+		err = finishErr
+	}
+	fmt.Fprintf(os.Stderr, "run %d recorded in %s\n", run.ID, dbName)
+	return err
+}
@@ -0,0 +1,118 @@
+package analysistools
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResultsDB(t *testing.T) {
+	dir := t.TempDir()
+	docs := filepath.Join(dir, "docs")
+	files := map[string]string{
+		"memo.txt":   "the attorney client privilege applies\nno attorney here\n",
+		"notes.txt":  "nothing to see\n",
+		"letter.txt": "ask the attorney\n",
+	}
+	writeTree(t, docs, files)
+	patterns := []*Pattern{}
+	for _, src := range []string{"attorney", "client w/3 privilege", "attorney"} {
+		pattern, err := ParsePattern(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	dbName := filepath.Join(dir, "results.db")
+	runs := []*CheckOptions{
+		{Context: 1, Workers: 1},
+		{Workers: 2, MatchOne: true},
+	}
+	for i, options := range runs {
+		rdb, err := OpenResultsDB(dbName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		run, err := rdb.StartRun("check-directory", []string{"patterns.txt", docs}, patterns)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if run.ID != int64(i+1) {
+			t.Errorf("expected run %d, got %d", i+1, run.ID)
+		}
+		err = recordDirectory(context.Background(), run, docs, patterns, nil, options)
+		if err := run.Finish(err); err != nil {
+			t.Fatal(err)
+		}
+		rdb.Close()
+	}
+
+	db, err := sql.Open("sqlite", dbName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	rows, err := db.Query(`SELECT r.run_id, r.status, f.path, f.sha256, p.pattern, m.phrase, m.line_no, m.word_no,
+	IFNULL(m.keyword2, ''), IFNULL(m.context_before, ''), IFNULL(m.context_after, '')
+	FROM matches m JOIN files f USING (file_id) JOIN patterns p USING (pattern_id) JOIN runs r ON r.run_id = f.run_id
+	ORDER BY m.match_id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	got := []string{}
+	for rows.Next() {
+		var (
+			runID, lineNo, wordNo int
+			status, path, digest, pattern, phrase, keyword2, before, after string
+		)
+		if err := rows.Scan(&runID, &status, &path, &digest, &pattern, &phrase, &lineNo, &wordNo, &keyword2, &before, &after); err != nil {
+			t.Fatal(err)
+		}
+		sum := sha256.Sum256([]byte(files[filepath.Base(path)]))
+		if digest != hex.EncodeToString(sum[:]) {
+			t.Errorf("run %d %s: expected the file's sha256, got %q", runID, path, digest)
+		}
+		got = append(got, fmt.Sprintf("%d %s %s %q %q %d %d %q %q %q", runID, status, filepath.Base(path), pattern, phrase, lineNo, wordNo, keyword2, before, after))
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		// The repeated pattern is reported twice, as in the CSV report
+		`1 completed letter.txt "attorney" "attorney" 0 2 "" "the" ""`,
+		`1 completed letter.txt "attorney" "attorney" 0 2 "" "the" ""`,
+		`1 completed memo.txt "attorney" "attorney" 0 1 "" "the" "client"`,
+		`1 completed memo.txt "attorney" "attorney" 1 6 "" "no" "here"`,
+		`1 completed memo.txt "client w/3 privilege" "client" 0 2 "privilege" "attorney" "privilege"`,
+		`1 completed memo.txt "attorney" "attorney" 0 1 "" "the" "client"`,
+		`1 completed memo.txt "attorney" "attorney" 1 6 "" "no" "here"`,
+		// Match one records every match of the first pattern matched
+		`2 completed letter.txt "attorney" "attorney" 0 2 "" "" ""`,
+		`2 completed memo.txt "attorney" "attorney" 0 1 "" "" ""`,
+		`2 completed memo.txt "attorney" "attorney" 1 6 "" "" ""`,
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+	count := 0
+	if err := db.QueryRow(`SELECT COUNT(*) FROM files WHERE run_id = 2`).Scan(&count); err != nil || count != 3 {
+		t.Errorf("expected run 2 to record 3 files, got %d %v", count, err)
+	}
+	if err := db.QueryRow(`SELECT COUNT(*) FROM patterns WHERE run_id = 1`).Scan(&count); err != nil || count != 2 {
+		t.Errorf("expected run 1 to record 2 distinct patterns, got %d %v", count, err)
+	}
+
+	// A database from a newer version isn't changed
+	if _, err := db.Exec(fmt.Sprintf("PRAGMA user_version = %d", len(resultsMigrations)+1)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenResultsDB(dbName); err == nil {
+		t.Errorf("expected an error opening a database with a newer schema")
+	}
+}
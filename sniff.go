@@ -0,0 +1,307 @@
+package analysistools
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+)
+
+// FileType holds the MIME type of a file based on its extension and the
+// MIME type sniffed from its content.
+type FileType struct {
+	Path          string
+	ExtensionType string
+	SniffedType   string
+	// Mismatch is true when the extension and content disagree, e.g. a PDF
+	// renamed "memo.doc". Files without a known extension or with content
+	// which can't be identified are not flagged.
+	Mismatch bool
+}
+
+const (
+	octetStream = "application/octet-stream"
+	// sniffLen is the number of bytes read to identify a file
+	sniffLen = 4096
+)
+
+var (
+	oleSignature = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+	zipSignature = []byte("PK\x03\x04")
+	pdfSignature = []byte("%PDF-")
+	// mboxFromLine matches the "From " line starting each message in an mbox
+	mboxFromLine = regexp.MustCompile(`^From \S+ .*\d{1,2}:\d{2}`)
+	// emailHeaders are the headers expected at the start of an email
+	emailHeaders = map[string]bool{
+		"from": true, "to": true, "cc": true, "subject": true, "date": true,
+		"message-id": true, "mime-version": true, "received": true,
+		"return-path": true, "delivered-to": true, "reply-to": true,
+		"content-type": true, "x-mailer": true,
+	}
+)
+
+// SniffContentType identifies the MIME type of a file from its content.
+// It recognizes PDF, the OOXML and ODF office formats, ZIP, OLE2 (older
+// Microsoft Office and Outlook files), mbox and email messages and falls
+// back on http.DetectContentType. The result has no parameters, e.g.
+// "text/plain" rather than "text/plain; charset=utf-8".
+func SniffContentType(fName string) (string, error) {
+	in, err := os.Open(fName)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return "", err
+	}
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(in, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	return sniffContent(in, info.Size(), head[:n]), nil
+}
+
+// sniffContent identifies content from its first bytes. The reader is
+// used to look inside ZIP and OLE2 containers.
+func sniffContent(r io.ReaderAt, size int64, head []byte) string {
+	switch {
+	case len(head) == 0:
+		return octetStream
+	case isPDF(head):
+		return "application/pdf"
+	case bytes.HasPrefix(head, zipSignature):
+		return sniffZip(r, size)
+	case bytes.HasPrefix(head, oleSignature):
+		return sniffOLE(r, head)
+	case mboxFromLine.Match(head):
+		return "application/mbox"
+	case isEmail(head):
+		return "message/rfc822"
+	}
+	mimeType, _, err := mime.ParseMediaType(http.DetectContentType(head))
+	if err != nil {
+		return octetStream
+	}
+	return mimeType
+}
+
+// sniffZip identifies the ODF, EPUB and OOXML formats stored in a ZIP file.
+func sniffZip(r io.ReaderAt, size int64) string {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return "application/zip"
+	}
+	isOOXML := false
+	for _, f := range zr.File {
+		switch {
+		case f.Name == "mimetype":
+			// ODF and EPUB store their MIME type as the first file
+			if mr, err := f.Open(); err == nil {
+				buf, _ := io.ReadAll(io.LimitReader(mr, 128))
+				mr.Close()
+				if mimeType := strings.TrimSpace(string(buf)); strings.Contains(mimeType, "/") {
+					return mimeType
+				}
+			}
+		case f.Name == "[Content_Types].xml":
+			isOOXML = true
+		}
+	}
+	if isOOXML {
+		for _, f := range zr.File {
+			switch {
+			case strings.HasPrefix(f.Name, "word/"):
+				return "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+			case strings.HasPrefix(f.Name, "xl/"):
+				return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+			case strings.HasPrefix(f.Name, "ppt/"):
+				return "application/vnd.openxmlformats-officedocument.presentationml.presentation"
+			case strings.HasPrefix(f.Name, "visio/"):
+				return "application/vnd.ms-visio.drawing.main+xml"
+			}
+		}
+	}
+	return "application/zip"
+}
+
+// sniffOLE identifies the Office format stored in an OLE2 compound file
+// from the names of the streams in its first directory sector.
+func sniffOLE(r io.ReaderAt, head []byte) string {
+	if len(head) < 512 {
+		return "application/x-ole-storage"
+	}
+	sectorSize := int64(1) << binary.LittleEndian.Uint16(head[0x1E:])
+	dirSector := int64(binary.LittleEndian.Uint32(head[0x30:]))
+	if sectorSize < 128 || sectorSize > 65536 {
+		return "application/x-ole-storage"
+	}
+	dir := make([]byte, sectorSize)
+	if n, _ := r.ReadAt(dir, (dirSector+1)*sectorSize); n < 128 {
+		return "application/x-ole-storage"
+	}
+	// Each directory entry is 128 bytes starting with a UTF-16 name
+	for entry := dir; len(entry) >= 128; entry = entry[128:] {
+		nameLen := int(binary.LittleEndian.Uint16(entry[64:]))
+		if nameLen < 2 || nameLen > 64 {
+			continue
+		}
+		u := make([]uint16, nameLen/2-1)
+		for i := range u {
+			u[i] = binary.LittleEndian.Uint16(entry[i*2:])
+		}
+		switch name := string(utf16.Decode(u)); {
+		case name == "WordDocument":
+			return "application/msword"
+		case name == "Workbook" || name == "Book":
+			return "application/vnd.ms-excel"
+		case name == "PowerPoint Document":
+			return "application/vnd.ms-powerpoint"
+		case strings.HasPrefix(name, "__substg1.0_"):
+			return "application/vnd.ms-outlook"
+		}
+	}
+	return "application/x-ole-storage"
+}
+
+// isPDF reports if content starts with the PDF signature. Like PRONOM it
+// allows leading whitespace or a UTF-8 byte order mark.
+func isPDF(head []byte) bool {
+	head = bytes.TrimPrefix(head, []byte("\xef\xbb\xbf"))
+	return bytes.HasPrefix(bytes.TrimLeft(head, " \t\r\n\f"), pdfSignature)
+}
+
+// isEmail reports if content starts with email headers.
+func isEmail(head []byte) bool {
+	known := 0
+	for i, line := range strings.Split(string(head), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "" {
+			break
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			// A folded header continues the previous line
+			continue
+		}
+		name, _, ok := strings.Cut(line, ":")
+		if !ok || name == "" || strings.ContainsAny(name, " \t") {
+			if i == 0 {
+				return false
+			}
+			break
+		}
+		if emailHeaders[strings.ToLower(name)] {
+			known++
+		}
+	}
+	return known >= 2
+}
+
+// mimeFamilies groups the MIME types which share a container so a
+// sniffed type can be compared with the one from the extension.
+var mimeFamilies = map[string]string{
+	"application/x-ole-storage":              "ole2",
+	"application/msword":                     "ole2",
+	"application/vnd.ms-excel":               "ole2",
+	"application/vnd.ms-powerpoint":          "ole2",
+	"application/vnd.ms-outlook":             "ole2",
+	"application/vnd.visio":                  "ole2",
+	"application/x-mspublisher":              "ole2",
+	"application/x-msi":                      "ole2",
+	"application/zip":                        "zip",
+	"application/java-archive":               "zip",
+	"application/epub+zip":                   "zip",
+	"application/x-iwork-pages-sffpages":     "zip",
+	"application/x-iwork-numbers-sffnumbers": "zip",
+	"application/x-iwork-keynote-sffkey":     "zip",
+}
+
+// mimeFamily returns the family of a MIME type or the type itself.
+func mimeFamily(mimeType string) string {
+	// Documents and their templates share a format, e.g. .docx and .dotx
+	for _, format := range []string{"wordprocessingml", "spreadsheetml", "presentationml"} {
+		if strings.Contains(mimeType, "openxmlformats-officedocument."+format) {
+			return format
+		}
+	}
+	if family, ok := mimeFamilies[mimeType]; ok {
+		return family
+	}
+	return mimeType
+}
+
+// isTextType reports if files of a MIME type are text.
+func isTextType(mimeType string) bool {
+	if strings.HasPrefix(mimeType, "text/") {
+		return true
+	}
+	for _, suffix := range []string{"xml", "json", "javascript", "sql", "x-sh", "x-plist"} {
+		if strings.HasSuffix(mimeType, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// typesAgree reports if the type from a file's extension and its sniffed
+// type agree.
+func typesAgree(extensionType string, sniffedType string) bool {
+	switch {
+	case extensionType == octetStream || sniffedType == octetStream:
+		// Nothing to compare with
+		return true
+	case extensionType == sniffedType || mimeFamily(extensionType) == mimeFamily(sniffedType):
+		return true
+	case strings.HasPrefix(sniffedType, "text/"):
+		// Source code, data and markup are sniffed as plain text, XML or HTML
+		return isTextType(extensionType)
+	}
+	return false
+}
+
+// DetectFileType returns the extension and sniffed MIME types of a file.
+func DetectFileType(fName string) (*FileType, error) {
+	sniffed, err := SniffContentType(fName)
+	if err != nil {
+		return nil, err
+	}
+	ft := &FileType{
+		Path:          fName,
+		ExtensionType: mimeTypeOf(filepath.Ext(fName)),
+		SniffedType:   sniffed,
+	}
+	ft.Mismatch = !typesAgree(ft.ExtensionType, ft.SniffedType)
+	return ft, nil
+}
+
+// DetectFileTypes walks a directory like FileTypesWithFilter and sniffs
+// the content of each file found. Files which can't be read are reported
+// and skipped.
+func DetectFileTypes(ctx context.Context, initialDir string, excludeList []string, filter *FileFilter) (map[string]*FileType, error) {
+	fileTypes := make(map[string]*FileType)
+	var lastErr error
+	err := walkFiles(ctx, initialDir, excludeList, filter, func(path string) error {
+		ft, err := DetectFileType(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "skipping %s: %s\n", path, err)
+			lastErr = err
+			return nil
+		}
+		fileTypes[path] = ft
+		return nil
+	})
+	if err == nil {
+		err = lastErr
+	}
+	return fileTypes, err
+}
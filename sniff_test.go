@@ -0,0 +1,110 @@
+package analysistools
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"path/filepath"
+	"testing"
+	"unicode/utf16"
+)
+
+// zipFile returns a ZIP file holding the named files with empty content
+// except for "mimetype".
+func zipFile(t *testing.T, mimeType string, names ...string) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	if mimeType != "" {
+		w, err := zw.Create("mimetype")
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(mimeType))
+	}
+	for _, name := range names {
+		if _, err := zw.Create(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// oleFile returns an OLE2 compound file header followed by a directory
+// sector holding the named streams.
+func oleFile(names ...string) []byte {
+	src := make([]byte, 1024)
+	copy(src, oleSignature)
+	binary.LittleEndian.PutUint16(src[0x1E:], 9)
+	binary.LittleEndian.PutUint32(src[0x30:], 0)
+	for i, name := range append([]string{"Root Entry"}, names...) {
+		entry := src[512+i*128:]
+		u := utf16.Encode([]rune(name))
+		for j, c := range u {
+			binary.LittleEndian.PutUint16(entry[j*2:], c)
+		}
+		binary.LittleEndian.PutUint16(entry[64:], uint16((len(u)+1)*2))
+	}
+	return src
+}
+
+func TestDetectFileTypes(t *testing.T) {
+	dir := t.TempDir()
+	files := []struct {
+		name     string
+		src      []byte
+		sniffed  string
+		mismatch bool
+	}{
+		{name: "brief.pdf", src: []byte("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n"), sniffed: "application/pdf"},
+		{name: "memo.doc", src: []byte("%PDF-1.4\n1 0 obj\n"), sniffed: "application/pdf", mismatch: true},
+		{name: "bom.pdf", src: []byte("\xef\xbb\xbf%PDF-1.4\n"), sniffed: "application/pdf"},
+		{name: "blank.pdf", src: []byte("\r\n\t %PDF-1.4\n"), sniffed: "application/pdf"},
+		{name: "padded.pdf", src: []byte("\xef\xbb\xbf\r\n %PDF-1.4\n"), sniffed: "application/pdf"},
+		{name: "later.pdf", src: []byte("x%PDF-1.4\n"), sniffed: "text/plain", mismatch: true},
+		{name: "about-pdf.txt", src: []byte("A PDF starts with %PDF- and a version.\n"), sniffed: "text/plain"},
+		{name: "letter.doc", src: oleFile("WordDocument", "\x05SummaryInformation"), sniffed: "application/msword"},
+		{name: "budget.xls", src: oleFile("Workbook"), sniffed: "application/vnd.ms-excel"},
+		{name: "message.msg", src: oleFile("__substg1.0_0037001F"), sniffed: "application/vnd.ms-outlook"},
+		{name: "report.docx", src: zipFile(t, "", "[Content_Types].xml", "_rels/.rels", "word/document.xml"), sniffed: "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+		{name: "slides.pdf", src: zipFile(t, "", "[Content_Types].xml", "ppt/presentation.xml"), sniffed: "application/vnd.openxmlformats-officedocument.presentationml.presentation", mismatch: true},
+		{name: "minutes.odt", src: zipFile(t, "application/vnd.oasis.opendocument.text", "content.xml"), sniffed: "application/vnd.oasis.opendocument.text"},
+		{name: "papers.zip", src: zipFile(t, "", "a.txt", "b.txt"), sniffed: "application/zip"},
+		{name: "reply", src: []byte("Received: by mail.example.edu\r\nFrom: jane@example.edu\r\nTo: counsel@example.edu\r\nSubject: Re: memo\r\n\r\nSee attached.\r\n"), sniffed: "message/rfc822"},
+		{name: "reply.eml", src: []byte("From: jane@example.edu\nSubject: memo\n\nHello\n"), sniffed: "message/rfc822"},
+		{name: "inbox.mbox", src: []byte("From jane@example.edu Thu Mar  7 10:11:12 2019\nFrom: jane@example.edu\nSubject: memo\n\nHello\n"), sniffed: "application/mbox"},
+		{name: "main.go", src: []byte("package main\n\nfunc main() {}\n"), sniffed: "text/plain"},
+		{name: "notes.txt", src: []byte("From the desk of the attorney general: hello\n"), sniffed: "text/plain"},
+		{name: "scan.png", src: []byte("this is not an image\n"), sniffed: "text/plain", mismatch: true},
+		{name: "empty.txt", src: []byte{}, sniffed: "application/octet-stream"},
+	}
+	tree := map[string][]byte{}
+	for _, f := range files {
+		tree[f.name] = f.src
+	}
+	writeTree(t, dir, tree)
+	fileTypes, err := DetectFileTypes(context.Background(), dir, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fileTypes) != len(files) {
+		t.Errorf("expected %d files, got %d", len(files), len(fileTypes))
+	}
+	for _, f := range files {
+		ft, ok := fileTypes[filepath.Join(dir, f.name)]
+		if !ok {
+			t.Errorf("%s missing", f.name)
+			continue
+		}
+		if ft.SniffedType != f.sniffed {
+			t.Errorf("%s: expected sniffed type %q, got %q", f.name, f.sniffed, ft.SniffedType)
+		}
+		if ft.Mismatch != f.mismatch {
+			t.Errorf("%s: expected mismatch %t, got %t (%s, %s)", f.name, f.mismatch, ft.Mismatch, ft.ExtensionType, ft.SniffedType)
+		}
+	}
+}
@@ -0,0 +1,463 @@
+package analysistools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// errStopStream ends a stream early once the first match is emitted.
+var errStopStream = errors.New("stop stream")
+
+// maxBooleanWords is the number of words matching its terms held for a
+// boolean expression until the text has been read.
+const maxBooleanWords = 100000
+
+// ErrBooleanLimit is wrapped by the error returned when a boolean
+// expression's terms matched more than 100,000 words of a text. The
+// expression is not evaluated, the other patterns' matches are complete.
+var ErrBooleanLimit = errors.New("too many matching words to evaluate a boolean expression")
+
+// streamHit is a span found in the stream along with the words before it
+// and the words after it seen so far.
+type streamHit struct {
+	span   []*Token
+	before string
+	after  []string
+}
+
+// streamMatch is a match waiting for the words after it to be read.
+type streamMatch struct {
+	index int
+	m     *Matched
+	hit   *streamHit
+}
+
+// proximityState holds the keywords of a proximity pattern that may still
+// be in range of a word yet to be read.
+type proximityState struct {
+	op      *proximityOperator
+	lefts   []*streamHit
+	rights  []*streamHit
+	pending []*streamHit
+}
+
+// streamMatcher matches patterns against tokens as they are read. It holds
+// a window of the last few tokens and the terms they matched, enough for
+// the longest phrase and the context words, and for proximity patterns the
+// keywords still in range. Boolean expressions are evaluated once the text
+// has been read using only the tokens matching one of their terms, up to
+// maxBooleanWords of them.
+type streamMatcher struct {
+	matcher *Matcher
+	context int
+	emit    func(int, *Matched) error
+
+	window      []*Token
+	windowTerms [][]int
+	windowSize  int
+	ids         []int
+	seen        []int
+	open        []*streamHit
+	queue       []*streamMatch
+	proximity   []*proximityState
+	excluding   []int
+	boolTokens  [][]*Token
+	boolHits    []map[*Token]*streamHit
+}
+
+// PhraseCheckStream reads tokens from the reader and calls emit for each
+// match as it is found. Memory use is bounded by the longest phrase,
+// the largest proximity distance (up to 10,000 words for w/s and w/p) and
+// the number of context words, so it works on files of any size.
+// Matches are emitted in the order they are found in the text. Boolean
+// expressions are decided once the whole text is read, their matches come
+// last. An expression whose terms match more than 100,000 words is not
+// evaluated and an error wrapping ErrBooleanLimit is returned after the
+// other matches are emitted. If options.MatchOne is set the stream stops
+// after the first match found in the text, whichever pattern it is for.
+// Use a Matcher to check many documents for the same patterns.
+//
+// ```
+//
+//	err := PhraseCheckStream(in, patterns, options, func(m *Matched) error {
+//	    fmt.Println(m.String())
+//	    return nil
+//	})
+//
+// ```
+func PhraseCheckStream(reader io.Reader, patterns []*Pattern, options *CheckOptions, emit func(*Matched) error) error {
+	return NewMatcher(patterns).Stream(reader, options, emit)
+}
+
+// PhraseCheckStreamContext is PhraseCheckStream stopping when the context
+// is done. The matches found up to then are emitted and an error wrapping
+// ErrPartialResults and the context's error is returned.
+func PhraseCheckStreamContext(ctx context.Context, reader io.Reader, patterns []*Pattern, options *CheckOptions, emit func(*Matched) error) error {
+	return NewMatcher(patterns).StreamContext(ctx, reader, options, emit)
+}
+
+// stream checks a text calling emit with the index of the pattern matched
+// and the match. If the context is done, or options.FileTimeout passes,
+// the matches found so far are emitted and an ErrPartialResults error is
+// returned.
+func (m *Matcher) stream(ctx context.Context, reader io.Reader, options *CheckOptions, emit func(int, *Matched) error) error {
+	ctx, cancel := fileContext(ctx, options)
+	defer cancel()
+	sm := newStreamMatcher(m, options, emit)
+	if options.MatchOne {
+		sm.emit = func(i int, m *Matched) error {
+			if err := emit(i, m); err != nil {
+				return err
+			}
+			return errStopStream
+		}
+	}
+	stream := NewTokenStream(reader, options.Mode)
+	for n := 0; ; n++ {
+		// Checking every token would slow the match down
+		if n%1024 == 0 && ctx.Err() != nil {
+			if err := sm.flush(true); err != nil && err != errStopStream {
+				return err
+			}
+			return partialResults(ctx.Err())
+		}
+		token, err := stream.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err := sm.next(token); err != nil {
+			if err == errStopStream {
+				return nil
+			}
+			return err
+		}
+	}
+	if err := sm.close(); err != nil && err != errStopStream {
+		return err
+	}
+	return nil
+}
+
+func newStreamMatcher(matcher *Matcher, options *CheckOptions, emit func(int, *Matched) error) *streamMatcher {
+	patterns := matcher.patterns
+	sm := &streamMatcher{
+		matcher:    matcher,
+		context:    options.Context,
+		emit:       emit,
+		windowSize: matcher.maxPhrase + options.Context,
+		seen:       make([]int, len(patterns)),
+		proximity:  make([]*proximityState, len(patterns)),
+		boolTokens: make([][]*Token, len(patterns)),
+		boolHits:   make([]map[*Token]*streamHit, len(patterns)),
+	}
+	for i, pattern := range patterns {
+		switch pattern.Type {
+		case Proximity:
+			sm.proximity[i] = &proximityState{op: pattern.operator()}
+			if pattern.Exclude {
+				sm.excluding = append(sm.excluding, i)
+			}
+		case Boolean:
+			sm.boolHits[i] = map[*Token]*streamHit{}
+		}
+	}
+	return sm
+}
+
+// next matches the patterns against the next token. Only the patterns
+// using a term the token matched are evaluated.
+func (sm *streamMatcher) next(token *Token) error {
+	sm.ids = sm.matcher.matchWord(token.Value, sm.ids[:0])
+	var terms []int
+	if len(sm.ids) > 0 {
+		terms = append([]int{}, sm.ids...)
+	}
+	sm.window = append(sm.window, token)
+	sm.windowTerms = append(sm.windowTerms, terms)
+	if len(sm.window) > sm.windowSize {
+		sm.window = sm.window[len(sm.window)-sm.windowSize:]
+		sm.windowTerms = sm.windowTerms[len(sm.windowTerms)-sm.windowSize:]
+	}
+	// Collect the words following the earlier hits
+	open := sm.open[:0]
+	for _, hit := range sm.open {
+		hit.after = append(hit.after, token.Raw)
+		if len(hit.after) < sm.context {
+			open = append(open, hit)
+		}
+	}
+	clear(sm.open[len(open):])
+	sm.open = open
+
+	// seen holds the word number plus one of the last token a pattern was evaluated for
+	for _, id := range terms {
+		for _, i := range sm.matcher.termPatterns[id] {
+			if sm.seen[i] == token.WordNo+1 {
+				continue
+			}
+			sm.seen[i] = token.WordNo + 1
+			if err := sm.evaluate(i, token, terms); err != nil {
+				return err
+			}
+		}
+	}
+	for _, i := range sm.excluding {
+		if sm.seen[i] != token.WordNo+1 {
+			if err := sm.resolvePending(i, token); err != nil {
+				return err
+			}
+		}
+	}
+	return sm.flush(false)
+}
+
+// evaluate checks pattern i against a token which matched one of its terms.
+func (sm *streamMatcher) evaluate(i int, token *Token, terms []int) error {
+	pattern := sm.matcher.patterns[i]
+	switch pattern.Type {
+	case Keyword:
+		hit := sm.newHit(1)
+		return sm.add(i, newMatched(pattern, hit.span), hit)
+	case Phrase:
+		if sm.phraseAtTail(sm.matcher.phraseTerms[i]) {
+			hit := sm.newHit(len(pattern.Terms))
+			return sm.add(i, newMatched(pattern, hit.span), hit)
+		}
+	case Proximity:
+		return sm.nextProximity(i, token, terms)
+	case Boolean:
+		// Past the limit the expression is dropped, see close
+		if sm.boolHits[i] == nil {
+			return nil
+		}
+		if len(sm.boolTokens[i]) == maxBooleanWords {
+			sm.boolTokens[i], sm.boolHits[i] = nil, nil
+			return nil
+		}
+		sm.boolTokens[i] = append(sm.boolTokens[i], token)
+		sm.boolHits[i][token] = sm.newHit(1)
+	}
+	return nil
+}
+
+// close resolves the remaining proximity exclusions and boolean
+// expressions then emits the matches left in the queue. The expressions
+// over maxBooleanWords are returned in an ErrBooleanLimit error.
+func (sm *streamMatcher) close() error {
+	var dropped []string
+	for i, pattern := range sm.matcher.patterns {
+		switch pattern.Type {
+		case Proximity:
+			if !pattern.Exclude {
+				continue
+			}
+			for _, hit := range sm.proximity[i].pending {
+				if err := sm.add(i, newMatched(pattern, hit.span), hit); err != nil {
+					return err
+				}
+			}
+			sm.proximity[i].pending = nil
+		case Boolean:
+			if sm.boolHits[i] == nil {
+				dropped = append(dropped, pattern.Expr.String())
+				continue
+			}
+			spans, ok := pattern.Expr.Eval(sm.boolTokens[i])
+			if !ok {
+				continue
+			}
+			for _, span := range spans {
+				first, last := sm.boolHits[i][span[0]], sm.boolHits[i][span[len(span)-1]]
+				hit := &streamHit{span: span, before: first.before, after: last.after}
+				if err := sm.add(i, newMatched(pattern, span), hit); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if err := sm.flush(true); err != nil {
+		return err
+	}
+	if len(dropped) > 0 {
+		return fmt.Errorf("%w: %s matched more than %d words", ErrBooleanLimit, strings.Join(dropped, ", "), maxBooleanWords)
+	}
+	return nil
+}
+
+// nextProximity pairs a token with the keywords still in range. For an
+// exclusion the keyword1 found are held until keyword2 can no longer be
+// in range.
+func (sm *streamMatcher) nextProximity(i int, token *Token, terms []int) error {
+	state := sm.proximity[i]
+	op := state.op
+	inRange := func(hit *streamHit) bool {
+		return hitInRange(hit, token, op)
+	}
+	state.lefts = pruneHits(state.lefts, inRange)
+	state.rights = pruneHits(state.rights, inRange)
+	if err := sm.resolvePending(i, token); err != nil {
+		return err
+	}
+
+	isLeft := slices.Contains(terms, sm.matcher.keyword1[i])
+	isRight := slices.Contains(terms, sm.matcher.keyword2[i])
+	hit := sm.newHit(1)
+	if isRight {
+		if op.exclude {
+			pending := state.pending[:0]
+			for _, left := range state.pending {
+				if _, ok := proximityPair(left.span, hit.span, op); !ok {
+					pending = append(pending, left)
+				}
+			}
+			state.pending = pending
+		} else {
+			for _, left := range state.lefts {
+				if err := sm.addPair(i, left, hit, op); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if isLeft {
+		excluded := false
+		if !op.ordered {
+			for _, right := range state.rights {
+				if op.exclude {
+					if _, ok := proximityPair(hit.span, right.span, op); ok {
+						excluded = true
+						break
+					}
+				} else if err := sm.addPair(i, hit, right, op); err != nil {
+					return err
+				}
+			}
+		}
+		if op.exclude {
+			if !excluded {
+				state.pending = append(state.pending, hit)
+			}
+		} else {
+			state.lefts = append(state.lefts, hit)
+		}
+	}
+	if isRight && !op.ordered {
+		state.rights = append(state.rights, hit)
+	}
+	return nil
+}
+
+// resolvePending emits the keyword1 of an exclusion which keyword2 can
+// no longer be in range of.
+func (sm *streamMatcher) resolvePending(i int, token *Token) error {
+	state := sm.proximity[i]
+	for len(state.pending) > 0 && !hitInRange(state.pending[0], token, state.op) {
+		hit := state.pending[0]
+		state.pending = state.pending[1:]
+		if err := sm.add(i, newMatched(sm.matcher.patterns[i], hit.span), hit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hitInRange reports if a token or those after it may be in range of a hit.
+func hitInRange(hit *streamHit, token *Token, op *proximityOperator) bool {
+	last := hit.span[len(hit.span)-1]
+	if op.scope != WordScope {
+		return token.WordNo-last.WordNo <= maxScopeWords && scopeNo(last, op.scope) >= scopeNo(token, op.scope)
+	}
+	return token.WordNo-last.WordNo <= op.maxDistance
+}
+
+// addPair adds a proximity match if the keywords are in range.
+func (sm *streamMatcher) addPair(i int, left *streamHit, right *streamHit, op *proximityOperator) error {
+	distance, ok := proximityPair(left.span, right.span, op)
+	if !ok {
+		return nil
+	}
+	m := newMatched(sm.matcher.patterns[i], left.span)
+	m.Keyword2Text = spanText(right.span)
+	m.Keyword2LineNo = right.span[0].LineNo
+	m.Keyword2WordNo = right.span[0].WordNo
+	m.Distance = distance
+	return sm.add(i, m, left)
+}
+
+// pruneHits removes the hits no longer in range.
+func pruneHits(hits []*streamHit, inRange func(*streamHit) bool) []*streamHit {
+	kept := hits[:0]
+	for _, hit := range hits {
+		if inRange(hit) {
+			kept = append(kept, hit)
+		}
+	}
+	clear(hits[len(kept):])
+	return kept
+}
+
+// tail returns the last n tokens of the window.
+func (sm *streamMatcher) tail(n int) []*Token {
+	return sm.window[len(sm.window)-n:]
+}
+
+// phraseAtTail reports if the words at the end of the window match the
+// terms of a phrase.
+func (sm *streamMatcher) phraseAtTail(ids []int) bool {
+	if len(ids) > len(sm.window) {
+		return false
+	}
+	tail := sm.windowTerms[len(sm.windowTerms)-len(ids):]
+	for j, id := range ids {
+		if !slices.Contains(tail[j], id) {
+			return false
+		}
+	}
+	return true
+}
+
+// newHit records the span of n tokens at the end of the window along with
+// the context words before it.
+func (sm *streamMatcher) newHit(n int) *streamHit {
+	hit := &streamHit{span: append([]*Token{}, sm.tail(n)...)}
+	if sm.context > 0 {
+		end := len(sm.window) - n
+		hit.before = spanText(sm.window[max(0, end-sm.context):end])
+		sm.open = append(sm.open, hit)
+	}
+	return hit
+}
+
+// add queues a match to be emitted once the words after it are read.
+func (sm *streamMatcher) add(i int, m *Matched, hit *streamHit) error {
+	sm.queue = append(sm.queue, &streamMatch{index: i, m: m, hit: hit})
+	return sm.flush(false)
+}
+
+// flush emits the queued matches in order. Unless final is set it stops
+// at the first match still waiting for words after it.
+func (sm *streamMatcher) flush(final bool) error {
+	for len(sm.queue) > 0 {
+		qm := sm.queue[0]
+		if !final && len(qm.hit.after) < sm.context {
+			return nil
+		}
+		sm.queue[0] = nil
+		sm.queue = sm.queue[1:]
+		if sm.context > 0 {
+			qm.m.Before = qm.hit.before
+			qm.m.After = strings.Join(qm.hit.after, " ")
+		}
+		if err := sm.emit(qm.index, qm.m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,330 @@
+package analysistools
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPhraseCheckStream(t *testing.T) {
+	txt := `The counsel sent a memo to the client. The attorney reviewed it.
+
+Law school newsletters are not privileged. The law firm and the client
+agreed the memo was privileged and confidential, counsel said.
+`
+	lines := []string{
+		"counsel",
+		"privileged and confidential*",
+		"memo w/3 client*",
+		"client* pre/4 agreed",
+		"attorn* w/s memo",
+		"law not w/1 school",
+		"client* not pre/p counsel*",
+		"(attorn* OR counsel*) AND NOT newsletter*",
+		"privileged and confidential* AND law",
+	}
+	patterns := []*Pattern{}
+	for _, line := range lines {
+		pattern, err := ParsePattern(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		patterns = append(patterns, pattern)
+	}
+
+	// The matches found as the text streams by are the same as those
+	// found on the whole token list
+	tokens, err := Tokenizer(txt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{}
+	for _, pattern := range patterns {
+		switch pattern.Type {
+		case Keyword:
+			for _, span := range termSpans(tokens, []string{pattern.Keyword1}, pattern.Normalization) {
+				want = append(want, fmt.Sprintf("%q %d", pattern.OriginalText, span[0].WordNo))
+			}
+		case Phrase:
+			for _, span := range checkPhrase(tokens, pattern.Terms, pattern.Normalization) {
+				want = append(want, fmt.Sprintf("%q %d", pattern.OriginalText, span[0].WordNo))
+			}
+		case Proximity:
+			for _, pm := range FindProximity(tokens, pattern) {
+				s := fmt.Sprintf("%q %d", pattern.OriginalText, pm.Span[0].WordNo)
+				if pm.Near != nil {
+					s = fmt.Sprintf("%s %d", s, pm.Near[0].WordNo)
+				}
+				want = append(want, s)
+			}
+		case Boolean:
+			spans, _ := pattern.Expr.Eval(tokens)
+			for _, span := range spans {
+				want = append(want, fmt.Sprintf("%q %d", pattern.OriginalText, span[0].WordNo))
+			}
+		}
+	}
+	matched, err := PhraseCheckReader(strings.NewReader(txt), patterns, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, m := range matched {
+		s := fmt.Sprintf("%q %d", m.Pattern, m.WordNo)
+		if m.Keyword2Text != "" {
+			s = fmt.Sprintf("%s %d", s, m.Keyword2WordNo)
+		}
+		got = append(got, s)
+	}
+	if !equalStringSlices(got, want) {
+		t.Errorf("expected\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+
+	// Streamed matches come in the order they are found with their context
+	emitted := []string{}
+	err = PhraseCheckStream(strings.NewReader(txt), patterns[:3], &CheckOptions{Context: 1}, func(m *Matched) error {
+		emitted = append(emitted, m.KWIC())
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantEmitted := []string{
+		"The [[counsel]] sent",
+		"a [[memo]] to",
+		"the [[memo]] was",
+		"was [[privileged and confidential,]] counsel",
+		"confidential, [[counsel]] said.",
+	}
+	if !equalStringSlices(emitted, wantEmitted) {
+		t.Errorf("expected %q, got %q", wantEmitted, emitted)
+	}
+
+	// A streamed MatchOne stops at the first match in the text
+	emitted = emitted[:0]
+	err = PhraseCheckStream(strings.NewReader(txt), patterns[2:4], &CheckOptions{MatchOne: true}, func(m *Matched) error {
+		emitted = append(emitted, m.String())
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(emitted, "\n"); got != `0,"memo w/3 client*","memo"` {
+		t.Errorf("expected the first match, got %q", got)
+	}
+
+	// Checking with MatchOne returns every match of the first pattern
+	// which matched
+	matched, err = PhraseCheckReaderWithOptions(strings.NewReader(txt), patterns[2:4], &CheckOptions{MatchOne: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := MatchedStrings(matched); got != "0,\"memo w/3 client*\",\"memo\"\n3,\"memo w/3 client*\",\"memo\"" {
+		t.Errorf("expected the matches of the first pattern, got %q", got)
+	}
+}
+
+func TestCheckTextOrder(t *testing.T) {
+	txt := "The memo went to the attorney today. Another memo followed.\n"
+	patterns := []*Pattern{}
+	for _, src := range []string{"attorney", "memo"} {
+		pattern, err := ParsePattern(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	tests := []struct {
+		options  *CheckOptions
+		expected string
+	}{
+		{options: &CheckOptions{}, expected: "attorney 5,memo 1,memo 8"},
+		{options: &CheckOptions{MatchOne: true}, expected: "attorney 5"},
+		{options: &CheckOptions{StreamOrder: true}, expected: "memo 1,attorney 5,memo 8"},
+		{options: &CheckOptions{StreamOrder: true, MatchOne: true}, expected: "memo 1"},
+	}
+	for i, test := range tests {
+		got := []string{}
+		err := checkText(context.Background(), NewMatcher(patterns), strings.NewReader(txt), test.options, func(m *Matched) error {
+			got = append(got, fmt.Sprintf("%s %d", m.Text, m.WordNo))
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(got, ",") != test.expected {
+			t.Errorf("test %d: expected %q, got %q", i, test.expected, strings.Join(got, ","))
+		}
+	}
+}
+
+func TestStreamLongToken(t *testing.T) {
+	// bufio.Scanner stops at tokens over 64KB, e.g. base64 in an email
+	blob := strings.Repeat("QUJD", 50000)
+	txt := fmt.Sprintf("Content-Transfer-Encoding: base64\n%s\nprivileged memo\n", blob)
+	tokens, err := Tokenizer(txt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 5 || tokens[2].Value != blob || tokens[3].LineNo != 2 {
+		t.Fatalf("expected the long token to be read whole, got %d tokens", len(tokens))
+	}
+	pattern, err := ParsePattern("privileged w/2 memo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	matched, err := PhraseCheck(txt, []*Pattern{pattern}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := MatchedStrings(matched); got != `2,"privileged w/2 memo","privileged"` {
+		t.Errorf("expected a match after the long token, got %q", got)
+	}
+}
+
+func TestStreamBooleanLimit(t *testing.T) {
+	// A boolean expression's words are held until the end of the text
+	txt := "privileged memo\n" + strings.Repeat("counsel ", maxBooleanWords)
+	patterns := []*Pattern{}
+	for _, src := range []string{"privileged", "memo AND counsel"} {
+		pattern, err := ParsePattern(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	matched, err := PhraseCheckReaderWithOptions(strings.NewReader(txt), patterns, &CheckOptions{})
+	if !errors.Is(err, ErrBooleanLimit) {
+		t.Errorf("expected the boolean limit, got %v", err)
+	}
+	if got := MatchedStrings(matched); got != `0,"privileged","privileged"` {
+		t.Errorf("expected the keyword's match, got %q", got)
+	}
+	matched, err = PhraseCheckReaderWithOptions(strings.NewReader(txt[:len(txt)-len("counsel ")]), patterns[1:], &CheckOptions{})
+	if err != nil || len(matched) != maxBooleanWords {
+		t.Errorf("expected %d matches, got %d, %v", maxBooleanWords, len(matched), err)
+	}
+
+	// The check actions report the file's error and fail once the other
+	// files are checked
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"big.txt": txt, "small.txt": "privileged memo counsel\n"})
+	for _, workers := range []int{1, 2} {
+		out := new(bytes.Buffer)
+		err := checkDirectory(context.Background(), out, dir, patterns, nil, &CheckOptions{Workers: workers, Format: JSONLFormat})
+		if !errors.Is(err, ErrBooleanLimit) {
+			t.Errorf("workers %d: expected the boolean limit, got %v", workers, err)
+		}
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		if len(lines) != 5 || !strings.Contains(lines[1], `"error":"too many matching words`) || !strings.Contains(lines[4], "small.txt") {
+			t.Errorf("workers %d: expected the error row after big.txt's match, got\n%s", workers, out.String())
+		}
+	}
+	dbName := filepath.Join(t.TempDir(), "results.db")
+	err = recordRun(dbName, "check-directory", []string{dir}, patterns, func(run *ResultsRun) error {
+		return recordDirectory(context.Background(), run, dir, patterns, nil, &CheckOptions{})
+	})
+	if !errors.Is(err, ErrBooleanLimit) {
+		t.Errorf("expected the boolean limit recording the run, got %v", err)
+	}
+	db, err := sql.Open("sqlite", dbName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var fileErr string
+	if err := db.QueryRow(`SELECT error FROM files WHERE path LIKE '%big.txt'`).Scan(&fileErr); err != nil || !strings.Contains(fileErr, "memo AND counsel") {
+		t.Errorf("expected big.txt's error to be recorded, got %q %v", fileErr, err)
+	}
+}
+
+func TestStreamScopeLimit(t *testing.T) {
+	// A sentence without a full stop holds its keywords for at most
+	// maxScopeWords words
+	for _, src := range []string{"privilege w/s counsel", "privilege w/s counsel AND privilege"} {
+		pattern, err := ParsePattern(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, filler := range []int{maxScopeWords - 1, maxScopeWords} {
+			txt := "privilege " + strings.Repeat("x ", filler) + "counsel\n"
+			matched, err := PhraseCheck(txt, []*Pattern{pattern}, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if found := len(matched) > 0; found != (filler < maxScopeWords) {
+				t.Errorf("%s with %d words between the keywords: expected a match %t", src, filler, !found)
+			}
+		}
+	}
+}
+
+// cancelReader cancels a context once n bytes have been read, reading a
+// few bytes at a time.
+type cancelReader struct {
+	r      io.Reader
+	n      int
+	cancel context.CancelFunc
+}
+
+func (cr *cancelReader) Read(p []byte) (int, error) {
+	if cr.n <= 0 {
+		cr.cancel()
+	}
+	n, err := cr.r.Read(p[:min(len(p), 16)])
+	cr.n -= n
+	return n, err
+}
+
+// slowReader waits before each read.
+type slowReader struct {
+	r io.Reader
+}
+
+func (sr *slowReader) Read(p []byte) (int, error) {
+	time.Sleep(time.Millisecond)
+	return sr.r.Read(p[:min(len(p), 16)])
+}
+
+func TestPhraseCheckCancel(t *testing.T) {
+	txt := strings.Repeat("The attorney sent a memo to the client.\n", 2000)
+	pattern, err := ParsePattern("attorn*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	patterns := []*Pattern{pattern}
+
+	// Cancelled part way the matches found so far are returned
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	in := &cancelReader{r: strings.NewReader(txt), n: len(txt) / 2, cancel: cancel}
+	matched, err := PhraseCheckReaderContext(ctx, in, patterns, &CheckOptions{})
+	if !errors.Is(err, ErrPartialResults) || !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a partial results error, got %v", err)
+	}
+	if len(matched) == 0 || len(matched) >= 2000 {
+		t.Errorf("expected some of the matches, got %d", len(matched))
+	}
+
+	// A file taking too long stops at the file timeout
+	matched, err = PhraseCheckReaderContext(context.Background(), &slowReader{r: strings.NewReader(txt)}, patterns, &CheckOptions{FileTimeout: 50 * time.Millisecond})
+	if !errors.Is(err, ErrPartialResults) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected a timed out error, got %v", err)
+	}
+	if len(matched) >= 2000 {
+		t.Errorf("expected some of the matches, got %d", len(matched))
+	}
+
+	// Without a timeout every match is found
+	matched, err = PhraseCheckReaderContext(context.Background(), strings.NewReader(txt), patterns, &CheckOptions{})
+	if err != nil || len(matched) != 2000 {
+		t.Errorf("expected 2000 matches, got %d, %v", len(matched), err)
+	}
+}
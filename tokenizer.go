@@ -11,12 +11,41 @@ import (
 
 
 
+// Token is a word found in a text along with its position. Sentences end
+// with a word ending in ".", "!" or "?" and paragraphs are separated by
+// a blank line. Value is the word used for matching and Raw is the word
+// as it was found in the text. StartOffset and EndOffset are the byte
+// offsets of Raw in the text, Column and EndColumn count the characters
+// from the start of the line. Like LineNo they count from zero and the
+// end positions are just past the last character of the word. PageNo
+// counts from one, as a PDF viewer does, a form feed starts a new page.
 type Token struct {
 	Value string
+	Raw string
 	LineNo int
+	PageNo int
 	WordNo int
+	SentenceNo int
+	ParagraphNo int
+	StartOffset int
+	EndOffset int
+	Column int
+	EndColumn int
 }
 
+// TokenizerMode selects how words are separated from punctuation.
+type TokenizerMode string
+
+const (
+	// SplitWhitespace splits words on whitespace only, it is the default.
+	SplitWhitespace TokenizerMode = "whitespace"
+	// SplitPunctuation also strips the leading and trailing punctuation
+	// from words, e.g. "(counsel)," becomes "counsel". Punctuation inside
+	// a word such as "attorney-client", "client's" or an email address is
+	// kept.
+	SplitPunctuation TokenizerMode = "punctuation"
+)
+
 // Tokenizer breaks a text document down into a list of word tokens
 //
 // ```
@@ -29,72 +58,169 @@ func Tokenizer(src string) ([]*Token, error) {
 
 // TokenReader reads a buffer and returns a list of Tokens
 func TokenReader(in io.Reader) ([]*Token, error) {
-	scanner := bufio.NewScanner(in)
-	scanner.Split(scanWordsAndNewLines)
-	lineNo := 0
-	wordNo := 0
+	return TokenReaderWithMode(in, SplitWhitespace)
+}
+
+// TokenReaderWithMode reads a buffer and returns a list of Tokens split
+// according to mode.
+func TokenReaderWithMode(in io.Reader, mode TokenizerMode) ([]*Token, error) {
+	stream := NewTokenStream(in, mode)
 	results := []*Token{}
-	for scanner.Scan() {
-		token := scanner.Text()
-		if token == "\n" {
-			lineNo++
-		} else {
-			results = append(results, &Token{
-				Value: strings.TrimSpace(token),
-				LineNo: lineNo,
-				WordNo: wordNo,
-			})
-			wordNo++
+	for {
+		token, err := stream.Next()
+		if err == io.EOF {
+			return results, nil
+		}
+		if err != nil {
+			return results, err
 		}
+		results = append(results, token)
 	}
-	if err := scanner.Err(); err != nil {
-		return results, fmt.Errorf("scanning error: %s", err)
+}
+
+// TokenStream reads the tokens of a text one at a time. Only the word being
+// read is held in memory so it can tokenize files of any size and words of
+// any length, e.g. a base64 blob in an email.
+//
+// ```
+//  stream := NewTokenStream(in, SplitWhitespace)
+//  for {
+//      token, err := stream.Next()
+//      if err == io.EOF {
+//          break
+//      }
+//      ...
+//  }
+// ```
+type TokenStream struct {
+	in   *bufio.Reader
+	mode TokenizerMode
+	word []byte
+
+	offset         int
+	column         int
+	lineNo         int
+	pageNo         int
+	wordNo         int
+	sentenceNo     int
+	paragraphNo    int
+	newLines       int
+	endOfParagraph bool
+	endOfSentence  bool
+}
+
+// NewTokenStream returns a TokenStream reading from in.
+func NewTokenStream(in io.Reader, mode TokenizerMode) *TokenStream {
+	return &TokenStream{
+		in:     bufio.NewReader(in),
+		mode:   mode,
+		pageNo: 1,
 	}
-	return results, nil
 }
 
-// scanWordsAndNewLines is a custom split function that returns words and newlines as tokens
-func scanWordsAndNewLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
-	// Skip leading spaces (except newlines)
-	start := 0
-	for width := 0; start < len(data); start += width {
-		var r rune
-		r, width = utf8.DecodeRune(data[start:])
-		if r != ' ' && r != '\t' && r != '\r' {
-			break
+// peekRune returns the next rune and its bytes without consuming them.
+func (ts *TokenStream) peekRune() (rune, []byte, error) {
+	buf, err := ts.in.Peek(utf8.UTFMax)
+	if len(buf) == 0 {
+		if err == nil {
+			err = io.EOF
 		}
+		return 0, nil, err
 	}
+	r, size := utf8.DecodeRune(buf)
+	return r, buf[:size], nil
+}
 
-	// If we're at a newline, return it as a token
-	if start < len(data) && data[start] == '\n' {
-		return start + 1, []byte{'\n'}, nil
-	}
+// advance consumes the bytes of a rune peeked at.
+func (ts *TokenStream) advance(size int) {
+	ts.in.Discard(size)
+	ts.offset += size
+	ts.column++
+}
 
-	// Scan until word boundary or newline
-	for width, i := 0, start; i < len(data); i += width {
-		var r rune
-		r, width = utf8.DecodeRune(data[i:])
-		if unicode.IsSpace(r) {
+// Next returns the next token or io.EOF when the text has been read.
+func (ts *TokenStream) Next() (*Token, error) {
+	for {
+		// Skip the spaces and newlines before the word
+		r, buf, err := ts.peekRune()
+		for err == nil && unicode.IsSpace(r) {
+			ts.advance(len(buf))
 			if r == '\n' {
-				// Return the word before the newline
-				if i > start {
-					return i, data[start:i], nil
-				}
-				// Return the newline itself
-				return i + width, []byte{'\n'}, nil
+				ts.lineNo++
+				ts.column = 0
+				ts.newLines++
+				ts.endOfParagraph = ts.endOfParagraph || (ts.wordNo > 0 && ts.newLines > 1)
 			}
-			// Return the word before other whitespace
-			if i > start {
-				return i, data[start:i], nil
+			if r == '\f' {
+				ts.pageNo++
+				ts.column = 0
 			}
+			r, buf, err = ts.peekRune()
+		}
+		if err != nil {
+			if err == io.EOF {
+				return nil, err
+			}
+			return nil, fmt.Errorf("scanning error: %s", err)
 		}
-	}
 
-	// If we're at EOF and there's remaining data, return it as a word
-	if atEOF && len(data) > start {
-		return len(data), data[start:], nil
+		// Read the word up to the next space
+		startOffset, column := ts.offset, ts.column
+		ts.word = ts.word[:0]
+		for err == nil && !unicode.IsSpace(r) {
+			ts.word = append(ts.word, buf...)
+			ts.advance(len(buf))
+			r, buf, err = ts.peekRune()
+		}
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("scanning error: %s", err)
+		}
+		ts.newLines = 0
+		raw := string(ts.word)
+		value := raw
+		if ts.mode == SplitPunctuation {
+			value = strings.TrimFunc(raw, isPunctuation)
+			if value == "" {
+				// Punctuation on its own is not a word but may end a sentence
+				ts.endOfSentence = ts.endOfSentence || isEndOfSentence(raw)
+				continue
+			}
+		}
+		if ts.endOfParagraph {
+			ts.paragraphNo++
+			ts.endOfSentence = true
+			ts.endOfParagraph = false
+		}
+		if ts.endOfSentence {
+			ts.sentenceNo++
+		}
+		token := &Token{
+			Value: value,
+			Raw: raw,
+			LineNo: ts.lineNo,
+			PageNo: ts.pageNo,
+			WordNo: ts.wordNo,
+			SentenceNo: ts.sentenceNo,
+			ParagraphNo: ts.paragraphNo,
+			StartOffset: startOffset,
+			EndOffset: ts.offset,
+			Column: column,
+			EndColumn: ts.column,
+		}
+		ts.wordNo++
+		ts.endOfSentence = isEndOfSentence(raw)
+		return token, nil
 	}
+}
+
+// isPunctuation reports if a rune is punctuation or a symbol.
+func isPunctuation(r rune) bool {
+	return unicode.IsPunct(r) || unicode.IsSymbol(r)
+}
 
-	// Request more data
-	return start, nil, nil
+// isEndOfSentence reports if a word ends with sentence ending punctuation,
+// allowing for closing quotes and brackets, e.g. "court." or "denied!)".
+func isEndOfSentence(word string) bool {
+	word = strings.TrimRight(word, "\"')]}\u2019\u201d")
+	return strings.HasSuffix(word, ".") || strings.HasSuffix(word, "!") || strings.HasSuffix(word, "?")
 }
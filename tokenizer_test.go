@@ -3,6 +3,7 @@ package analysistools
 import (
 	//"fmt"
 	//"os"
+	"strings"
 	"testing"
 )
 
@@ -19,27 +20,27 @@ Yet without a double is still presents a test.
 		t.Errorf("expected err == nil, got %s", err)
 	}
 	expected := []*Token{
-		{ Value: "This", LineNo: 0, WordNo: 0 },
-		{ Value: "is", LineNo: 0, WordNo: 1 },
-		{ Value: "a", LineNo: 0, WordNo: 2 },
-		{ Value: "humble", LineNo: 0, WordNo: 3 },
-		{ Value: "multilined", LineNo: 1, WordNo: 4 },
-		{ Value: "text.", LineNo: 1, WordNo: 5 },
-		{ Value: "Is", LineNo: 1, WordNo: 6 },
-		{ Value: "it", LineNo: 1, WordNo: 7 },
-		{ Value: "but", LineNo: 1, WordNo: 8 },
-		{ Value: "a", LineNo: 1, WordNo: 9 },
-		{ Value: "poetic", LineNo: 2, WordNo: 10 },
-		{ Value: "chorus", LineNo: 2, WordNo: 11 },
-		{ Value: "Yet", LineNo: 4, WordNo: 12 },
-		{ Value: "without", LineNo: 4, WordNo: 13 },
-		{ Value: "a", LineNo: 4, WordNo: 14 },
-		{ Value: "double", LineNo: 4, WordNo: 15 },
-		{ Value: "is", LineNo: 4, WordNo: 16 },
-		{ Value: "still", LineNo: 4, WordNo: 17 },
-		{ Value: "presents", LineNo: 4, WordNo: 18 },
-		{ Value: "a", LineNo: 4, WordNo: 19 },
-		{ Value: "test.", LineNo: 4, WordNo: 20 },
+		{ Value: "This", LineNo: 0, WordNo: 0, SentenceNo: 0, ParagraphNo: 0 },
+		{ Value: "is", LineNo: 0, WordNo: 1, SentenceNo: 0, ParagraphNo: 0 },
+		{ Value: "a", LineNo: 0, WordNo: 2, SentenceNo: 0, ParagraphNo: 0 },
+		{ Value: "humble", LineNo: 0, WordNo: 3, SentenceNo: 0, ParagraphNo: 0 },
+		{ Value: "multilined", LineNo: 1, WordNo: 4, SentenceNo: 0, ParagraphNo: 0 },
+		{ Value: "text.", LineNo: 1, WordNo: 5, SentenceNo: 0, ParagraphNo: 0 },
+		{ Value: "Is", LineNo: 1, WordNo: 6, SentenceNo: 1, ParagraphNo: 0 },
+		{ Value: "it", LineNo: 1, WordNo: 7, SentenceNo: 1, ParagraphNo: 0 },
+		{ Value: "but", LineNo: 1, WordNo: 8, SentenceNo: 1, ParagraphNo: 0 },
+		{ Value: "a", LineNo: 1, WordNo: 9, SentenceNo: 1, ParagraphNo: 0 },
+		{ Value: "poetic", LineNo: 2, WordNo: 10, SentenceNo: 1, ParagraphNo: 0 },
+		{ Value: "chorus", LineNo: 2, WordNo: 11, SentenceNo: 1, ParagraphNo: 0 },
+		{ Value: "Yet", LineNo: 4, WordNo: 12, SentenceNo: 2, ParagraphNo: 1 },
+		{ Value: "without", LineNo: 4, WordNo: 13, SentenceNo: 2, ParagraphNo: 1 },
+		{ Value: "a", LineNo: 4, WordNo: 14, SentenceNo: 2, ParagraphNo: 1 },
+		{ Value: "double", LineNo: 4, WordNo: 15, SentenceNo: 2, ParagraphNo: 1 },
+		{ Value: "is", LineNo: 4, WordNo: 16, SentenceNo: 2, ParagraphNo: 1 },
+		{ Value: "still", LineNo: 4, WordNo: 17, SentenceNo: 2, ParagraphNo: 1 },
+		{ Value: "presents", LineNo: 4, WordNo: 18, SentenceNo: 2, ParagraphNo: 1 },
+		{ Value: "a", LineNo: 4, WordNo: 19, SentenceNo: 2, ParagraphNo: 1 },
+		{ Value: "test.", LineNo: 4, WordNo: 20, SentenceNo: 2, ParagraphNo: 1 },
 	}
 	if len(tokens) != len(expected) {
 		t.Errorf("expected %d tokens, got %d", len(expected), len(tokens))
@@ -63,5 +64,125 @@ Yet without a double is still presents a test.
 		if tok.WordNo != expected[i].WordNo {
 			t.Errorf("expectd WordNo %d, got %d, token #%d %+v", expected[i].WordNo, tok.WordNo, i, tok)
 		}
+		if tok.SentenceNo != expected[i].SentenceNo {
+			t.Errorf("expectd SentenceNo %d, got %d, token #%d %+v", expected[i].SentenceNo, tok.SentenceNo, i, tok)
+		}
+		if tok.ParagraphNo != expected[i].ParagraphNo {
+			t.Errorf("expectd ParagraphNo %d, got %d, token #%d %+v", expected[i].ParagraphNo, tok.ParagraphNo, i, tok)
+		}
+	}
+}
+
+func TestSentencesAndParagraphs(t *testing.T) {
+	txt := `"Is it privileged?" she asked. (The memo said so.)
+Counsel agreed!
+
+  
+A new paragraph.
+`
+	tokens, err := Tokenizer(txt)
+	if err != nil {
+		t.Errorf("expected err == nil, got %s", err)
+	}
+	expected := []struct {
+		sentenceNo  int
+		paragraphNo int
+	}{
+		{0, 0}, {0, 0}, {0, 0}, // "Is it privileged?"
+		{1, 0}, {1, 0}, // she asked.
+		{2, 0}, {2, 0}, {2, 0}, {2, 0}, // (The memo said so.)
+		{3, 0}, {3, 0}, // Counsel agreed!
+		{4, 1}, {4, 1}, {4, 1}, // A new paragraph.
+	}
+	if len(tokens) != len(expected) {
+		t.Fatalf("expected %d tokens, got %d", len(expected), len(tokens))
+	}
+	for i, tok := range tokens {
+		if tok.SentenceNo != expected[i].sentenceNo || tok.ParagraphNo != expected[i].paragraphNo {
+			t.Errorf("token #%d %q expected sentence %d, paragraph %d, got %d, %d", i, tok.Value, expected[i].sentenceNo, expected[i].paragraphNo, tok.SentenceNo, tok.ParagraphNo)
+		}
+	}
+}
+
+func TestPunctuationTokenizer(t *testing.T) {
+	txt := `"Privileged," said the attorney-client memo (see counsel's note).
+Email <jane.doe@example.com>, not the plaintiffs' lawyer -- ok?`
+	tokens, err := TokenReaderWithMode(strings.NewReader(txt), SplitPunctuation)
+	if err != nil {
+		t.Errorf("expected err == nil, got %s", err)
+	}
+	expected := []*Token{
+		{ Value: "Privileged", Raw: "\"Privileged,\"", LineNo: 0, WordNo: 0 },
+		{ Value: "said", Raw: "said", LineNo: 0, WordNo: 1 },
+		{ Value: "the", Raw: "the", LineNo: 0, WordNo: 2 },
+		{ Value: "attorney-client", Raw: "attorney-client", LineNo: 0, WordNo: 3 },
+		{ Value: "memo", Raw: "memo", LineNo: 0, WordNo: 4 },
+		{ Value: "see", Raw: "(see", LineNo: 0, WordNo: 5 },
+		{ Value: "counsel's", Raw: "counsel's", LineNo: 0, WordNo: 6 },
+		{ Value: "note", Raw: "note).", LineNo: 0, WordNo: 7 },
+		{ Value: "Email", Raw: "Email", LineNo: 1, WordNo: 8, SentenceNo: 1 },
+		{ Value: "jane.doe@example.com", Raw: "<jane.doe@example.com>,", LineNo: 1, WordNo: 9, SentenceNo: 1 },
+		{ Value: "not", Raw: "not", LineNo: 1, WordNo: 10, SentenceNo: 1 },
+		{ Value: "the", Raw: "the", LineNo: 1, WordNo: 11, SentenceNo: 1 },
+		{ Value: "plaintiffs", Raw: "plaintiffs'", LineNo: 1, WordNo: 12, SentenceNo: 1 },
+		{ Value: "lawyer", Raw: "lawyer", LineNo: 1, WordNo: 13, SentenceNo: 1 },
+		{ Value: "ok", Raw: "ok?", LineNo: 1, WordNo: 14, SentenceNo: 1 },
+	}
+	if len(tokens) != len(expected) {
+		t.Fatalf("expected %d tokens, got %d", len(expected), len(tokens))
+	}
+	for i, tok := range tokens {
+		if tok.Value != expected[i].Value || tok.Raw != expected[i].Raw {
+			t.Errorf("token #%d expected %q (%q), got %q (%q)", i, expected[i].Value, expected[i].Raw, tok.Value, tok.Raw)
+		}
+		if tok.LineNo != expected[i].LineNo || tok.WordNo != expected[i].WordNo || tok.SentenceNo != expected[i].SentenceNo {
+			t.Errorf("token #%d expected %+v, got %+v", i, expected[i], tok)
+		}
+	}
+}
+
+func TestTokenPositions(t *testing.T) {
+	txt := "Dear Café owner,\r\n\t(counsel) é\n\n   privilege"
+	tokens, err := TokenReaderWithMode(strings.NewReader(txt), SplitPunctuation)
+	if err != nil {
+		t.Errorf("expected err == nil, got %s", err)
+	}
+	for _, tok := range tokens {
+		if got := txt[tok.StartOffset:tok.EndOffset]; got != tok.Raw {
+			t.Errorf("expected offsets %d:%d to hold %q, got %q", tok.StartOffset, tok.EndOffset, tok.Raw, got)
+		}
+	}
+	expected := []struct {
+		value     string
+		column    int
+		endColumn int
+	}{
+		{"Dear", 0, 4}, {"Café", 5, 9}, {"owner", 10, 16},
+		{"counsel", 1, 10}, {"é", 11, 12},
+		{"privilege", 3, 12},
+	}
+	if len(tokens) != len(expected) {
+		t.Fatalf("expected %d tokens, got %d", len(expected), len(tokens))
+	}
+	for i, tok := range tokens {
+		if tok.Value != expected[i].value || tok.Column != expected[i].column || tok.EndColumn != expected[i].endColumn {
+			t.Errorf("token #%d expected %q at column %d-%d, got %q at %d-%d", i, expected[i].value, expected[i].column, expected[i].endColumn, tok.Value, tok.Column, tok.EndColumn)
+		}
+	}
+
+	// Offsets must survive the scanner refilling its buffer
+	line := strings.Repeat("wörd ", 1000) + "\n"
+	txt = strings.Repeat(line, 5)
+	tokens, err = Tokenizer(txt)
+	if err != nil {
+		t.Errorf("expected err == nil, got %s", err)
+	}
+	for _, tok := range tokens {
+		if got := txt[tok.StartOffset:tok.EndOffset]; got != tok.Raw {
+			t.Fatalf("expected offsets %d:%d to hold %q, got %q", tok.StartOffset, tok.EndOffset, tok.Raw, got)
+		}
+		if want := (tok.WordNo % 1000) * 5; tok.Column != want {
+			t.Fatalf("expected token %d at column %d, got %d", tok.WordNo, want, tok.Column)
+		}
 	}
-}
\ No newline at end of file
+}